@@ -0,0 +1,52 @@
+// Command migrate splits tweets out of the legacy shared users collection into their own
+// tweets collection and creates the indexes the API expects.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"twitter-feed/config"
+	"twitter-feed/config/db"
+	"twitter-feed/store"
+)
+
+func main() {
+	configPath := flag.String("config", os.Getenv("TWITTER_CONFIG"), "JSON config file (env: TWITTER_CONFIG)")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing anything")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Store = "mongo"
+	err = cfg.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := db.Connect(context.Background(), cfg.Mongo.URI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	report, err := store.SplitTweets(context.Background(), client.Database(cfg.Mongo.Database), cfg.Mongo.Collections, *dryRun)
+	fmt.Printf("tweets moved:        %d\n", report.TweetsMoved)
+	fmt.Printf("tweets without date: %d\n", report.UndatedTweets)
+	fmt.Printf("users cleaned:       %d\n", report.UsersCleaned)
+	for _, id := range report.OrphanedTweets {
+		fmt.Printf("orphaned tweet:      %s\n", id)
+	}
+	for _, username := range report.DuplicateUsernames {
+		fmt.Printf("duplicate username:  %s\n", username)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun {
+		fmt.Println("dry run, nothing was written")
+	}
+}
@@ -0,0 +1,53 @@
+// Command repairfollows rebuilds the follows collection from the follow lists that user
+// documents used to embed, recounts every user's followers and followings and reports the
+// follows that were inconsistent.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"twitter-feed/config"
+	"twitter-feed/config/db"
+	"twitter-feed/store"
+)
+
+func main() {
+	configPath := flag.String("config", os.Getenv("TWITTER_CONFIG"), "JSON config file (env: TWITTER_CONFIG)")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing anything")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Store = "mongo"
+	err = cfg.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := db.Connect(context.Background(), cfg.Mongo.URI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	report, err := store.RepairFollows(context.Background(), client.Database(cfg.Mongo.Database), cfg.Mongo.Collections, *dryRun)
+	fmt.Printf("edges created:       %d\n", report.EdgesCreated)
+	fmt.Printf("counts fixed:        %d\n", report.CountsFixed)
+	fmt.Printf("users cleaned:       %d\n", report.UsersCleaned)
+	for _, follow := range report.OneSided {
+		fmt.Printf("one-sided follow:    %s\n", follow)
+	}
+	for _, follow := range report.Dangling {
+		fmt.Printf("dangling follow:     %s\n", follow)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun {
+		fmt.Println("dry run, nothing was written")
+	}
+}
@@ -0,0 +1,372 @@
+// Package config loads the server settings. Values start from Default, are overridden by an
+// optional JSON file and then by TWITTER_* environment variables, so the same binary can run
+// in every environment.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"twitter-feed/store"
+)
+
+// Config holds every setting of the server
+type Config struct {
+	// Store is the storage backend: mongo or memory
+	Store string `json:"store"`
+	Mongo Mongo  `json:"mongo"`
+	HTTP  HTTP   `json:"http"`
+	// BcryptCost is the work factor used when hashing passwords
+	BcryptCost int `json:"bcrypt_cost"`
+	// Timeline is the home timeline strategy: pull (query on read) or fanout (materialize on write)
+	Timeline string   `json:"timeline"`
+	Fanout   Fanout   `json:"fanout"`
+	Password Password `json:"password"`
+	Tweet    Tweet    `json:"tweet"`
+	Trends   Trends   `json:"trends"`
+	Stream   Stream   `json:"stream"`
+	DM       DM       `json:"dm"`
+	Deletion Deletion `json:"deletion"`
+}
+
+// Mongo locates the database
+type Mongo struct {
+	URI         string            `json:"uri"`
+	Database    string            `json:"database"`
+	Collections store.Collections `json:"collections"`
+	// ConnectTimeout bounds connecting and creating indexes at startup
+	ConnectTimeout Duration `json:"connect_timeout"`
+}
+
+// HTTP configures the listener
+type HTTP struct {
+	Addr string `json:"addr"`
+	// TLSCert and TLSKey are PEM file paths; the server speaks HTTPS when both are set
+	TLSCert      string   `json:"tls_cert"`
+	TLSKey       string   `json:"tls_key"`
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+	IdleTimeout  Duration `json:"idle_timeout"`
+	// RequestTimeout is the deadline given to each request's context, and so to its store calls
+	RequestTimeout Duration `json:"request_timeout"`
+	// ShutdownTimeout is how long in-flight requests and queued jobs get to finish on SIGINT or SIGTERM
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+}
+
+// Fanout tunes fan-out-on-write timelines
+type Fanout struct {
+	Workers   int `json:"workers"`
+	Threshold int `json:"threshold"`
+	Capacity  int `json:"capacity"`
+}
+
+// Password is the password policy
+type Password struct {
+	MinLength     int  `json:"min_length"`
+	RequireSymbol bool `json:"require_symbol"`
+	// Blocklist is a file of breached passwords, one per line
+	Blocklist string `json:"blocklist"`
+}
+
+// Tweet limits tweet length, counted in weighted characters
+type Tweet struct {
+	MaxLength int `json:"max_length"`
+	// URLLength is what every URL counts for, whatever its actual length
+	URLLength int `json:"url_length"`
+}
+
+// Trends tunes trending hashtags
+type Trends struct {
+	// Bucket is the granularity hashtag counts are kept at
+	Bucket Duration `json:"bucket"`
+	// Baseline is how much history a hashtag's usual rate is measured over
+	Baseline Duration `json:"baseline"`
+	// Interval is how often trends are recomputed
+	Interval Duration `json:"interval"`
+	Size     int      `json:"size"`
+	MinCount int      `json:"min_count"`
+}
+
+// Stream tunes the streaming endpoints
+type Stream struct {
+	// Buffer is how many events a connection can have waiting before the policy applies
+	Buffer int `json:"buffer"`
+	// Replay is how many of each user's latest events are kept for clients resuming a stream
+	Replay int `json:"replay"`
+	// Retain is how long those events are kept after a user's last connection ends
+	Retain Duration `json:"retain"`
+	// Policy is what happens to connections that fall behind: disconnect or drop
+	Policy    string   `json:"policy"`
+	Heartbeat Duration `json:"heartbeat"`
+	// Lifetime ends server-sent event streams before http.write_timeout cuts them off; it can
+	// only be 0, for no limit, when there is no write timeout
+	Lifetime Duration `json:"lifetime"`
+}
+
+// DM limits direct messages
+type DM struct {
+	MaxLength int `json:"max_length"`
+	// MaxParticipants counts the creator of a conversation too
+	MaxParticipants int `json:"max_participants"`
+}
+
+// Deletion tunes account deletion
+type Deletion struct {
+	// GracePeriod is how long a deleted account can still be restored by logging in; 0 purges it right away
+	GracePeriod Duration `json:"grace_period"`
+	// Interval is how often accounts whose grace period is over are looked for
+	Interval Duration `json:"interval"`
+}
+
+// Duration is a time.Duration written as a string such as "15s" in config files
+type Duration time.Duration
+
+// UnmarshalJSON accepts a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations must be strings such as \"15s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() Config {
+	return Config{
+		Store: "mongo",
+		Mongo: Mongo{
+			URI:            "mongodb://localhost:27017",
+			Database:       "GoLogin",
+			Collections:    store.DefaultCollections,
+			ConnectTimeout: Duration(10 * time.Second),
+		},
+		HTTP: HTTP{
+			Addr:            ":8080",
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(30 * time.Second),
+			IdleTimeout:     Duration(2 * time.Minute),
+			RequestTimeout:  Duration(10 * time.Second),
+			ShutdownTimeout: Duration(20 * time.Second),
+		},
+		BcryptCost: bcrypt.DefaultCost,
+		Timeline:   "pull",
+		Fanout: Fanout{
+			Workers:   4,
+			Threshold: 10000,
+			Capacity:  800,
+		},
+		Password: Password{
+			MinLength: 8,
+		},
+		Tweet: Tweet{
+			MaxLength: 280,
+			URLLength: 23,
+		},
+		Trends: Trends{
+			Bucket:   Duration(5 * time.Minute),
+			Baseline: Duration(7 * 24 * time.Hour),
+			Interval: Duration(time.Minute),
+			Size:     10,
+			MinCount: 3,
+		},
+		Stream: Stream{
+			Buffer:    64,
+			Replay:    256,
+			Retain:    Duration(5 * time.Minute),
+			Policy:    "disconnect",
+			Heartbeat: Duration(15 * time.Second),
+			Lifetime:  Duration(25 * time.Second),
+		},
+		DM: DM{
+			MaxLength:       10000,
+			MaxParticipants: 10,
+		},
+		Deletion: Deletion{
+			GracePeriod: Duration(30 * 24 * time.Hour),
+			Interval:    Duration(time.Minute),
+		},
+	}
+}
+
+// Load returns Default overridden by the JSON file at path, when path is not empty, and then
+// by the environment. Call Validate once every override has been applied.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return cfg, err
+		}
+		defer file.Close()
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// env lists the environment variable backing each setting
+func (c *Config) env() map[string]interface{} {
+	return map[string]interface{}{
+		"TWITTER_STORE":                   &c.Store,
+		"TWITTER_MONGO_URI":               &c.Mongo.URI,
+		"TWITTER_MONGO_DATABASE":          &c.Mongo.Database,
+		"TWITTER_MONGO_USERS":             &c.Mongo.Collections.Users,
+		"TWITTER_MONGO_TWEETS":            &c.Mongo.Collections.Tweets,
+		"TWITTER_MONGO_SESSIONS":          &c.Mongo.Collections.Sessions,
+		"TWITTER_MONGO_FEEDS":             &c.Mongo.Collections.Feeds,
+		"TWITTER_MONGO_CELEBRITIES":       &c.Mongo.Collections.Celebrities,
+		"TWITTER_MONGO_LIKES":             &c.Mongo.Collections.Likes,
+		"TWITTER_MONGO_NOTIFICATIONS":     &c.Mongo.Collections.Notifications,
+		"TWITTER_MONGO_CONVERSATIONS":     &c.Mongo.Collections.Conversations,
+		"TWITTER_MONGO_MESSAGES":          &c.Mongo.Collections.Messages,
+		"TWITTER_MONGO_BLOCKS":            &c.Mongo.Collections.Blocks,
+		"TWITTER_MONGO_MUTES":             &c.Mongo.Collections.Mutes,
+		"TWITTER_MONGO_FOLLOWS":           &c.Mongo.Collections.Follows,
+		"TWITTER_MONGO_FOLLOW_REQUESTS":   &c.Mongo.Collections.Requests,
+		"TWITTER_MONGO_DELETIONS":         &c.Mongo.Collections.Deletions,
+		"TWITTER_MONGO_CONNECT_TIMEOUT":   &c.Mongo.ConnectTimeout,
+		"TWITTER_ADDR":                    &c.HTTP.Addr,
+		"TWITTER_TLS_CERT":                &c.HTTP.TLSCert,
+		"TWITTER_TLS_KEY":                 &c.HTTP.TLSKey,
+		"TWITTER_READ_TIMEOUT":            &c.HTTP.ReadTimeout,
+		"TWITTER_WRITE_TIMEOUT":           &c.HTTP.WriteTimeout,
+		"TWITTER_IDLE_TIMEOUT":            &c.HTTP.IdleTimeout,
+		"TWITTER_REQUEST_TIMEOUT":         &c.HTTP.RequestTimeout,
+		"TWITTER_SHUTDOWN_TIMEOUT":        &c.HTTP.ShutdownTimeout,
+		"TWITTER_BCRYPT_COST":             &c.BcryptCost,
+		"TWITTER_TIMELINE":                &c.Timeline,
+		"TWITTER_FANOUT_WORKERS":          &c.Fanout.Workers,
+		"TWITTER_FANOUT_THRESHOLD":        &c.Fanout.Threshold,
+		"TWITTER_FANOUT_CAPACITY":         &c.Fanout.Capacity,
+		"TWITTER_PASSWORD_MIN_LENGTH":     &c.Password.MinLength,
+		"TWITTER_PASSWORD_REQUIRE_SYMBOL": &c.Password.RequireSymbol,
+		"TWITTER_PASSWORD_BLOCKLIST":      &c.Password.Blocklist,
+		"TWITTER_TWEET_MAX_LENGTH":        &c.Tweet.MaxLength,
+		"TWITTER_TWEET_URL_LENGTH":        &c.Tweet.URLLength,
+		"TWITTER_TRENDS_BUCKET":           &c.Trends.Bucket,
+		"TWITTER_TRENDS_BASELINE":         &c.Trends.Baseline,
+		"TWITTER_TRENDS_INTERVAL":         &c.Trends.Interval,
+		"TWITTER_TRENDS_SIZE":             &c.Trends.Size,
+		"TWITTER_TRENDS_MIN_COUNT":        &c.Trends.MinCount,
+		"TWITTER_STREAM_BUFFER":           &c.Stream.Buffer,
+		"TWITTER_STREAM_REPLAY":           &c.Stream.Replay,
+		"TWITTER_STREAM_RETAIN":           &c.Stream.Retain,
+		"TWITTER_STREAM_POLICY":           &c.Stream.Policy,
+		"TWITTER_STREAM_HEARTBEAT":        &c.Stream.Heartbeat,
+		"TWITTER_STREAM_LIFETIME":         &c.Stream.Lifetime,
+		"TWITTER_DM_MAX_LENGTH":           &c.DM.MaxLength,
+		"TWITTER_DM_MAX_PARTICIPANTS":     &c.DM.MaxParticipants,
+		"TWITTER_DELETION_GRACE_PERIOD":   &c.Deletion.GracePeriod,
+		"TWITTER_DELETION_INTERVAL":       &c.Deletion.Interval,
+	}
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	for name, target := range c.env() {
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		var err error
+		switch v := target.(type) {
+		case *string:
+			*v = raw
+		case *int:
+			*v, err = strconv.Atoi(raw)
+		case *bool:
+			*v, err = strconv.ParseBool(raw)
+		case *Duration:
+			var d time.Duration
+			d, err = time.ParseDuration(raw)
+			*v = Duration(d)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports every setting that is missing or out of range
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Store == "mongo" || c.Store == "memory", "store must be mongo or memory, got %q", c.Store)
+	if c.Store == "mongo" {
+		check(c.Mongo.URI != "", "mongo.uri is required")
+		check(c.Mongo.Database != "", "mongo.database is required")
+		check(c.Mongo.ConnectTimeout > 0, "mongo.connect_timeout must be positive")
+		names := []string{c.Mongo.Collections.Users, c.Mongo.Collections.Tweets, c.Mongo.Collections.Sessions,
+			c.Mongo.Collections.Feeds, c.Mongo.Collections.Celebrities, c.Mongo.Collections.Likes,
+			c.Mongo.Collections.Notifications, c.Mongo.Collections.Conversations, c.Mongo.Collections.Messages,
+			c.Mongo.Collections.Blocks, c.Mongo.Collections.Mutes, c.Mongo.Collections.Follows, c.Mongo.Collections.Requests,
+			c.Mongo.Collections.Deletions}
+		seen := make(map[string]bool, len(names))
+		for _, name := range names {
+			check(name != "", "mongo.collections cannot contain empty names")
+			check(name == "" || !seen[name], "mongo.collections uses %q twice", name)
+			seen[name] = true
+		}
+	}
+	check(c.HTTP.Addr != "", "http.addr is required")
+	check((c.HTTP.TLSCert == "") == (c.HTTP.TLSKey == ""), "http.tls_cert and http.tls_key must be set together")
+	check(c.HTTP.ReadTimeout >= 0 && c.HTTP.WriteTimeout >= 0 && c.HTTP.IdleTimeout >= 0, "http timeouts cannot be negative")
+	check(c.HTTP.RequestTimeout > 0, "http.request_timeout must be positive")
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout must be positive")
+	check(c.BcryptCost >= bcrypt.MinCost && c.BcryptCost <= bcrypt.MaxCost, "bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(c.Timeline == "pull" || c.Timeline == "fanout", "timeline must be pull or fanout, got %q", c.Timeline)
+	check(c.Fanout.Workers > 0, "fanout.workers must be positive")
+	check(c.Fanout.Capacity > 0, "fanout.capacity must be positive")
+	check(c.Fanout.Threshold >= 0, "fanout.threshold cannot be negative")
+	check(c.Password.MinLength > 0, "password.min_length must be positive")
+	check(c.Tweet.MaxLength > 0, "tweet.max_length must be positive")
+	check(c.Tweet.URLLength > 0 && c.Tweet.URLLength <= c.Tweet.MaxLength, "tweet.url_length must be positive and fit in tweet.max_length")
+	check(c.Trends.Bucket > 0 && c.Trends.Bucket <= Duration(time.Hour), "trends.bucket must be positive and at most 1h")
+	check(c.Trends.Baseline > Duration(24*time.Hour), "trends.baseline must be longer than the 24h window")
+	check(c.Trends.Interval > 0, "trends.interval must be positive")
+	check(c.Trends.Size > 0, "trends.size must be positive")
+	check(c.Trends.MinCount > 0, "trends.min_count must be positive")
+	check(c.Stream.Buffer > 0, "stream.buffer must be positive")
+	check(c.Stream.Replay > 0, "stream.replay must be positive")
+	check(c.Stream.Retain > 0, "stream.retain must be positive")
+	check(c.Stream.Policy == "disconnect" || c.Stream.Policy == "drop", "stream.policy must be disconnect or drop, got %q", c.Stream.Policy)
+	check(c.Stream.Heartbeat > 0, "stream.heartbeat must be positive")
+	check(c.DM.MaxLength > 0, "dm.max_length must be positive")
+	check(c.DM.MaxParticipants >= 2, "dm.max_participants must be at least 2")
+	check(c.Deletion.GracePeriod >= 0, "deletion.grace_period cannot be negative")
+	check(c.Deletion.Interval > 0, "deletion.interval must be positive")
+	if c.HTTP.WriteTimeout > 0 {
+		check(c.Stream.Lifetime > 0 && c.Stream.Lifetime < c.HTTP.WriteTimeout, "stream.lifetime must be positive and shorter than http.write_timeout")
+	} else {
+		check(c.Stream.Lifetime >= 0, "stream.lifetime cannot be negative")
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
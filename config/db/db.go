@@ -2,30 +2,25 @@ package db
 
 import (
 	"context"
-	"fmt"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
-	"sync"
 )
 
-var clientInstance *mongo.Client
-var clientInstanceError error
-var mongoOnce sync.Once
-
-func GetDBCollection() (*mongo.Collection, error) {
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+// Connect opens a client to the MongoDB deployment at uri and checks that it is reachable
+func Connect(ctx context.Context, uri string) (*mongo.Client, error) {
+	clientOptions := options.Client().ApplyURI(uri)
+	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	// Check the connection
-	err = client.Ping(context.TODO(), nil)
+	err = client.Ping(ctx, nil)
 	if err != nil {
-		log.Fatal(err)
+		client.Disconnect(ctx)
+		return nil, err
 	}
-	fmt.Println("Connected to MongoDB!")
-	collection := client.Database("GoLogin").Collection("users")
-	return collection, nil
+	log.Printf("connected to MongoDB")
+	return client, nil
 }
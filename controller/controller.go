@@ -2,630 +2,837 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	guuid "github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
-	"io/ioutil"
+	"golang.org/x/text/unicode/norm"
 	"log"
-	"math/rand"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
-	"twitter-feed/config/db"
+	"twitter-feed/entities"
+	"twitter-feed/fanout"
 	"twitter-feed/model"
+	"twitter-feed/purge"
+	"twitter-feed/store"
+	"twitter-feed/stream"
+	"twitter-feed/trends"
+	"twitter-feed/validation"
 )
 
-var collection *mongo.Collection
+// Server serves the API's handlers on top of the injected store
+type Server struct {
+	store  store.Store
+	fanout *fanout.Service
+	policy validation.Policy
+	cost   int
+	// tweetLimit caps the weighted length of new tweets
+	tweetLimit validation.TweetLimit
+	trends     *trends.Service
+	stream     *stream.Hub
+	streamer   *streamer
+	dmLimits   validation.DMLimits
+	purge      *purge.Service
+	// grace is how long a deleted account can still be restored by logging in
+	grace time.Duration
+}
 
-// Starts the MongoDB database
-func init() {
-	var err error
-	collection, err = db.GetDBCollection()
-	if err != nil {
-		log.Fatal(err)
+// Option configures optional parts of a Server
+type Option func(*Server)
+
+// WithFanout makes the Server materialize home timelines on write through the given service
+// instead of querying every followed account on read
+func WithFanout(f *fanout.Service) Option {
+	return func(s *Server) {
+		s.fanout = f
+	}
+}
+
+// WithPasswordPolicy replaces validation.DefaultPolicy as the rules new passwords must follow
+func WithPasswordPolicy(policy validation.Policy) Option {
+	return func(s *Server) {
+		s.policy = policy
+	}
+}
+
+// WithBcryptCost sets the work factor used to hash new passwords
+func WithBcryptCost(cost int) Option {
+	return func(s *Server) {
+		s.cost = cost
+	}
+}
+
+// WithTweetLimit replaces validation.DefaultTweetLimit as the length new tweets must keep to
+func WithTweetLimit(limit validation.TweetLimit) Option {
+	return func(s *Server) {
+		s.tweetLimit = limit
+	}
+}
+
+// WithDMLimits replaces validation.DefaultDMLimits as the size direct messages and conversations
+// must keep to
+func WithDMLimits(limits validation.DMLimits) Option {
+	return func(s *Server) {
+		s.dmLimits = limits
+	}
+}
+
+// WithTrends feeds new tweets to the trends service and serves its trends
+func WithTrends(t *trends.Service) Option {
+	return func(s *Server) {
+		s.trends = t
 	}
 }
 
-// RegisterHandler Registers a new user provided that the username is unique and password is valid
-// Requires: username, firstname, lastname, password
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
+// WithStream pushes new tweets and notifications to the clients connected to the hub
+func WithStream(h *stream.Hub) Option {
+	return func(s *Server) {
+		s.stream = h
+	}
+}
+
+// WithDeletion purges deleted accounts through the given service once grace is over; logging in
+// before then restores the account
+func WithDeletion(p *purge.Service, grace time.Duration) Option {
+	return func(s *Server) {
+		s.purge = p
+		s.grace = grace
+	}
+}
+
+// NewServer returns a Server backed by the given store
+func NewServer(st store.Store, opts ...Option) *Server {
+	s := &Server{store: st, policy: validation.DefaultPolicy, cost: bcrypt.DefaultCost, tweetLimit: validation.DefaultTweetLimit,
+		dmLimits: validation.DefaultDMLimits}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.stream != nil {
+		s.startStreaming()
+	}
+	return s
+}
+
+// Close stops the Server's background work, waiting for the new tweets still queued for
+// streaming to be pushed or for ctx to expire
+func (s *Server) Close(ctx context.Context) error {
+	if s.streamer == nil {
+		return nil
+	}
+	return s.stopStreaming(ctx)
+}
+
+// RegisterHandler Registers a new user provided that the username is unique and every field is valid
+// Requires: username, firstname, lastname, password; optional bio
+// Handled edges: Every invalid field is reported at once, and usernames differing only in case count as taken
+func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
+	var user model.Request
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	errs := s.policy.Registration(validation.Registration{
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Password:  user.Password,
+		Bio:       user.Bio,
+	})
+	if errs != nil {
+		validationError(w, r, errs)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), s.cost)
 	if err != nil {
-		log.Fatal(err)
+		internalError(w, r, "Error while hashing password, please try again", err)
+		return
+	}
+	err = s.store.CreateUser(r.Context(), model.User{
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Password:  string(hash),
+		Bio:       user.Bio,
+	})
+	if err == store.ErrDuplicate {
+		writeError(w, r, http.StatusConflict, codeUsernameTaken, "Username already exists, please try another :(", nil)
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
 	if err != nil {
-		if err.Error() == "mongo: no documents in result" {
-			if len(user.Password) < 8 || !strings.ContainsAny(user.Password, "1 | 2 | 3 | 4 | 5 | 6 | 7 | 8 | 9 } 0") {
-				res.Error = "Passwords must be longer than 8 characters and contain at least one number and letter."
-				json.NewEncoder(w).Encode(res)
-				return
-			}
-			hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 5)
-			if err != nil {
-				res.Error = "Error while hashing password, please try again"
-				json.NewEncoder(w).Encode(res)
-				return
-			}
-			user.Password = string(hash)
-			_, err = collection.InsertOne(context.TODO(), user)
-			if err != nil {
-				res.Error = "Error while creating user, please try again"
-				json.NewEncoder(w).Encode(res)
-				return
-			}
-			_, err = collection.UpdateOne(
-				context.TODO(),
-				bson.D{{"username", user.Username}},
-				bson.D{{"$set",
-					bson.D{
-						{"tweets", make([]string, 0)},
-						{"followings", make([]string, 0)},
-						{"followers", make([]string, 0)},
-					},
-				}},
-			)
-			res.Result = "Registration successful! Welcome to the team, @" + user.Username + "!"
-			json.NewEncoder(w).Encode(res)
-			return
-		}
-		res.Error = err.Error()
-		json.NewEncoder(w).Encode(res)
+		internalError(w, r, "Error while creating user, please try again", err)
 		return
 	}
-	res.Result = "Username already exists, please try another :("
-	json.NewEncoder(w).Encode(res)
+	res.Result = "Registration successful! Welcome to the team, @" + user.Username + "!"
+	writeJSON(w, http.StatusCreated, res)
 	return
 }
 
-// LoginHandler Logs the user in with credentials if not already logged in and informs user otherwise
+// LoginHandler Logs the user in with credentials and issues a bearer token for the new session
 // Requires: username, password
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
-	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
-	if err != nil {
-		log.Fatal(err)
+// Handled edges: Each login creates its own session, so the same user can be logged in from several devices, and logging in to an account deleted within its grace period restores it
+func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var user model.Request
+	if !decodeBody(w, r, &user) {
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
-	if err != nil {
-		res.Error = "Invalid username. Please try again!"
-		json.NewEncoder(w).Encode(res)
+	result, err := s.store.GetAccount(r.Context(), user.Username)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusUnauthorized, codeInvalidCredentials, "Invalid username. Please try again!", nil)
 		return
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(user.Password))
 	if err != nil {
-		res.Error = "Invalid password. Please try again!"
-		json.NewEncoder(w).Encode(res)
+		internalError(w, r, "Error while logging in, please try again", err)
 		return
 	}
-	if result.ActiveStatus {
-		res.Error = "User is already logged in!"
-		json.NewEncoder(w).Encode(res)
+	if result.PurgedAt != nil {
+		writeError(w, r, http.StatusGone, codeAccountDeleted, "This account was deleted and can no longer be restored.", nil)
 		return
 	}
-	result.Password = ""
-	_, err = collection.UpdateOne(
-		context.TODO(),
-		bson.D{{"username", user.Username}},
-		bson.D{{"$set",
-			bson.D{
-				{"active", true},
-			},
-		}},
-	)
+	err = bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(user.Password))
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, r, http.StatusUnauthorized, codeInvalidCredentials, "Invalid password. Please try again!", nil)
+		return
 	}
-	res.Result = "Login successful. Welcome, " + result.FirstName + " " + result.LastName + "!"
-	err = json.NewEncoder(w).Encode(res)
+	greeting := "Login successful. Welcome, " + result.FirstName + " " + result.LastName + "!"
+	if result.DeactivatedAt != nil {
+		// the purge may have started already, in which case there is nothing left to restore
+		err = s.store.CancelDeletion(r.Context(), result.Username)
+		if err == store.ErrNotFound {
+			writeError(w, r, http.StatusGone, codeAccountDeleted, "This account was deleted and can no longer be restored.", nil)
+			return
+		}
+		if err != nil {
+			internalError(w, r, "Error while restoring your account, please try again", err)
+			return
+		}
+		greeting = "Welcome back, " + result.FirstName + " " + result.LastName + "! Your account is restored."
+	}
+	token, session, err := s.createSession(result.Username, r)
 	if err != nil {
+		internalError(w, r, "Error while logging in, please try again", err)
 		return
 	}
+	writeJSON(w, http.StatusOK, model.LoginResult{
+		Result:    greeting,
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+	})
 }
 
-// LogoutHandler Logs the user out if not already logged out and informs user otherwise
-// Requires: username, password
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
+// LogoutHandler Logs the user out by revoking the bearer token used for this request
+// Requires: Authorization header
+// Handled edges: Sessions on the user's other devices stay logged in
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
-	if err != nil {
-		res.Error = "Invalid username"
-		json.NewEncoder(w).Encode(res)
+	session, ok := currentSession(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "You are not logged in -- there is no session to log out of.", nil)
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "User @" + user.Username + " is already logged out."
-		json.NewEncoder(w).Encode(res)
-	} else {
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", user.Username}},
-			bson.D{{"$set",
-				bson.D{
-					{"active", false},
-				},
-			}},
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
-		res.Result = "Logout successful! See you soon, " + result.FirstName + " " + result.LastName + "!"
-		json.NewEncoder(w).Encode(res)
+	err := s.store.DeleteSession(r.Context(), session.ID)
+	if err != nil && err != store.ErrNotFound {
+		internalError(w, r, "Error while logging out, please try again", err)
+		return
 	}
+	result, _ := s.store.GetUser(r.Context(), session.Username)
+	res.Result = "Logout successful! See you soon, " + result.FirstName + " " + result.LastName + "!"
+	writeJSON(w, http.StatusOK, res)
 	return
 }
 
-// FollowHandler Follows the desired user by adding their username to your "followings" and your username to their "followers"
-// Requires: username, to-follow
-// Handled edges: User should be logged in to follow others, and the username to follow should exist as a user in the DDB
-func FollowHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
+// FollowHandler Follows the desired user by recording a follow edge from you to them
+// Requires: Authorization header, to-follow
+// Handled edges: User should be logged in to follow others, the username to follow should exist as a user in the DDB, neither side may block the other, and following a protected account only requests it
+func (s *Server) FollowHandler(w http.ResponseWriter, r *http.Request) {
 	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
-	if err != nil {
-		log.Fatal(err)
+	var user model.Request
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before trying to follow users.")
+	if !ok {
+		return
+	}
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	target, err := s.store.GetUser(r.Context(), user.Input)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "Cannot follow this user; The provided username is not a real user.", nil)
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
 	if err != nil {
-		res.Error = "Invalid username"
-		log.Fatal(err)
-		json.NewEncoder(w).Encode(res)
+		internalError(w, r, "Error while following user, please try again", err)
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "You are not logged in -- Please authenticate before trying to follow users."
-		json.NewEncoder(w).Encode(res)
-	} else {
-		if result.Followings == nil {
-			_, err = collection.UpdateOne(
-				context.TODO(),
-				bson.D{{"username", result.Username}},
-				bson.D{{"$set",
-					bson.D{
-						{"followings", make([]string, 0)},
-						{"followers", make([]string, 0)},
-					},
-				}},
-			)
-		}
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", result.Username}},
-			bson.D{{"$addToSet",
-				bson.D{
-					{"followings", user.Input},
-				},
-			}},
-		)
-		err = collection.FindOne(context.TODO(), bson.D{{"username", user.Input}}).Decode(&result)
+	v, ok := s.requestViewer(w, r)
+	if !ok || !v.checkBlock(w, r, user.Input, "follow them") {
+		return
+	}
+	if target.Protected && target.Username != result.Username {
+		following, err := s.store.Follows(r.Context(), result.Username, target.Username)
 		if err != nil {
-			res.Error = "Cannot follow this user; The provided username is not a real user."
-			json.NewEncoder(w).Encode(res)
+			internalError(w, r, "Error while following user, please try again", err)
 			return
 		}
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", user.Input}},
-			bson.D{{"$addToSet",
-				bson.D{
-					{"followers", user.Username},
-				},
-			}},
-		)
-		if err != nil {
-			log.Fatal(err)
+		if !following {
+			s.requestFollow(w, r, result.Username, target.Username)
+			return
 		}
-		res.Result = "Successfully followed new user. Your new friend is @" + user.Input + "!"
-		json.NewEncoder(w).Encode(res)
 	}
+	err = s.addFollow(r.Context(), result.Username, user.Input)
+	if err != nil && err != store.ErrDuplicate {
+		internalError(w, r, "Error while following user, please try again", err)
+		return
+	}
+	if err == nil {
+		s.notify(r.Context(), model.Notification{Recipient: user.Input, Kind: model.NotifyFollow, Actor: result.Username})
+	}
+	res.Result = "Successfully followed new user. Your new friend is @" + user.Input + "!"
+	writeJSON(w, http.StatusOK, res)
 	return
 }
 
-// UnfollowHandler Unfollows the desired user by removing their username from your "followings" and your username from their "followers"
-// Requires: username, to-follow
-// Handled edges: User should be logged in to unfollow others, and the username to unfollow should be someone you're actually following
-func UnfollowHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
+// UnfollowHandler Unfollows the desired user by removing the follow edge from you to them
+// Requires: Authorization header, to-follow
+// Handled edges: User should be logged in to unfollow others, the username to unfollow should be someone you're actually following, and unfollowing a protected account you only asked to follow cancels the request
+func (s *Server) UnfollowHandler(w http.ResponseWriter, r *http.Request) {
 	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
-	if err != nil {
-		log.Fatal(err)
+	var user model.Request
+	result, ok := s.requireUser(w, r, "User is not logged in -- please authenticate before unfollowing")
+	if !ok {
+		return
+	}
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	err := s.store.DeleteFollowRequest(r.Context(), result.Username, user.Input)
+	if err == nil {
+		res.Result = "Your request to follow @" + user.Input + " is cancelled."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != store.ErrNotFound {
+		internalError(w, r, "Error while unfollowing user, please try again", err)
+		return
+	}
+	_, err = s.store.GetUser(r.Context(), user.Input)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "Failed to unfollow @"+user.Input+", as you are were never actually following them in the first place.", nil)
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
 	if err != nil {
-		res.Error = "Invalid username"
-		log.Fatal(err)
-		json.NewEncoder(w).Encode(res)
+		internalError(w, r, "Error while unfollowing user, please try again", err)
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "User is not logged in -- please authenticate before unfollowing"
-		json.NewEncoder(w).Encode(res)
-	} else {
-		if result.Followings == nil {
-			res.Error = "No one to unfollow -- you are not currently following anyone"
-		}
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", user.Username}},
-			bson.D{{"$pull",
-				bson.D{
-					{"followings", user.Input},
-				},
-			}},
-		)
-		err = collection.FindOne(context.TODO(), bson.D{{"username", user.Input}}).Decode(&result)
-		if err != nil {
-			res.Error = "Failed to unfollow @" + user.Input + ", as you are were never actually following them in the first place."
-			json.NewEncoder(w).Encode(res)
-			return
-		}
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", user.Input}},
-			bson.D{{"$pull",
-				bson.D{
-					{"followers", user.Username},
-				},
-			}},
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
-		res.Result = "Successfully unfollowed user @" + user.Input + ". Bye!"
-		json.NewEncoder(w).Encode(res)
+	err = s.store.Unfollow(r.Context(), result.Username, user.Input)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusConflict, codeConflict, "Nothing to unfollow -- you are not currently following @"+user.Input, nil)
+		return
 	}
+	if err != nil {
+		internalError(w, r, "Error while unfollowing user, please try again", err)
+		return
+	}
+	res.Result = "Successfully unfollowed user @" + user.Input + ". Bye!"
+	writeJSON(w, http.StatusOK, res)
 	return
 }
 
 // TweetHandler Tweets the input text to your profile, where it is saved in chronological order
-// Requires: username, new-tweet
+// Requires: Authorization header, new-tweet
 // Handled edges: User should be logged in to tweet, and the tweet should not only contain whitespace
-func TweetHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
+func (s *Server) TweetHandler(w http.ResponseWriter, r *http.Request) {
 	var res model.ResponseResult
-	var user model.User
+	var user model.Request
 	var tweet model.Tweet
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
-	if err != nil {
-		log.Fatal(err)
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before tweeting!")
+	if !ok {
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
-	if err != nil {
-		res.Error = "Invalid username"
-		log.Fatal(err)
-		json.NewEncoder(w).Encode(res)
+	if !decodeBody(w, r, &user) {
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "You are not logged in -- Please authenticate before tweeting!"
-		json.NewEncoder(w).Encode(res)
-	} else {
-		if result.TweetIDs == nil {
-			_, err = collection.UpdateOne(
-				context.TODO(),
-				bson.D{{"username", result.Username}},
-				bson.D{{"$set",
-					bson.D{
-						{"tweetids", make([]string, 0)},
-					},
-				}},
-			)
-		}
-		if strings.TrimSpace(user.Input) == "" {
-			res.Error = "Aren't you going to say anything in your Tweet? Write something!"
-			json.NewEncoder(w).Encode(res)
-			return
-		}
-		id := guuid.New()
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", result.Username}},
-			bson.D{{"$addToSet",
-				bson.D{
-					{"tweetids", id},
-				},
-			}},
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
-		tweet.ID = id
-		tweet.Text = user.Input
-		tweet.Date = time.Now().Local().Format("2006-01-02")
-		tweet.Time = time.Now().Local().Format("15:04:05")
-		_, err = collection.InsertOne(context.TODO(), tweet)
-		if err != nil {
-			res.Error = "Error while creating tweet, please try again"
-			json.NewEncoder(w).Encode(res)
-			return
-		}
-		res.Result = "Successfully tweeted at " + string(time.Now().Format("01-02-2006 15:04:05"))
-		json.NewEncoder(w).Encode(res)
+	if strings.TrimSpace(user.Input) == "" {
+		writeError(w, r, http.StatusUnprocessableEntity, codeValidation, "Aren't you going to say anything in your Tweet? Write something!", nil)
+		return
+	}
+	tweet.Text, tweet.Entities, ok = s.tweetText(w, r, user.Input)
+	if !ok {
+		return
+	}
+	tweet.ID = guuid.New()
+	tweet.Author = result.Username
+	tweet.CreatedAt = time.Now()
+	tweet.ConversationID = tweet.ID
+	err := s.publishTweet(r.Context(), tweet)
+	if err != nil {
+		internalError(w, r, "Error while creating tweet, please try again", err)
+		return
 	}
+	res.Result = "Successfully tweeted at " + tweet.CreatedAt.Format("01-02-2006 15:04:05") + " (id " + tweet.ID.String() + ")"
+	writeJSON(w, http.StatusCreated, res)
 	return
 }
 
 // ProfileHandler Displays the profile of any user in the DDB provided that they exist
 // Requires: {username} in request
-func ProfileHandler(w http.ResponseWriter, r *http.Request) {
-	var res model.ResponseResult
-	w.Header().Set("content-type", "application/json")
+// Handled edges: Only the public profile is shown, unless the caller is logged in as that user, and accounts that blocked the caller are not shown
+func (s *Server) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	var user model.User
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
+	result, err := s.store.GetUser(r.Context(), params["username"])
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "This user does not exist in Twitter.", nil)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading profile, please try again", err)
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	if v.blockedBy[result.Username] {
+		writeError(w, r, http.StatusForbidden, codeBlocked, "@"+result.Username+" has blocked you -- you cannot see their profile.", nil)
+		return
+	}
+	profile, err := s.publicProfile(r, result)
 	if err != nil {
-		log.Fatal(err)
+		internalError(w, r, "Error while loading profile, please try again", err)
+		return
+	}
+	session, ok := currentSession(r)
+	if !ok || session.Username != result.Username {
+		writeJSON(w, http.StatusOK, profile)
+		return
 	}
-	var result model.User
-	err = collection.FindOne(context.TODO(), bson.D{{"username", params["username"]}}).Decode(&result)
-	if result.Username == "" {
-		res.Error = "This user does not exist in Twitter."
-		json.NewEncoder(w).Encode(res)
+	sessions, err := s.store.UserSessions(r.Context(), result.Username)
+	if err != nil {
+		internalError(w, r, "Error while loading profile, please try again", err)
 		return
 	}
-	json.NewEncoder(w).Encode(result)
+	self := model.SelfProfile{PublicProfile: profile, Sessions: make([]model.SessionInfo, 0, len(sessions))}
+	for _, other := range sessions {
+		self.Sessions = append(self.Sessions, model.SessionInfo{
+			UserAgent: other.UserAgent,
+			CreatedAt: other.CreatedAt,
+			ExpiresAt: other.ExpiresAt,
+			Current:   other.ID == session.ID,
+		})
+	}
+	writeJSON(w, http.StatusOK, self)
 	return
 }
 
-// TimelineHandler Displays the profile of any user in the DDB provided that they exist
-// Requires: {username} in request
-func TimelineHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
-	var res model.ResponseResult
-	var timeline model.Timeline
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
-	if err != nil {
-		log.Fatal(err)
+// TimelineHandler Displays the tweets of everyone the logged in user follows, newest first
+// Requires: Authorization header, optional limit and cursor query parameters
+// Handled edges: User should be logged in to view their feed, and the cursor must come from a previous page
+func (s *Server) TimelineHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before viewing feed!")
+	if !ok {
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	page, limit, err := parsePage(r)
 	if err != nil {
-		res.Error = "Invalid username"
-		log.Fatal(err)
-		json.NewEncoder(w).Encode(res)
+		pageError(w, r, err)
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "You are not logged in -- Please authenticate before viewing feed!"
-		json.NewEncoder(w).Encode(res)
+	var tweets []model.Tweet
+	if s.fanout != nil {
+		tweets, err = s.fanout.Timeline(r.Context(), result.Username, page)
 	} else {
-		var allTweets = make([]model.TweetResp, 0)
-		var resp model.TweetResp
-		var tweet model.Tweet
-		var current model.User
-		for i := 0; i < len(result.Followings); i++ { // for everyone i'm following...
-			err = collection.FindOne(context.TODO(), bson.D{{"username", result.Followings[i]}}).Decode(&current)
-			if len(current.TweetIDs) == 0 {
-				continue
-			}
-			for j := 0; j < len(current.TweetIDs); j++ { // look through all of their tweets...
-				collection.FindOne(context.TODO(), bson.D{{"_id", current.TweetIDs[j]}}).Decode(&tweet)
-				resp.Time = tweet.Time
-				resp.Text = tweet.Text
-				resp.Date = tweet.Date
-				resp.User = current.Username
-				allTweets = append(allTweets, resp) // add them to my timeline...
-			}
-		}
-		shuffled := make([]model.TweetResp, len(allTweets))
-		perm := rand.Perm(len(allTweets))
-		for i, v := range perm {
-			shuffled[v] = allTweets[i]
-		}
-		timeline.Tweets = shuffled
-		json.NewEncoder(w).Encode(timeline) // ...and show them to me randomly.
+		tweets, err = s.store.HomeTimeline(r.Context(), result.Username, page)
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading your feed, please try again", err)
+		return
+	}
+	timeline, err := s.tweetPage(r.Context(), v, tweets, page, limit)
+	if err != nil {
+		internalError(w, r, "Error while loading tweets, please try again", err)
+		return
 	}
+	writeJSON(w, http.StatusOK, timeline)
 	return
 }
 
-// DeleteHandler Deletes the user's account, and any traces of them from the accounts of other users as well
-// Requires: username
-// Handled edges: User should be logged in to delete account
-func DeleteHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
-	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
+// UserTweetsHandler Lists the tweets posted by any user in the DDB, newest first
+// Requires: {username} in request, optional limit and cursor query parameters
+// Handled edges: The user should exist, neither side of a block sees the other's tweets, protected accounts only show them to approved followers, and muted accounts still show here
+func (s *Server) UserTweetsHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	page, limit, err := parsePage(r)
 	if err != nil {
-		log.Fatal(err)
+		pageError(w, r, err)
+		return
+	}
+	owner, err := s.store.GetUser(r.Context(), params["username"])
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "This user does not exist in Twitter.", nil)
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
 	if err != nil {
-		res.Error = "Invalid username"
-		json.NewEncoder(w).Encode(res)
+		internalError(w, r, "Error while loading tweets, please try again", err)
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "You are not logged in -- Please authenticate before deleting your account!"
-		json.NewEncoder(w).Encode(res)
-	} else {
-		var removal model.User
-		for i := 0; i < len(result.Followers); i++ { // for everyone following me...
-			collection.FindOne(context.TODO(), bson.D{{"username", result.Followers[i]}}).Decode(&removal)
-			for j := 0; j < len(removal.Followings); j++ { // search for me in each of the people they follow...
-				if removal.Followings[j] == result.Username {
-					removal.Followings = append(removal.Followings[:j], removal.Followings[j+1:]...) // ...and delete myself
-					_, err = collection.UpdateOne(
-						context.TODO(),
-						bson.D{{"username", removal.Username}},
-						bson.D{{"$set",
-							bson.D{
-								{"followings", removal.Followings},
-							},
-						}},
-					)
-					break
-				}
-			}
-		}
-		for i := 0; i < len(result.Followings); i++ { // for everyone i'm a follower of...
-			collection.FindOne(context.TODO(), bson.D{{"username", result.Followings[i]}}).Decode(&removal)
-			for j := 0; j < len(removal.Followers); j++ { // search for me in each of their followers...
-				if removal.Followers[j] == result.Username {
-					removal.Followers = append(removal.Followers[:j], removal.Followers[j+1:]...) // ...and delete myself
-					_, err = collection.UpdateOne(
-						context.TODO(),
-						bson.D{{"username", removal.Username}},
-						bson.D{{"$set",
-							bson.D{
-								{"followers", removal.Followers},
-							},
-						}},
-					)
-					break
-				}
-			}
-		}
-		_, err := collection.DeleteOne(context.TODO(), bson.M{"username": result.Username})
-		if err != nil {
-			res.Error = "Account deletion failure, please try again later."
-			json.NewEncoder(w).Encode(res)
-			return
-		}
-
-		res.Result = "You've successfully deleted your account, " + result.FirstName + " " + result.LastName + "!"
-		json.NewEncoder(w).Encode(res)
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, owner.Username, "see their tweets") {
+		return
 	}
+	// the muted account's own tweets are what is being asked for; retweets it makes of
+	// muted accounts stay hidden
+	delete(v.muted, owner.Username)
+	tweets, err := s.store.TweetsByAuthors(r.Context(), []string{owner.Username}, page)
+	if err != nil {
+		internalError(w, r, "Error while loading tweets, please try again", err)
+		return
+	}
+	timeline, err := s.tweetPage(r.Context(), v, tweets, page, limit)
+	if err != nil {
+		internalError(w, r, "Error while loading tweets, please try again", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, timeline)
 	return
 }
 
-// UntweetHandler Deletes the specified tweet in chronology for the specified user
-// Requires: username, tweet number
-// Handled edges: User should be logged in to delete tweets, and tweet number must exist
-func UntweetHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
+// DeleteHandler Deactivates the user's account right away and schedules everything they left behind to be purged
+// Requires: Authorization header, password
+// Handled edges: User should be logged in and confirm their password to delete account, every session of the account is revoked, and logging in again before the grace period is over restores it
+func (s *Server) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
+	var user model.Request
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before deleting your account!")
+	if !ok {
+		return
+	}
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(user.Password))
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, r, http.StatusUnauthorized, codeInvalidCredentials, "Invalid password -- Please confirm your password to delete your account.", nil)
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
+	now := time.Now()
+	deletion := model.Deletion{
+		ID:          guuid.New(),
+		Username:    result.Username,
+		RequestedAt: now,
+		PurgeAt:     now.Add(s.grace),
+		Stage:       model.DeletionPending,
+	}
+	err = s.store.RequestDeletion(r.Context(), deletion)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "Your account is already deleted.", nil)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Account deletion failure, please try again later.", err)
+		return
+	}
+	err = s.store.DeleteUserSessions(r.Context(), result.Username)
 	if err != nil {
-		res.Error = "Invalid username"
-		json.NewEncoder(w).Encode(res)
+		// logging in restores the account, after which deleting it again revokes every session
+		internalError(w, r, "Your account is deleted, but logging you out everywhere failed -- Please log in and delete it again.", err)
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "You are not logged in -- Please authenticate before deleting tweets!"
-		json.NewEncoder(w).Encode(res)
+	if s.grace <= 0 {
+		if s.purge != nil {
+			s.purge.Wake()
+		}
+		res.Result = "You've successfully deleted your account, " + result.FirstName + " " + result.LastName + "! Everything you posted will be removed shortly."
 	} else {
+		res.Result = "You've successfully deleted your account, " + result.FirstName + " " + result.LastName + "! It will be removed for good on " +
+			deletion.PurgeAt.UTC().Format("January 2, 2006") + " -- log in before then to keep it."
+	}
+	writeJSON(w, http.StatusAccepted, res)
+	return
+}
+
+// UntweetHandler Deletes one of the user's tweets, given either its ID or its number in chronology
+// Requires: Authorization header, tweet id or tweet number
+// Handled edges: User should be logged in to delete tweets, and the tweet must exist and be their own
+func (s *Server) UntweetHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	var user model.Request
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before deleting tweets!")
+	if !ok {
+		return
+	}
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	id, err := guuid.Parse(user.Input)
+	if err != nil {
+		tweets, err := s.store.TweetsByAuthor(r.Context(), result.Username)
+		if err != nil {
+			internalError(w, r, "Error while deleting tweet, please try again", err)
+			return
+		}
 		i, _ := strconv.Atoi(user.Input)
 		var index = i - 1
-		id := result.TweetIDs[index]
-		result.TweetIDs = append(result.TweetIDs[:index], result.TweetIDs[index+1:]...) //
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", result.Username}},
-			bson.D{{"$set",
-				bson.D{
-					{"tweetids", result.TweetIDs},
-				},
-			}},
-		)
-		_, err := collection.DeleteOne(context.TODO(), bson.M{"id": id})
-		if err != nil {
-			fmt.Printf("remove failure %v\n", err)
-			os.Exit(1)
+		if index < 0 || index >= len(tweets) {
+			writeError(w, r, http.StatusNotFound, codeTweetNotFound, "There is no tweet number "+user.Input+" on your profile.", nil)
+			return
 		}
-		res.Result = "You've successfully deleted your tweet!"
-		json.NewEncoder(w).Encode(res)
+		id = tweets[index].ID
+	}
+	err = s.store.DeleteTweet(r.Context(), result.Username, id)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeTweetNotFound, "There is no tweet "+user.Input+" on your profile.", nil)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while deleting tweet, please try again", err)
+		return
 	}
+	res.Result = "You've successfully deleted your tweet!"
+	writeJSON(w, http.StatusOK, res)
 	return
 }
 
 // UpdateHandler Allows the user to change their password.
-// Requires: username, password
-func UpdateHandler(w http.ResponseWriter, r *http.Request) {
-	var result model.User
+// Requires: Authorization header, new password as input
+func (s *Server) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	var res model.ResponseResult
-	var user model.User
-	w.Header().Set("Content-Type", "application/json")
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, &user)
+	var user model.Request
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before changing your password!")
+	if !ok {
+		return
+	}
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	var errs validation.Errors
+	s.policy.Password(&errs, "input", user.Input, result.Username)
+	if errs != nil {
+		validationError(w, r, errs)
+		return
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(user.Input))
+	if err == nil {
+		writeError(w, r, http.StatusUnprocessableEntity, codeValidation, "That's the same password! Input a new one to change it.", nil)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Input), s.cost)
 	if err != nil {
-		log.Fatal(err)
+		internalError(w, r, "Error while hashing password, please try again", err)
+		return
 	}
-	err = collection.FindOne(context.TODO(), bson.D{{"username", user.Username}}).Decode(&result)
+	err = s.store.UpdatePassword(r.Context(), result.Username, string(hash))
 	if err != nil {
-		res.Error = "Invalid username"
-		json.NewEncoder(w).Encode(res)
+		internalError(w, r, "Error while updating password, please try again", err)
 		return
 	}
-	if !result.ActiveStatus {
-		res.Error = "You are not logged in -- Please authenticate before changing your password!"
-		json.NewEncoder(w).Encode(res)
-	} else {
-		if len(user.Input) < 8 || !strings.ContainsAny(user.Input, "1 | 2 | 3 | 4 | 5 | 6 | 7 | 8 | 9 } 0") {
-			res.Error = "Passwords must be longer than 8 characters and contain at least one number and letter."
-			json.NewEncoder(w).Encode(res)
-			return
+	res.Result = "Password update successful! Don't forget your new combination!"
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// tweetText NFC-normalizes the text of a new tweet, checks its weighted length and parses its
+// entities, spelling each mention like the account it names. It answers with a 422 and returns
+// false when the tweet is too long or mentions an account that does not exist.
+func (s *Server) tweetText(w http.ResponseWriter, r *http.Request, input string) (string, model.Entities, bool) {
+	text := norm.NFC.String(input)
+	var errs validation.Errors
+	s.tweetLimit.Tweet(&errs, "input", text)
+	if errs != nil {
+		validationError(w, r, errs)
+		return text, model.Entities{}, false
+	}
+	parsed := entities.Parse(text)
+	if len(parsed.Mentions) == 0 {
+		return text, parsed, true
+	}
+	names := make([]string, 0, len(parsed.Mentions))
+	for _, mention := range parsed.Mentions {
+		names = append(names, mention.Text)
+	}
+	usernames, err := s.store.Usernames(r.Context(), names)
+	if err != nil {
+		internalError(w, r, "Error while checking mentions, please try again", err)
+		return text, parsed, false
+	}
+	reported := make(map[string]bool)
+	for i, mention := range parsed.Mentions {
+		username, ok := usernames[mention.Text]
+		if !ok {
+			if !reported[strings.ToLower(mention.Text)] {
+				errs = append(errs, validation.FieldError{Field: "input", Code: validation.CodeUnknownUser, Message: "@" + mention.Text + " does not exist in Twitter."})
+				reported[strings.ToLower(mention.Text)] = true
+			}
+			continue
 		}
-		hash, err := bcrypt.GenerateFromPassword([]byte(result.Input), 5)
+		parsed.Mentions[i].Text = username
+	}
+	if errs != nil {
+		validationError(w, r, errs)
+		return text, parsed, false
+	}
+	return text, parsed, true
+}
+
+// publishTweet stores a new tweet, notifies the people it involves and queues it for connected
+// followers, fan-out and trends. Failing to notify, push or queue it is only
+// logged, since the tweet itself was saved.
+func (s *Server) publishTweet(ctx context.Context, tweet model.Tweet) error {
+	err := s.store.CreateTweet(ctx, tweet)
+	if err != nil {
+		return err
+	}
+	s.notifyTweet(ctx, tweet)
+	s.queueTweet(ctx, tweet)
+	if s.fanout != nil {
+		err = s.fanout.TweetCreated(ctx, tweet)
 		if err != nil {
-			res.Error = "Error while hashing password, please try again"
-			json.NewEncoder(w).Encode(res)
-			return
+			log.Printf("fanout: queueing tweet %s: %v", tweet.ID, err)
 		}
-		err = bcrypt.CompareHashAndPassword(hash, []byte(user.Password))
-		if err == nil {
-			res.Error = "That's the same password! Input a new one to change it."
-			json.NewEncoder(w).Encode(res)
-			return
-		}
-		_, err = collection.UpdateOne(
-			context.TODO(),
-			bson.D{{"username", result.Username}},
-			bson.D{{"$set",
-				bson.D{
-					{"password", hash},
-				},
-			}},
-		)
+	}
+	if s.trends != nil {
+		err = s.trends.TweetCreated(tweet)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("trends: queueing tweet %s: %v", tweet.ID, err)
 		}
-		res.Result = "Password update successful! Don't forget your new combination!"
-		json.NewEncoder(w).Encode(res)
 	}
-	return
+	return nil
+}
+
+// tweetResp converts a stored tweet into its API representation
+func tweetResp(tweet model.Tweet) model.TweetResp {
+	return model.TweetResp{
+		ID:               tweet.ID,
+		User:             tweet.Author,
+		Date:             tweet.CreatedAt.Local().Format("2006-01-02"),
+		Time:             tweet.CreatedAt.Local().Format("15:04:05"),
+		Text:             tweet.Text,
+		CreatedAt:        tweet.CreatedAt,
+		InReplyToTweetID: tweet.InReplyToID,
+		InReplyToUser:    tweet.InReplyToUser,
+		ConversationID:   tweet.Conversation(),
+		RetweetCount:     tweet.RetweetCount,
+		QuoteCount:       tweet.QuoteCount,
+		LikeCount:        tweet.LikeCount,
+		QuotedTweetID:    tweet.QuoteOf,
+		Entities:         tweet.Entities,
+	}
+}
+
+// tweetPage builds the response for a page of tweets fetched with parsePage. The cursors are
+// taken before tweetResps folds duplicates and hidden tweets, so a page may hold fewer than
+// limit tweets.
+func (s *Server) tweetPage(ctx context.Context, v viewer, tweets []model.Tweet, page store.Page, limit int) (model.Timeline, error) {
+	var timeline model.Timeline
+	lo, hi, next, prev := pageCursors(len(tweets), page, limit, func(i int) store.Cursor {
+		return store.Cursor{CreatedAt: tweets[i].CreatedAt, ID: tweets[i].ID}
+	})
+	resps, err := s.tweetResps(ctx, v, tweets[lo:hi])
+	if err != nil {
+		return timeline, err
+	}
+	timeline.Tweets = resps
+	timeline.NextCursor = next
+	timeline.PrevCursor = prev
+	return timeline, nil
+}
+
+// tweetResps converts a newest-first listing for display. Retweets are shown as the tweet they
+// reshare, attributed to whoever retweeted it, and quoted tweets are embedded. A tweet listed
+// several times, itself or through retweets, is shown once at its newest position. Tweets the
+// viewer must not see are left out, and so are the tweets they quote.
+func (s *Server) tweetResps(ctx context.Context, v viewer, tweets []model.Tweet) ([]model.TweetResp, error) {
+	ids := make([]guuid.UUID, 0)
+	for _, tweet := range tweets {
+		if tweet.RetweetOf != nil {
+			ids = append(ids, *tweet.RetweetOf)
+		}
+	}
+	originals, err := s.store.GetTweets(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]string, 0, len(tweets)+len(originals))
+	for _, tweet := range tweets {
+		authors = append(authors, tweet.Author)
+	}
+	for _, original := range originals {
+		authors = append(authors, original.Author)
+	}
+	err = s.lookupAccounts(ctx, v, authors)
+	if err != nil {
+		return nil, err
+	}
+	shown := make([]model.Tweet, 0, len(tweets))
+	retweeters := make(map[guuid.UUID][]string)
+	for _, tweet := range tweets {
+		if v.hides(tweet) {
+			continue
+		}
+		if tweet.RetweetOf != nil {
+			original, ok := originals[*tweet.RetweetOf]
+			if !ok || v.hides(original) {
+				continue
+			}
+			retweeters[original.ID] = append(retweeters[original.ID], tweet.Author)
+			tweet = original
+		}
+		shown = append(shown, tweet)
+	}
+	ids = ids[:0]
+	for _, tweet := range shown {
+		if tweet.QuoteOf != nil {
+			ids = append(ids, *tweet.QuoteOf)
+		}
+	}
+	quoted, err := s.store.GetTweets(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	authors = authors[:0]
+	for _, q := range quoted {
+		authors = append(authors, q.Author)
+	}
+	err = s.lookupAccounts(ctx, v, authors)
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]model.TweetResp, 0, len(shown))
+	seen := make(map[guuid.UUID]bool, len(shown))
+	for _, tweet := range shown {
+		if seen[tweet.ID] {
+			continue
+		}
+		seen[tweet.ID] = true
+		resp := tweetResp(tweet)
+		resp.RetweetedBy = retweeters[tweet.ID]
+		if tweet.QuoteOf != nil {
+			if q, ok := quoted[*tweet.QuoteOf]; ok && !v.hides(q) {
+				embedded := tweetResp(q)
+				resp.QuotedTweet = &embedded
+			}
+		}
+		resps = append(resps, resp)
+	}
+	return resps, nil
+}
+
+// publicProfile converts a stored user into the profile anyone can see
+func (s *Server) publicProfile(r *http.Request, user model.User) (model.PublicProfile, error) {
+	tweets, err := s.store.CountTweets(r.Context(), user.Username)
+	if err != nil {
+		return model.PublicProfile{}, err
+	}
+	return model.PublicProfile{
+		Username:       user.Username,
+		FirstName:      user.FirstName,
+		LastName:       user.LastName,
+		Bio:            user.Bio,
+		FollowersCount: user.FollowersCount,
+		FollowingCount: user.FollowingCount,
+		TweetCount:     tweets,
+		Protected:      user.Protected,
+	}, nil
 }
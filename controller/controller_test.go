@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"twitter-feed/fanout"
+	"twitter-feed/model"
+	"twitter-feed/store"
+	"twitter-feed/store/storetest"
+	"twitter-feed/validation"
+)
+
+func TestRegister(t *testing.T) {
+	a := newAPI(t)
+	a.register("alice")
+	rec := a.do("POST", "/register", "", model.Request{Username: "Alice", FirstName: "A", LastName: "L", Password: testPassword})
+	a.expectError(rec, http.StatusConflict, codeUsernameTaken)
+	rec = a.do("POST", "/register", "", model.Request{Username: "bob", FirstName: "B", LastName: "L", Password: "1 | 2 | 3"})
+	a.expectError(rec, http.StatusUnprocessableEntity, codeValidation)
+	var invalid struct {
+		Details validation.Errors `json:"details"`
+	}
+	rec = a.do("POST", "/register", "", model.Request{Username: "b b", LastName: "L", Password: testPassword})
+	a.expect(rec, http.StatusUnprocessableEntity, &invalid)
+	if len(invalid.Details) != 2 || invalid.Details[0].Field != "username" || invalid.Details[1].Field != "firstname" {
+		t.Errorf("details = %+v, want the username and the first name", invalid.Details)
+	}
+	a.expectError(a.do("POST", "/register", "", nil), http.StatusBadRequest, codeInvalidJSON)
+
+	rec = a.do("GET", "/profile/alice", "", nil)
+	a.expect(rec, http.StatusOK, nil)
+	if strings.Contains(rec.Body.String(), "password") {
+		t.Errorf("profile leaks the password: %s", rec.Body.String())
+	}
+	a.expectError(a.do("GET", "/profile/bob", "", nil), http.StatusNotFound, codeUserNotFound)
+	a.expectError(a.do("GET", "/nowhere", "", nil), http.StatusNotFound, codeNotFound)
+	a.expectError(a.do("GET", "/register", "", nil), http.StatusMethodNotAllowed, codeMethodNotAllowed)
+}
+
+func TestTweet(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	a.expectError(a.do("POST", "/tweet", "", model.Request{Input: "hello"}), http.StatusUnauthorized, codeUnauthorized)
+	a.expectError(a.do("POST", "/tweet", alice, model.Request{Input: "  "}), http.StatusUnprocessableEntity, codeValidation)
+	first := a.tweet(alice, "first")
+	a.tweet(alice, "second")
+	texts, _ := a.timeline("/users/alice/tweets", "")
+	if !storetest.Equal(texts, []string{"second", "first"}) {
+		t.Errorf("alice's tweets = %v, want newest first", texts)
+	}
+
+	a.expectError(a.do("POST", "/untweet", bob, model.Request{Input: first.ID.String()}), http.StatusNotFound, codeTweetNotFound)
+	a.expect(a.do("POST", "/untweet", alice, model.Request{Input: first.ID.String()}), http.StatusOK, nil)
+	texts, _ = a.timeline("/users/alice/tweets", "")
+	if !storetest.Equal(texts, []string{"second"}) {
+		t.Errorf("alice's tweets after untweet = %v", texts)
+	}
+}
+
+func TestFanoutTimeline(t *testing.T) {
+	st := store.NewMemory()
+	f := fanout.New(st, fanout.DefaultOptions)
+	f.Start()
+	a := newAPIOver(t, st, WithFanout(f))
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	a.tweet(alice, "before the follow")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.tweet(alice, "after the follow")
+	// stopping waits for the backfill and the push to be done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := f.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts, _ := a.timeline("/timeline", bob)
+	if !storetest.Equal(texts, []string{"after the follow", "before the follow"}) {
+		t.Errorf("bob's timeline = %v", texts)
+	}
+}
+
+func TestLike(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	first := a.tweet(alice, "first")
+	second := a.tweet(alice, "second")
+	like := func(tweet model.Tweet) string { return "/tweets/" + tweet.ID.String() + "/like" }
+
+	a.expect(a.do("POST", like(first), bob, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", like(first), bob, nil), http.StatusOK, nil)
+	a.expect(a.do("POST", like(first), carol, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", like(second), bob, nil), http.StatusCreated, nil)
+	// liking a retweet likes the original
+	a.expect(a.do("POST", "/tweets/"+second.ID.String()+"/retweet", carol, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", like(a.latest(carol)), carol, nil), http.StatusCreated, nil)
+
+	var likes model.LikePage
+	a.expect(a.do("GET", "/tweets/"+first.ID.String()+"/likes?limit=1", "", nil), http.StatusOK, &likes)
+	if len(likes.Likes) != 1 || likes.Likes[0].Username != "carol" || likes.NextCursor == "" {
+		t.Fatalf("first page of likes = %+v, want carol with more to come", likes)
+	}
+	var more model.LikePage
+	a.expect(a.do("GET", "/tweets/"+first.ID.String()+"/likes?limit=1&cursor="+url.QueryEscape(likes.NextCursor), "", nil), http.StatusOK, &more)
+	if len(more.Likes) != 1 || more.Likes[0].Username != "bob" || more.NextCursor != "" {
+		t.Errorf("second page of likes = %+v, want bob and nothing more", more)
+	}
+
+	// the user's likes are listed by when they were given, with the like counts
+	texts, timeline := a.timeline("/users/bob/likes", "")
+	if !storetest.Equal(texts, []string{"second", "first"}) || timeline.Tweets[1].LikeCount != 2 || timeline.Tweets[0].LikeCount != 2 {
+		t.Errorf("bob's likes = %+v", timeline.Tweets)
+	}
+
+	a.expect(a.do("DELETE", like(first), bob, nil), http.StatusOK, nil)
+	a.expect(a.do("DELETE", like(first), bob, nil), http.StatusOK, nil)
+	a.expect(a.do("DELETE", like(second), alice, nil), http.StatusOK, nil)
+	texts, _ = a.timeline("/users/bob/likes", "")
+	if !storetest.Equal(texts, []string{"second"}) {
+		t.Errorf("bob's likes after unliking the first tweet = %v", texts)
+	}
+	texts, timeline = a.timeline("/users/alice/tweets", "")
+	if !storetest.Equal(texts, []string{"second", "first"}) || timeline.Tweets[0].LikeCount != 2 || timeline.Tweets[1].LikeCount != 1 {
+		t.Errorf("alice's tweets after the unlikes = %+v", timeline.Tweets)
+	}
+
+	a.expectError(a.do("GET", "/users/nobody/likes", "", nil), http.StatusNotFound, codeUserNotFound)
+	a.expectError(a.do("GET", "/tweets/nope/likes", "", nil), http.StatusNotFound, codeTweetNotFound)
+	a.expectError(a.do("POST", like(first), "", nil), http.StatusUnauthorized, codeUnauthorized)
+}
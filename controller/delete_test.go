@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/purge"
+	"twitter-feed/store"
+	"twitter-feed/store/storetest"
+)
+
+func TestDeleteAndRestore(t *testing.T) {
+	a := newAPI(t, WithDeletion(nil, 30*24*time.Hour))
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	tweet := a.tweet(alice, "hello from alice")
+	a.expect(a.do("POST", "/tweets/"+tweet.ID.String()+"/like", bob, nil), http.StatusCreated, nil)
+	other := a.tweet(bob, "from bob")
+	a.expect(a.do("POST", "/tweets/"+other.ID.String()+"/like", alice, nil), http.StatusCreated, nil)
+
+	a.expectError(a.do("POST", "/delete", "", model.Request{Password: testPassword}), http.StatusUnauthorized, codeUnauthorized)
+	a.expectError(a.do("POST", "/delete", alice, model.Request{Password: "wrong-password"}), http.StatusUnauthorized, codeInvalidCredentials)
+	a.expect(a.do("POST", "/delete", alice, model.Request{Password: testPassword}), http.StatusAccepted, nil)
+
+	// the account is hidden at once, and its sessions are gone
+	a.expectError(a.do("GET", "/timeline", alice, nil), http.StatusUnauthorized, codeUnauthorized)
+	a.expectError(a.do("GET", "/profile/alice", bob, nil), http.StatusNotFound, codeUserNotFound)
+	a.expectError(a.do("GET", "/users/alice/tweets", bob, nil), http.StatusNotFound, codeUserNotFound)
+	a.expectError(a.do("GET", "/tweets/"+tweet.ID.String()+"/thread", bob, nil), http.StatusNotFound, codeUserNotFound)
+	a.expectError(a.do("GET", "/tweets/"+tweet.ID.String()+"/likes", bob, nil), http.StatusNotFound, codeUserNotFound)
+	if texts, _ := a.timeline("/timeline", bob); len(texts) != 0 {
+		t.Errorf("bob's timeline = %v, want alice's tweet hidden", texts)
+	}
+	if texts, _ := a.timeline("/search/tweets?q=hello", bob); len(texts) != 0 {
+		t.Errorf("bob finds %v in search, want nothing", texts)
+	}
+	var likes model.LikePage
+	a.expect(a.do("GET", "/tweets/"+other.ID.String()+"/likes", bob, nil), http.StatusOK, &likes)
+	if len(likes.Likes) != 0 {
+		t.Errorf("likes of bob's tweet = %+v, want alice's hidden", likes.Likes)
+	}
+	var followers model.FollowPage
+	a.expect(a.do("GET", "/users/bob/following", bob, nil), http.StatusOK, &followers)
+	if len(followers.Users) != 0 {
+		t.Errorf("bob follows %+v, want alice hidden", followers.Users)
+	}
+
+	// logging in during the grace period restores everything
+	alice = a.login("alice")
+	a.expect(a.do("GET", "/profile/alice", bob, nil), http.StatusOK, nil)
+	if texts, _ := a.timeline("/timeline", bob); !storetest.Equal(texts, []string{"hello from alice"}) {
+		t.Errorf("bob's timeline after alice came back = %v", texts)
+	}
+	a.expect(a.do("POST", "/delete", alice, model.Request{Password: testPassword}), http.StatusAccepted, nil)
+}
+
+func TestPurgedAccount(t *testing.T) {
+	// the service is never started; the test runs the purge itself once the account is deleted
+	st := store.NewMemory()
+	p := purge.New(st, purge.DefaultOptions)
+	a := newAPIOver(t, st, WithDeletion(p, 0))
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", alice, model.Request{Input: "bob"}), http.StatusOK, nil)
+	a.tweet(bob, "hi @alice")
+	var conversation model.ConversationResp
+	a.expect(a.do("POST", "/dm/conversations", bob, model.ConversationRequest{Participants: []string{"alice"}}), http.StatusCreated, &conversation)
+	messages := "/dm/conversations/" + conversation.ID.String() + "/messages"
+	a.expect(a.do("POST", messages, alice, model.Request{Input: "only for bob"}), http.StatusCreated, nil)
+
+	a.expect(a.do("POST", "/delete", alice, model.Request{Password: testPassword}), http.StatusAccepted, nil)
+	due, err := a.store.DueDeletions(context.Background(), time.Now())
+	if err != nil || len(due) != 1 {
+		t.Fatalf("due deletions = %v, %v, want alice's", due, err)
+	}
+	err = p.Purge(context.Background(), due[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.expectError(a.do("POST", "/login", "", model.Request{Username: "alice", Password: testPassword}), http.StatusGone, codeAccountDeleted)
+
+	// no one can take the name over, along with the conversations and mentions naming it
+	for _, username := range []string{"alice", "ALICE"} {
+		rec := a.do("POST", "/register", "", model.Request{Username: username, FirstName: "New", LastName: "Owner", Password: testPassword})
+		a.expectError(rec, http.StatusConflict, codeUsernameTaken)
+	}
+	a.expectError(a.do("POST", "/login", "", model.Request{Username: "alice", Password: testPassword}), http.StatusGone, codeAccountDeleted)
+	var page model.MessagePage
+	a.expect(a.do("GET", messages, bob, nil), http.StatusOK, &page)
+	if len(page.Messages) != 1 {
+		t.Errorf("bob's conversation with alice has %d messages, want it kept", len(page.Messages))
+	}
+}
@@ -0,0 +1,427 @@
+package controller
+
+import (
+	guuid "github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/text/unicode/norm"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+	"twitter-feed/validation"
+)
+
+// CreateConversationHandler Starts a one-to-one or group conversation with the given accounts
+// Requires: Authorization header, participants (usernames, without the caller)
+// Handled edges: Starting a one-to-one conversation that already exists returns it, and everyone must accept messages from the caller
+func (s *Server) CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to send messages!")
+	if !ok {
+		return
+	}
+	var req model.ConversationRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	others, ok := s.participants(w, r, result, req.Participants)
+	if !ok {
+		return
+	}
+	participants := append([]string{result.Username}, others...)
+	sort.Strings(participants)
+	now := time.Now()
+	conversation := model.Conversation{
+		ID:            guuid.New(),
+		Participants:  participants,
+		Group:         len(participants) > 2,
+		CreatedBy:     result.Username,
+		CreatedAt:     now,
+		LastMessageAt: now,
+		ReadAt:        map[string]time.Time{result.Username: now},
+	}
+	conversation.Key = conversation.ID.String()
+	if !conversation.Group {
+		conversation.Key = strings.Join(participants, ",")
+		existing, err := s.store.ConversationByKey(r.Context(), conversation.Key)
+		if err == nil {
+			s.writeConversation(w, r, http.StatusOK, result.Username, existing)
+			return
+		}
+		if err != store.ErrNotFound {
+			internalError(w, r, "Error while starting the conversation, please try again", err)
+			return
+		}
+	}
+	for _, username := range others {
+		if !s.acceptsMessages(w, r, username, result.Username) {
+			return
+		}
+	}
+	err := s.store.CreateConversation(r.Context(), conversation)
+	if err == store.ErrDuplicate {
+		// someone started the same one-to-one conversation at the same time
+		conversation, err = s.store.ConversationByKey(r.Context(), conversation.Key)
+		if err == nil {
+			s.writeConversation(w, r, http.StatusOK, result.Username, conversation)
+			return
+		}
+	}
+	if err != nil {
+		internalError(w, r, "Error while starting the conversation, please try again", err)
+		return
+	}
+	s.writeConversation(w, r, http.StatusCreated, result.Username, conversation)
+	return
+}
+
+// ConversationsHandler Lists the caller's conversations, most recently active first
+// Requires: Authorization header, optional limit and cursor query parameters
+// Handled edges: Each conversation reports how many messages from others the caller has not read yet
+func (s *Server) ConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see your messages!")
+	if !ok {
+		return
+	}
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	conversations, err := s.store.Conversations(r.Context(), result.Username, page)
+	if err != nil {
+		internalError(w, r, "Error while loading conversations, please try again", err)
+		return
+	}
+	var resp model.ConversationPage
+	lo, hi, next, prev := pageCursors(len(conversations), page, limit, func(i int) store.Cursor {
+		return store.Cursor{CreatedAt: conversations[i].LastMessageAt, ID: conversations[i].ID}
+	})
+	resp.NextCursor = next
+	resp.PrevCursor = prev
+	conversations = conversations[lo:hi]
+	unread, err := s.store.UnreadMessages(r.Context(), result.Username, conversations)
+	if err != nil {
+		internalError(w, r, "Error while loading conversations, please try again", err)
+		return
+	}
+	resp.Conversations = make([]model.ConversationResp, 0, len(conversations))
+	for _, conversation := range conversations {
+		resp.Conversations = append(resp.Conversations, conversationResp(conversation, unread[conversation.ID]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// SendMessageHandler Sends a message to a conversation the caller takes part in
+// Requires: Authorization header, {id} of the conversation, message text as input
+// Handled edges: No one in the conversation, group or not, may block the caller or be blocked by them, and in a one-to-one conversation the other person must still accept messages from the caller
+func (s *Server) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to send messages!")
+	if !ok {
+		return
+	}
+	conversation, ok := s.conversationParam(w, r, result.Username)
+	if !ok {
+		return
+	}
+	var user model.Request
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	text := norm.NFC.String(user.Input)
+	var errs validation.Errors
+	s.dmLimits.Message(&errs, "input", text)
+	if errs != nil {
+		validationError(w, r, errs)
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	for _, username := range conversation.Participants {
+		if username == result.Username {
+			continue
+		}
+		if !v.checkBlock(w, r, username, "message them") {
+			return
+		}
+		// groups only follow their members' settings when they are started
+		if !conversation.Group && !s.acceptsMessages(w, r, username, result.Username) {
+			return
+		}
+	}
+	message := model.Message{
+		ID:             guuid.New(),
+		ConversationID: conversation.ID,
+		Sender:         result.Username,
+		Text:           text,
+		CreatedAt:      time.Now(),
+	}
+	err := s.store.AddMessage(r.Context(), message)
+	if err != nil {
+		internalError(w, r, "Error while sending the message, please try again", err)
+		return
+	}
+	conversation.ReadAt[result.Username] = message.CreatedAt
+	resp := messageResp(message, conversation)
+	s.streamMessage(r.Context(), conversation, resp)
+	writeJSON(w, http.StatusCreated, resp)
+	return
+}
+
+// MessagesHandler Displays the messages of a conversation the caller takes part in, newest first
+// Requires: Authorization header, {id} of the conversation, optional limit and cursor query parameters
+// Handled edges: Each message lists which of the other participants have read it
+func (s *Server) MessagesHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see your messages!")
+	if !ok {
+		return
+	}
+	conversation, ok := s.conversationParam(w, r, result.Username)
+	if !ok {
+		return
+	}
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	messages, err := s.store.Messages(r.Context(), conversation.ID, page)
+	if err != nil {
+		internalError(w, r, "Error while loading messages, please try again", err)
+		return
+	}
+	var resp model.MessagePage
+	lo, hi, next, prev := pageCursors(len(messages), page, limit, func(i int) store.Cursor {
+		return store.Cursor{CreatedAt: messages[i].CreatedAt, ID: messages[i].ID}
+	})
+	resp.NextCursor = next
+	resp.PrevCursor = prev
+	resp.Messages = make([]model.MessageResp, 0, hi-lo)
+	for _, message := range messages[lo:hi] {
+		resp.Messages = append(resp.Messages, messageResp(message, conversation))
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// ReadConversationHandler Marks every message of a conversation received so far as read
+// Requires: Authorization header, {id} of the conversation
+// Handled edges: The other participants see the caller in the read_by of those messages
+func (s *Server) ReadConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to read your messages!")
+	if !ok {
+		return
+	}
+	conversation, ok := s.conversationParam(w, r, result.Username)
+	if !ok {
+		return
+	}
+	err := s.store.MarkConversationRead(r.Context(), conversation.ID, result.Username, time.Now())
+	if err != nil {
+		internalError(w, r, "Error while marking the conversation as read, please try again", err)
+		return
+	}
+	res.Result = "Marked the conversation as read."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// DMSettingsHandler Displays who can start a conversation with the caller
+// Requires: Authorization header
+func (s *Server) DMSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see your settings!")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, model.DMSettings{AllowFrom: dmPolicy(result)})
+	return
+}
+
+// UpdateDMSettingsHandler Changes who can start a conversation with the caller
+// Requires: Authorization header, allow_from (following or everyone)
+// Handled edges: Conversations that already exist are kept, but one-to-one ones follow the new setting
+func (s *Server) UpdateDMSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to change your settings!")
+	if !ok {
+		return
+	}
+	var settings model.DMSettings
+	if !decodeBody(w, r, &settings) {
+		return
+	}
+	if settings.AllowFrom != model.DMFollowing && settings.AllowFrom != model.DMEveryone {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid allow_from -- it must be following or everyone.", nil)
+		return
+	}
+	err := s.store.SetDMPolicy(r.Context(), result.Username, settings.AllowFrom)
+	if err != nil {
+		internalError(w, r, "Error while updating your settings, please try again", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+	return
+}
+
+// participants spells the requested participants like their accounts, leaving out the caller and
+// duplicates. It answers with a 422 and returns false when some do not exist or there are too
+// few or too many of them.
+func (s *Server) participants(w http.ResponseWriter, r *http.Request, caller model.User, names []string) ([]string, bool) {
+	var errs validation.Errors
+	usernames, err := s.store.Usernames(r.Context(), names)
+	if err != nil {
+		internalError(w, r, "Error while starting the conversation, please try again", err)
+		return nil, false
+	}
+	others := make([]string, 0, len(names))
+	seen := map[string]bool{caller.Username: true}
+	for _, name := range names {
+		username, ok := usernames[name]
+		if !ok {
+			errs = append(errs, validation.FieldError{Field: "participants", Code: validation.CodeUnknownUser, Message: "@" + name + " does not exist in Twitter."})
+			continue
+		}
+		if !seen[username] {
+			seen[username] = true
+			others = append(others, username)
+		}
+	}
+	if errs == nil {
+		s.dmLimits.Participants(&errs, "participants", len(others))
+	}
+	if errs != nil {
+		validationError(w, r, errs)
+		return nil, false
+	}
+	return others, true
+}
+
+// acceptsMessages checks that username lets sender message them and that neither blocks the
+// other, answering with a 403 and returning false when that is not the case
+func (s *Server) acceptsMessages(w http.ResponseWriter, r *http.Request, username string, sender string) bool {
+	user, err := s.store.GetUser(r.Context(), username)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "@"+username+" no longer exists in Twitter.", nil)
+		return false
+	}
+	if err != nil {
+		internalError(w, r, "Error while checking who can message @"+username+", please try again", err)
+		return false
+	}
+	v, err := s.viewerOf(r.Context(), sender)
+	if err != nil {
+		internalError(w, r, "Error while checking who can message @"+username+", please try again", err)
+		return false
+	}
+	if !v.checkBlock(w, r, username, "message them") {
+		return false
+	}
+	if dmPolicy(user) != model.DMFollowing {
+		return true
+	}
+	following, err := s.store.Follows(r.Context(), username, sender)
+	if err != nil {
+		internalError(w, r, "Error while checking who can message @"+username+", please try again", err)
+		return false
+	}
+	if !following {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "@"+username+" only accepts messages from accounts they follow.", nil)
+		return false
+	}
+	return true
+}
+
+// conversationParam loads the conversation named by {id}. Conversations the caller does not take
+// part in are answered with the same 404 as missing ones, so their existence is not revealed.
+func (s *Server) conversationParam(w http.ResponseWriter, r *http.Request, username string) (model.Conversation, bool) {
+	id, err := guuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, codeConversationNotFound, "There is no such conversation.", nil)
+		return model.Conversation{}, false
+	}
+	conversation, err := s.store.GetConversation(r.Context(), id)
+	if err == store.ErrNotFound || err == nil && !contains(conversation.Participants, username) {
+		writeError(w, r, http.StatusNotFound, codeConversationNotFound, "There is no such conversation.", nil)
+		return model.Conversation{}, false
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading the conversation, please try again", err)
+		return model.Conversation{}, false
+	}
+	return conversation, true
+}
+
+// writeConversation answers with the conversation as username sees it
+func (s *Server) writeConversation(w http.ResponseWriter, r *http.Request, status int, username string, conversation model.Conversation) {
+	unread, err := s.store.UnreadMessages(r.Context(), username, []model.Conversation{conversation})
+	if err != nil {
+		internalError(w, r, "Error while loading the conversation, please try again", err)
+		return
+	}
+	writeJSON(w, status, conversationResp(conversation, unread[conversation.ID]))
+}
+
+// dmPolicy returns who can start a conversation with the user
+func dmPolicy(user model.User) string {
+	if user.DMPolicy == "" {
+		return model.DMFollowing
+	}
+	return user.DMPolicy
+}
+
+// conversationResp converts a stored conversation into its API representation
+func conversationResp(conversation model.Conversation, unread int64) model.ConversationResp {
+	resp := model.ConversationResp{
+		ID:            conversation.ID,
+		Participants:  conversation.Participants,
+		Group:         conversation.Group,
+		CreatedBy:     conversation.CreatedBy,
+		CreatedAt:     conversation.CreatedAt,
+		LastMessageAt: conversation.LastMessageAt,
+		UnreadCount:   unread,
+		ReadReceipts:  make([]model.ReadReceipt, 0, len(conversation.Participants)),
+	}
+	if conversation.LastMessage != nil {
+		last := messageResp(*conversation.LastMessage, conversation)
+		resp.LastMessage = &last
+	}
+	for _, username := range conversation.Participants {
+		if at, ok := conversation.ReadAt[username]; ok {
+			resp.ReadReceipts = append(resp.ReadReceipts, model.ReadReceipt{Username: username, ReadAt: at})
+		}
+	}
+	return resp
+}
+
+// messageResp converts a stored message into its API representation, working out who has read
+// it from how far each participant has read the conversation
+func messageResp(message model.Message, conversation model.Conversation) model.MessageResp {
+	resp := model.MessageResp{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		Sender:         message.Sender,
+		Text:           message.Text,
+		CreatedAt:      message.CreatedAt,
+		ReadBy:         make([]string, 0),
+	}
+	for _, username := range conversation.Participants {
+		if username != message.Sender && !conversation.ReadAt[username].Before(message.CreatedAt) {
+			resp.ReadBy = append(resp.ReadBy, username)
+		}
+	}
+	return resp
+}
+
+// contains reports whether value is in list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
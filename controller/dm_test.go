@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/validation"
+)
+
+// startConversation starts a conversation between the owner of token and the participants,
+// expecting status
+func (a *api) startConversation(token string, status int, participants ...string) model.ConversationResp {
+	a.t.Helper()
+	var conversation model.ConversationResp
+	a.expect(a.do("POST", "/dm/conversations", token, model.ConversationRequest{Participants: participants}), status, &conversation)
+	return conversation
+}
+
+// send sends text to the conversation as the owner of token
+func (a *api) send(token string, conversation model.ConversationResp, text string) model.MessageResp {
+	a.t.Helper()
+	var message model.MessageResp
+	a.expect(a.do("POST", "/dm/conversations/"+conversation.ID.String()+"/messages", token, model.Request{Input: text}), http.StatusCreated, &message)
+	return message
+}
+
+// inbox returns the unread count of every conversation of the owner of token, most recently active first
+func (a *api) inbox(token string) []string {
+	a.t.Helper()
+	var page model.ConversationPage
+	a.expect(a.do("GET", "/dm/conversations", token, nil), http.StatusOK, &page)
+	out := make([]string, 0, len(page.Conversations))
+	for _, conversation := range page.Conversations {
+		out = append(out, fmt.Sprintf("%v:%d", conversation.Participants, conversation.UnreadCount))
+	}
+	return out
+}
+
+// readBy lists who read each message of the conversation, newest first, as the owner of token sees it
+func (a *api) readBy(token string, conversation model.ConversationResp) []string {
+	a.t.Helper()
+	var page model.MessagePage
+	a.expect(a.do("GET", "/dm/conversations/"+conversation.ID.String()+"/messages", token, nil), http.StatusOK, &page)
+	out := make([]string, 0, len(page.Messages))
+	for _, message := range page.Messages {
+		out = append(out, fmt.Sprintf("%s:%v", message.Text, message.ReadBy))
+	}
+	return out
+}
+
+func TestConversations(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+
+	// by default only accounts you follow can message you
+	var settings model.DMSettings
+	a.expect(a.do("GET", "/dm/settings", bob, nil), http.StatusOK, &settings)
+	if settings.AllowFrom != model.DMFollowing {
+		t.Errorf("default settings = %+v", settings)
+	}
+	a.expectError(a.do("POST", "/dm/conversations", alice, model.ConversationRequest{Participants: []string{"bob"}}), http.StatusForbidden, codeForbidden)
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	direct := a.startConversation(alice, http.StatusCreated, "bob")
+	if direct.Group || fmt.Sprint(direct.Participants) != "[alice bob]" || direct.CreatedBy != "alice" {
+		t.Errorf("conversation = %+v", direct)
+	}
+	// each pair has one conversation, whoever starts it
+	a.expect(a.do("POST", "/follow", alice, model.Request{Input: "bob"}), http.StatusOK, nil)
+	for token, name := range map[string]string{alice: "BOB", bob: "alice"} {
+		again := a.startConversation(token, http.StatusOK, name, "bob", "alice")
+		if again.ID != direct.ID {
+			t.Errorf("starting it again with %s gave conversation %s, want %s", name, again.ID, direct.ID)
+		}
+	}
+
+	a.expect(a.do("POST", "/dm/settings", carol, model.DMSettings{AllowFrom: model.DMEveryone}), http.StatusOK, nil)
+	a.expectError(a.do("POST", "/dm/settings", carol, model.DMSettings{AllowFrom: "friends"}), http.StatusBadRequest, codeBadRequest)
+	group := a.startConversation(alice, http.StatusCreated, "bob", "carol")
+	if !group.Group || fmt.Sprint(group.Participants) != "[alice bob carol]" {
+		t.Errorf("group = %+v", group)
+	}
+
+	// read receipts and unread counts
+	a.send(alice, direct, "hi")
+	sent := a.send(alice, direct, "there")
+	if len(sent.ReadBy) != 0 {
+		t.Errorf("a new message was read by %v", sent.ReadBy)
+	}
+	a.send(carol, group, "hello all")
+	if got := a.inbox(bob); fmt.Sprint(got) != "[[alice bob carol]:1 [alice bob]:2]" {
+		t.Errorf("bob's inbox = %v", got)
+	}
+	if got := a.inbox(alice); fmt.Sprint(got) != "[[alice bob carol]:1 [alice bob]:0]" {
+		t.Errorf("alice's inbox = %v", got)
+	}
+	a.expect(a.do("POST", "/dm/conversations/"+direct.ID.String()+"/read", bob, nil), http.StatusOK, nil)
+	if got := a.inbox(bob); fmt.Sprint(got) != "[[alice bob carol]:1 [alice bob]:0]" {
+		t.Errorf("bob's inbox after reading = %v", got)
+	}
+	a.send(bob, direct, "hey")
+	if got := a.readBy(alice, direct); fmt.Sprint(got) != "[hey:[] there:[bob] hi:[bob]]" {
+		t.Errorf("read receipts = %v", got)
+	}
+	a.expect(a.do("POST", "/dm/conversations/"+group.ID.String()+"/read", bob, nil), http.StatusOK, nil)
+	if got := a.readBy(carol, group); fmt.Sprint(got) != "[hello all:[bob]]" {
+		t.Errorf("group read receipts = %v", got)
+	}
+	if got := a.inbox(alice); fmt.Sprint(got) != "[[alice bob]:1 [alice bob carol]:1]" {
+		t.Errorf("alice's inbox after bob answered = %v", got)
+	}
+
+	// one-to-one conversations keep following the recipient's setting
+	a.expect(a.do("POST", "/unfollow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expectError(a.do("POST", "/dm/conversations/"+direct.ID.String()+"/messages", alice, model.Request{Input: "still there?"}), http.StatusForbidden, codeForbidden)
+
+	// a block stops messages in groups too, whichever side made it
+	a.expect(a.do("POST", "/blocks/alice", carol, nil), http.StatusCreated, nil)
+	a.expectError(a.do("POST", "/dm/conversations/"+group.ID.String()+"/messages", alice, model.Request{Input: "hi all"}), http.StatusForbidden, codeBlocked)
+	a.expectError(a.do("POST", "/dm/conversations/"+group.ID.String()+"/messages", carol, model.Request{Input: "hi all"}), http.StatusForbidden, codeBlocked)
+	a.expect(a.do("DELETE", "/blocks/alice", carol, nil), http.StatusOK, nil)
+
+	dave := a.signup("dave")
+	a.expectError(a.do("GET", "/dm/conversations/"+direct.ID.String()+"/messages", dave, nil), http.StatusNotFound, codeConversationNotFound)
+	a.expectError(a.do("POST", "/dm/conversations/"+direct.ID.String()+"/read", dave, nil), http.StatusNotFound, codeConversationNotFound)
+	a.expectError(a.do("GET", "/dm/conversations/nope/messages", alice, nil), http.StatusNotFound, codeConversationNotFound)
+	a.expectError(a.do("POST", "/dm/conversations/"+group.ID.String()+"/messages", alice, model.Request{Input: " "}), http.StatusUnprocessableEntity, codeValidation)
+	a.expectError(a.do("GET", "/dm/conversations", "", nil), http.StatusUnauthorized, codeUnauthorized)
+}
+
+func TestConversationParticipants(t *testing.T) {
+	a := newAPI(t, WithDMLimits(validation.DMLimits{MaxLength: 5, MaxParticipants: 3}))
+	alice := a.signup("alice")
+	for _, username := range []string{"bob", "carol", "dave"} {
+		a.expect(a.do("POST", "/dm/settings", a.signup(username), model.DMSettings{AllowFrom: model.DMEveryone}), http.StatusOK, nil)
+	}
+	cases := []struct {
+		participants []string
+		code         string
+	}{
+		{nil, validation.CodeRequired},
+		{[]string{"alice", "ALICE"}, validation.CodeRequired},
+		{[]string{"bob", "nobody"}, validation.CodeUnknownUser},
+		{[]string{"bob", "carol", "dave"}, validation.CodeTooLong},
+	}
+	for _, c := range cases {
+		var body struct {
+			Details validation.Errors `json:"details"`
+		}
+		a.expect(a.do("POST", "/dm/conversations", alice, model.ConversationRequest{Participants: c.participants}), http.StatusUnprocessableEntity, &body)
+		if len(body.Details) != 1 || body.Details[0].Code != c.code {
+			t.Errorf("starting a conversation with %v: details %+v, want %s", c.participants, body.Details, c.code)
+		}
+	}
+	group := a.startConversation(alice, http.StatusCreated, "bob", "Carol", "bob")
+	if fmt.Sprint(group.Participants) != "[alice bob carol]" {
+		t.Errorf("participants = %v", group.Participants)
+	}
+	a.expectError(a.do("POST", "/dm/conversations/"+group.ID.String()+"/messages", alice, model.Request{Input: "too long"}), http.StatusUnprocessableEntity, codeValidation)
+}
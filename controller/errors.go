@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	guuid "github.com/google/uuid"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/validation"
+)
+
+// Error codes clients can branch on. They are part of the API and must not change once published.
+const (
+	codeInvalidJSON          = "invalid_json"
+	codeBadRequest           = "bad_request"
+	codeInvalidCursor        = "invalid_cursor"
+	codeUnauthorized         = "unauthorized"
+	codeInvalidCredentials   = "invalid_credentials"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeUserNotFound         = "user_not_found"
+	codeTweetNotFound        = "tweet_not_found"
+	codeConversationNotFound = "conversation_not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeConflict             = "conflict"
+	codeUsernameTaken        = "username_taken"
+	codeValidation           = "validation_failed"
+	codeInternal             = "internal_error"
+	codeTimeout              = "timeout"
+	codeUnavailable          = "unavailable"
+	codeBlocked              = "blocked"
+	codeProtected            = "protected"
+	codeAccountDeleted       = "account_deleted"
+)
+
+// maxBodyBytes caps how much of a request body is read
+const maxBodyBytes = 1 << 20
+
+// writeJSON encodes v as the response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the uniform error envelope. details may be nil.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string, details interface{}) {
+	writeJSON(w, status, model.APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(r),
+	})
+}
+
+// validationError answers with a 422 listing every rejected field
+func validationError(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	writeError(w, r, http.StatusUnprocessableEntity, codeValidation, "Some fields are invalid -- see details.", errs)
+}
+
+// internalError logs err against the request and answers with a generic 500, so storage
+// errors never leak to clients. Errors caused by the request running out of time get a 503.
+func internalError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	log.Printf("request %s: %s %s: %v", requestID(r), r.Method, r.URL.Path, err)
+	if errors.Is(err, context.DeadlineExceeded) || r.Context().Err() == context.DeadlineExceeded {
+		writeError(w, r, http.StatusServiceUnavailable, codeTimeout, "The request took too long, please try again.", nil)
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError, codeInternal, message, nil)
+}
+
+// decodeBody reads the JSON request body into v, answering with a 400 and returning false
+// when the body is missing or malformed
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	err := decoder.Decode(v)
+	if err == nil {
+		return true
+	}
+	message := "The request body must be a JSON object."
+	if errors.Is(err, io.EOF) {
+		message = "The request body is empty -- send a JSON object."
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		message = fmt.Sprintf("The request body is not valid JSON (at byte %d).", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		message = fmt.Sprintf("The field %q has the wrong type.", typeErr.Field)
+	}
+	writeError(w, r, http.StatusBadRequest, codeInvalidJSON, message, nil)
+	return false
+}
+
+// requestID returns the ID assigned to the request by RequestID
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// RequestID tags every request with an ID, reusing a sane X-Request-ID sent by the client,
+// and echoes it back in the response headers so errors can be matched with server logs
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = guuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts short IDs made of letters, digits, dashes, underscores and dots
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Timeout gives every request a context that expires after d, so that store calls made on its
+// behalf are abandoned once the client can no longer be answered in time
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Recover turns a panic in a handler into a 500 response instead of taking the process down
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				log.Printf("request %s: panic: %v\n%s", requestID(r), p, debug.Stack())
+				writeError(w, r, http.StatusInternalServerError, codeInternal, "Something went wrong on our end, please try again.", nil)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NotFoundHandler answers requests for unknown routes
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, codeNotFound, "There is no such endpoint.", nil)
+}
+
+// MethodNotAllowedHandler answers requests using the wrong method for a known route
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This endpoint does not support "+r.Method+".", nil)
+}
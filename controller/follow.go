@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	guuid "github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// FollowersHandler Lists the accounts following {username}, most recently followed first
+// Requires: {username}, optional limit and cursor query parameters
+// Handled edges: {username} should exist, neither side may block the other, protected accounts only show their followers to approved followers, and blocked or deactivated accounts are left out
+func (s *Server) FollowersHandler(w http.ResponseWriter, r *http.Request) {
+	s.followList(w, r, "see their followers", s.store.FollowersPage, func(edge model.Follow) string {
+		return edge.Follower
+	})
+	return
+}
+
+// FollowingHandler Lists the accounts {username} follows, most recently followed first
+// Requires: {username}, optional limit and cursor query parameters
+// Handled edges: {username} should exist, neither side may block the other, protected accounts only show whom they follow to approved followers, and blocked or deactivated accounts are left out
+func (s *Server) FollowingHandler(w http.ResponseWriter, r *http.Request) {
+	s.followList(w, r, "see whom they follow", s.store.FollowingPage, func(edge model.Follow) string {
+		return edge.Followee
+	})
+	return
+}
+
+// followList answers with a page of the follow edges that list loads for {username}, naming
+// each by the end that other picks
+func (s *Server) followList(w http.ResponseWriter, r *http.Request, doing string,
+	list func(ctx context.Context, username string, page store.Page) ([]model.Follow, error), other func(edge model.Follow) string) {
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	owner, err := s.store.GetUser(r.Context(), mux.Vars(r)["username"])
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "This user does not exist in Twitter.", nil)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading follows, please try again", err)
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, owner.Username, doing) {
+		return
+	}
+	edges, err := list(r.Context(), owner.Username, page)
+	if err != nil {
+		internalError(w, r, "Error while loading follows, please try again", err)
+		return
+	}
+	var resp model.FollowPage
+	lo, hi, next, prev := pageCursors(len(edges), page, limit, func(i int) store.Cursor {
+		return store.Cursor{CreatedAt: edges[i].CreatedAt, ID: edges[i].ID}
+	})
+	resp.NextCursor = next
+	resp.PrevCursor = prev
+	resp.Users = make([]model.FollowResp, 0, hi-lo)
+	names := make([]string, 0, hi-lo)
+	for _, edge := range edges[lo:hi] {
+		names = append(names, other(edge))
+	}
+	err = s.lookupAccounts(r.Context(), v, names)
+	if err != nil {
+		internalError(w, r, "Error while loading follows, please try again", err)
+		return
+	}
+	for _, edge := range edges[lo:hi] {
+		if v.blocked(other(edge)) || v.deactivated[other(edge)] {
+			continue
+		}
+		resp.Users = append(resp.Users, model.FollowResp{Username: other(edge), FollowedAt: edge.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// FollowRequestsHandler Lists the pending requests to follow the caller's account, newest first
+// Requires: Authorization header, optional limit and cursor query parameters
+// Handled edges: Requests stay pending until accepted, rejected or cancelled, even if the account stops being protected
+func (s *Server) FollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see your follow requests!")
+	if !ok {
+		return
+	}
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	requests, err := s.store.FollowRequests(r.Context(), result.Username, page)
+	if err != nil {
+		internalError(w, r, "Error while loading follow requests, please try again", err)
+		return
+	}
+	var resp model.FollowRequestPage
+	lo, hi, next, prev := pageCursors(len(requests), page, limit, func(i int) store.Cursor {
+		return store.Cursor{CreatedAt: requests[i].CreatedAt, ID: requests[i].ID}
+	})
+	resp.NextCursor = next
+	resp.PrevCursor = prev
+	resp.Requests = make([]model.FollowRequestResp, 0, hi-lo)
+	for _, request := range requests[lo:hi] {
+		resp.Requests = append(resp.Requests, model.FollowRequestResp{Username: request.Requester, RequestedAt: request.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// AcceptFollowRequestHandler Approves a request to follow the caller, who gains {username} as a follower
+// Requires: Authorization header, {username} of the requester
+// Handled edges: There must be a pending request from {username}, who is told that it was accepted
+func (s *Server) AcceptFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to answer follow requests!")
+	if !ok {
+		return
+	}
+	requester := mux.Vars(r)["username"]
+	if !s.deleteFollowRequest(w, r, requester, result.Username) {
+		return
+	}
+	err := s.acceptFollow(r.Context(), requester, result.Username)
+	if err != nil {
+		internalError(w, r, "Error while accepting the follow request, please try again", err)
+		return
+	}
+	res.Result = "@" + requester + " now follows you."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// RejectFollowRequestHandler Turns down a request to follow the caller
+// Requires: Authorization header, {username} of the requester
+// Handled edges: There must be a pending request from {username}, who is not told and can ask again
+func (s *Server) RejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to answer follow requests!")
+	if !ok {
+		return
+	}
+	requester := mux.Vars(r)["username"]
+	if !s.deleteFollowRequest(w, r, requester, result.Username) {
+		return
+	}
+	res.Result = "You turned down @" + requester + "'s request to follow you."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// PrivacySettingsHandler Displays whether the caller's account is protected
+// Requires: Authorization header
+func (s *Server) PrivacySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see your settings!")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, model.PrivacySettings{Protected: result.Protected})
+	return
+}
+
+// UpdatePrivacySettingsHandler Protects the caller's account, or stops protecting it
+// Requires: Authorization header, protected
+// Handled edges: Existing followers stay approved, and unprotecting the account accepts every pending request
+func (s *Server) UpdatePrivacySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to change your settings!")
+	if !ok {
+		return
+	}
+	var settings model.PrivacySettings
+	if !decodeBody(w, r, &settings) {
+		return
+	}
+	err := s.store.SetProtected(r.Context(), result.Username, settings.Protected)
+	if err != nil {
+		internalError(w, r, "Error while updating your settings, please try again", err)
+		return
+	}
+	for !settings.Protected {
+		requests, err := s.store.FollowRequests(r.Context(), result.Username, store.Page{Limit: 100})
+		if err != nil {
+			internalError(w, r, "Error while accepting your follow requests, please try again", err)
+			return
+		}
+		if len(requests) == 0 {
+			break
+		}
+		for _, request := range requests {
+			err = s.store.DeleteFollowRequest(r.Context(), request.Requester, result.Username)
+			if err == nil {
+				err = s.acceptFollow(r.Context(), request.Requester, result.Username)
+			}
+			if err != nil && err != store.ErrNotFound {
+				internalError(w, r, "Error while accepting your follow requests, please try again", err)
+				return
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, settings)
+	return
+}
+
+// requestFollow asks target to approve requester as a follower, answering with a 202 once the
+// request is pending
+func (s *Server) requestFollow(w http.ResponseWriter, r *http.Request, requester string, target string) {
+	var res model.ResponseResult
+	request := model.FollowRequest{ID: guuid.New(), Requester: requester, Target: target, CreatedAt: time.Now()}
+	err := s.store.RequestFollow(r.Context(), request)
+	if err == store.ErrDuplicate {
+		res.Result = "You already asked to follow @" + target + " -- they have not answered yet."
+		writeJSON(w, http.StatusAccepted, res)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while following user, please try again", err)
+		return
+	}
+	s.notify(r.Context(), model.Notification{Recipient: target, Kind: model.NotifyFollowRequest, Actor: requester})
+	res.Result = "@" + target + "'s account is protected, so they have to approve your request to follow them."
+	writeJSON(w, http.StatusAccepted, res)
+}
+
+// deleteFollowRequest removes the pending request from requester to target, answering with a 404
+// and returning false when there is none
+func (s *Server) deleteFollowRequest(w http.ResponseWriter, r *http.Request, requester string, target string) bool {
+	err := s.store.DeleteFollowRequest(r.Context(), requester, target)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "@"+requester+" has not asked to follow you.", nil)
+		return false
+	}
+	if err != nil {
+		internalError(w, r, "Error while answering the follow request, please try again", err)
+		return false
+	}
+	return true
+}
+
+// acceptFollow makes requester follow target once target approved it, and tells requester
+func (s *Server) acceptFollow(ctx context.Context, requester string, target string) error {
+	err := s.addFollow(ctx, requester, target)
+	if err == store.ErrDuplicate {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.notify(ctx, model.Notification{Recipient: requester, Kind: model.NotifyFollowAccept, Actor: target})
+	return nil
+}
+
+// addFollow records that follower follows followee and backfills the follower's materialized
+// timeline, returning store.ErrDuplicate if follower already follows followee. Failing to
+// backfill is only logged, since the follow itself was saved.
+func (s *Server) addFollow(ctx context.Context, follower string, followee string) error {
+	err := s.store.Follow(ctx, follower, followee)
+	if err != nil {
+		return err
+	}
+	if s.fanout != nil {
+		err = s.fanout.Followed(ctx, follower, followee)
+		if err != nil {
+			log.Printf("fanout: backfilling @%s for @%s: %v", followee, follower, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+)
+
+// requesters lists who asked to follow the owner of token, newest first
+func (a *api) requesters(token string) []string {
+	a.t.Helper()
+	var page model.FollowRequestPage
+	a.expect(a.do("GET", "/follow-requests", token, nil), http.StatusOK, &page)
+	out := make([]string, 0, len(page.Requests))
+	for _, request := range page.Requests {
+		out = append(out, request.Username)
+	}
+	return out
+}
+
+// usernames lists the usernames on a page of follows
+func usernames(page model.FollowPage) []string {
+	out := make([]string, 0, len(page.Users))
+	for _, user := range page.Users {
+		out = append(out, user.Username)
+	}
+	return out
+}
+
+func TestFollowers(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", carol, model.Request{Input: "alice"}), http.StatusOK, nil)
+	// following again changes nothing
+	a.expect(a.do("POST", "/follow", carol, model.Request{Input: "alice"}), http.StatusOK, nil)
+
+	var page model.FollowPage
+	a.expect(a.do("GET", "/users/alice/followers?limit=1", alice, nil), http.StatusOK, &page)
+	if got := usernames(page); !storetest.Equal(got, []string{"carol"}) || page.NextCursor == "" {
+		t.Fatalf("first page of alice's followers = %v, next %q", got, page.NextCursor)
+	}
+	var more model.FollowPage
+	a.expect(a.do("GET", "/users/alice/followers?limit=1&cursor="+page.NextCursor, alice, nil), http.StatusOK, &more)
+	if got := usernames(more); !storetest.Equal(got, []string{"bob"}) {
+		t.Errorf("second page of alice's followers = %v", got)
+	}
+	var following model.FollowPage
+	a.expect(a.do("GET", "/users/carol/following", "", nil), http.StatusOK, &following)
+	if got := usernames(following); !storetest.Equal(got, []string{"alice"}) {
+		t.Errorf("whom carol follows = %v", got)
+	}
+	var profile model.PublicProfile
+	a.expect(a.do("GET", "/profile/alice", "", nil), http.StatusOK, &profile)
+	if profile.FollowersCount != 2 || profile.FollowingCount != 0 {
+		t.Errorf("alice's counts = %d followers, %d following", profile.FollowersCount, profile.FollowingCount)
+	}
+
+	a.expect(a.do("POST", "/unfollow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expectError(a.do("POST", "/unfollow", bob, model.Request{Input: "alice"}), http.StatusConflict, codeConflict)
+	a.expect(a.do("GET", "/profile/alice", "", nil), http.StatusOK, &profile)
+	if profile.FollowersCount != 1 {
+		t.Errorf("alice has %d followers after bob left, want 1", profile.FollowersCount)
+	}
+}
+
+func TestProtectedAccount(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	a.tweet(alice, "for my followers only")
+	a.expect(a.do("POST", "/settings/privacy", alice, model.PrivacySettings{Protected: true}), http.StatusOK, nil)
+	var settings model.PrivacySettings
+	a.expect(a.do("GET", "/settings/privacy", alice, nil), http.StatusOK, &settings)
+	if !settings.Protected {
+		t.Error("alice's account is not protected")
+	}
+
+	a.expectError(a.do("GET", "/users/alice/tweets", bob, nil), http.StatusForbidden, codeProtected)
+	if texts, _ := a.timeline("/search/tweets?q=followers", bob); len(texts) != 0 {
+		t.Errorf("bob finds %v in search, want nothing", texts)
+	}
+	if texts, _ := a.timeline("/users/alice/tweets", alice); !storetest.Equal(texts, []string{"for my followers only"}) {
+		t.Errorf("alice's own tweets = %v", texts)
+	}
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusAccepted, nil)
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusAccepted, nil)
+	a.expect(a.do("POST", "/follow", carol, model.Request{Input: "alice"}), http.StatusAccepted, nil)
+	if got := a.requesters(alice); !storetest.Equal(got, []string{"carol", "bob"}) {
+		t.Fatalf("alice's follow requests = %v, want carol then bob", got)
+	}
+	if a.follows("bob", "alice") {
+		t.Error("asking to follow alice followed her")
+	}
+
+	a.expect(a.do("POST", "/follow-requests/bob/accept", alice, nil), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow-requests/carol/reject", alice, nil), http.StatusOK, nil)
+	a.expectError(a.do("POST", "/follow-requests/carol/accept", alice, nil), http.StatusNotFound, codeNotFound)
+	if got := a.requesters(alice); len(got) != 0 {
+		t.Errorf("alice's follow requests after answering them = %v", got)
+	}
+	if texts, _ := a.timeline("/users/alice/tweets", bob); !storetest.Equal(texts, []string{"for my followers only"}) {
+		t.Errorf("alice's tweets as her approved follower sees them = %v", texts)
+	}
+	a.expectError(a.do("GET", "/users/alice/tweets", carol, nil), http.StatusForbidden, codeProtected)
+
+	// blocking someone drops their pending request
+	dave := a.signup("dave")
+	a.expect(a.do("POST", "/follow", dave, model.Request{Input: "alice"}), http.StatusAccepted, nil)
+	a.expect(a.do("POST", "/blocks/dave", alice, nil), http.StatusCreated, nil)
+	if got := a.requesters(alice); len(got) != 0 {
+		t.Errorf("alice's follow requests after blocking dave = %v", got)
+	}
+
+	// no longer protecting the account approves the requests still pending
+	a.expect(a.do("POST", "/follow", carol, model.Request{Input: "alice"}), http.StatusAccepted, nil)
+	a.expect(a.do("POST", "/settings/privacy", alice, model.PrivacySettings{Protected: false}), http.StatusOK, nil)
+	if !a.follows("carol", "alice") || !a.follows("bob", "alice") || a.follows("dave", "alice") {
+		t.Error("unprotecting alice's account did not approve carol's request alone")
+	}
+	if got := a.requesters(alice); len(got) != 0 {
+		t.Errorf("alice's follow requests once unprotected = %v", got)
+	}
+}
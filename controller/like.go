@@ -0,0 +1,191 @@
+package controller
+
+import (
+	guuid "github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// LikeHandler Likes a tweet
+// Requires: Authorization header, {id} of the tweet to like
+// Handled edges: Liking a retweet likes the original, liking the same tweet twice is a no-op, and neither side of a block can like the other's tweets
+func (s *Server) LikeHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before liking tweets!")
+	if !ok {
+		return
+	}
+	original, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, original.Author, "like their tweets") {
+		return
+	}
+	like := model.Like{
+		ID:        guuid.New(),
+		TweetID:   original.ID,
+		Username:  result.Username,
+		CreatedAt: time.Now(),
+	}
+	err := s.store.Like(r.Context(), like)
+	if err == store.ErrDuplicate {
+		res.Result = "You already like @" + original.Author + "'s tweet."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err == store.ErrNotFound {
+		// the tweet was deleted since it was loaded
+		writeError(w, r, http.StatusNotFound, codeTweetNotFound, "There is no such tweet.", nil)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while liking the tweet, please try again", err)
+		return
+	}
+	s.notify(r.Context(), model.Notification{Recipient: original.Author, Kind: model.NotifyLike, Actor: result.Username, TweetID: &original.ID})
+	res.Result = "You liked @" + original.Author + "'s tweet!"
+	writeJSON(w, http.StatusCreated, res)
+	return
+}
+
+// UnlikeHandler Takes back your like of a tweet
+// Requires: Authorization header, {id} of the liked tweet
+// Handled edges: Unliking a tweet you never liked is a no-op
+func (s *Server) UnlikeHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before unliking tweets!")
+	if !ok {
+		return
+	}
+	original, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	err := s.store.Unlike(r.Context(), original.ID, result.Username)
+	if err == store.ErrNotFound {
+		res.Result = "You do not like @" + original.Author + "'s tweet."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while unliking the tweet, please try again", err)
+		return
+	}
+	res.Result = "You no longer like @" + original.Author + "'s tweet."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// TweetLikesHandler Lists who liked a tweet, most recent like first
+// Requires: {id} in request, optional limit and cursor query parameters
+// Handled edges: Listing the likes of a retweet lists the likes of the original
+func (s *Server) TweetLikesHandler(w http.ResponseWriter, r *http.Request) {
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	original, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, original.Author, "see who liked their tweets") {
+		return
+	}
+	likes, err := s.store.TweetLikes(r.Context(), original.ID, page)
+	if err != nil {
+		internalError(w, r, "Error while loading likes, please try again", err)
+		return
+	}
+	var resp model.LikePage
+	lo, hi, next, prev := pageCursors(len(likes), page, limit, likeCursor(likes))
+	resp.NextCursor = next
+	resp.PrevCursor = prev
+	resp.Likes = make([]model.LikeResp, 0, hi-lo)
+	names := make([]string, 0, hi-lo)
+	for _, like := range likes[lo:hi] {
+		names = append(names, like.Username)
+	}
+	err = s.lookupAccounts(r.Context(), v, names)
+	if err != nil {
+		internalError(w, r, "Error while loading likes, please try again", err)
+		return
+	}
+	for _, like := range likes[lo:hi] {
+		if v.blocked(like.Username) || v.deactivated[like.Username] {
+			continue
+		}
+		resp.Likes = append(resp.Likes, model.LikeResp{Username: like.Username, LikedAt: like.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// UserLikesHandler Displays the tweets a user liked, most recently liked first
+// Requires: {username} in request, optional limit and cursor query parameters
+// Handled edges: User should exist, neither side of a block sees the other's likes, protected accounts only show them to approved followers, and the cursor pages by when the tweets were liked rather than posted
+func (s *Server) UserLikesHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	owner, err := s.store.GetUser(r.Context(), params["username"])
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "This user does not exist in Twitter.", nil)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading likes, please try again", err)
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, owner.Username, "see their likes") {
+		return
+	}
+	likes, err := s.store.UserLikes(r.Context(), owner.Username, page)
+	if err != nil {
+		internalError(w, r, "Error while loading likes, please try again", err)
+		return
+	}
+	var timeline model.Timeline
+	lo, hi, next, prev := pageCursors(len(likes), page, limit, likeCursor(likes))
+	ids := make([]guuid.UUID, 0, hi-lo)
+	for _, like := range likes[lo:hi] {
+		ids = append(ids, like.TweetID)
+	}
+	byID, err := s.store.GetTweets(r.Context(), ids)
+	if err != nil {
+		internalError(w, r, "Error while loading likes, please try again", err)
+		return
+	}
+	tweets := make([]model.Tweet, 0, len(ids))
+	for _, id := range ids {
+		if tweet, ok := byID[id]; ok {
+			tweets = append(tweets, tweet)
+		}
+	}
+	timeline.Tweets, err = s.tweetResps(r.Context(), v, tweets)
+	if err != nil {
+		internalError(w, r, "Error while loading likes, please try again", err)
+		return
+	}
+	timeline.NextCursor = next
+	timeline.PrevCursor = prev
+	writeJSON(w, http.StatusOK, timeline)
+	return
+}
+
+// likeCursor positions pageCursors on the likes themselves, so pages follow when each like was given
+func likeCursor(likes []model.Like) func(i int) store.Cursor {
+	return func(i int) store.Cursor {
+		return store.Cursor{CreatedAt: likes[i].CreatedAt, ID: likes[i].ID}
+	}
+}
@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"context"
+	guuid "github.com/google/uuid"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// summaries completes the sentence a notification group's actors start
+var summaries = map[string]string{
+	model.NotifyFollow:  "followed you",
+	model.NotifyMention: "mentioned you",
+	model.NotifyReply:   "replied to your tweet",
+	model.NotifyQuote:   "quoted your tweet",
+	model.NotifyRetweet: "retweeted your tweet",
+	model.NotifyLike:    "liked your tweet",
+	// follow requests are about the recipient's protected account, and acceptances about the
+	// recipient's request
+	model.NotifyFollowRequest: "requested to follow you",
+	model.NotifyFollowAccept:  "accepted your follow request",
+}
+
+// NotificationsHandler Displays the caller's notifications, newest first, along with how many are unread
+// Requires: Authorization header, optional limit and cursor query parameters
+// Handled edges: Follows, and likes or retweets of the same tweet, are grouped within a page, and notifications from blocked or muted accounts or about tweets with muted words are left out
+func (s *Server) NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see your notifications!")
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	notifications, err := s.store.Notifications(r.Context(), result.Username, page)
+	if err != nil {
+		internalError(w, r, "Error while loading notifications, please try again", err)
+		return
+	}
+	var resp model.NotificationPage
+	lo, hi, next, prev := pageCursors(len(notifications), page, limit, func(i int) store.Cursor {
+		return store.Cursor{CreatedAt: notifications[i].CreatedAt, ID: notifications[i].ID}
+	})
+	resp.NextCursor = next
+	resp.PrevCursor = prev
+	resp.Notifications, err = s.notificationGroups(r.Context(), v, notifications[lo:hi])
+	if err != nil {
+		internalError(w, r, "Error while loading notifications, please try again", err)
+		return
+	}
+	resp.UnreadCount, err = s.store.UnreadCount(r.Context(), result.Username)
+	if err != nil {
+		internalError(w, r, "Error while loading notifications, please try again", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// ReadNotificationsHandler Marks every notification received so far as read
+// Requires: Authorization header
+// Handled edges: Notifications arriving while the request runs stay unread
+func (s *Server) ReadNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to read your notifications!")
+	if !ok {
+		return
+	}
+	marked, err := s.store.MarkRead(r.Context(), result.Username, time.Now())
+	if err != nil {
+		internalError(w, r, "Error while marking notifications as read, please try again", err)
+		return
+	}
+	res.Result = "Marked " + strconv.FormatInt(marked, 10) + " notifications as read."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// MentionsHandler Displays the tweets mentioning the caller, newest first
+// Requires: Authorization header, optional limit and cursor query parameters
+// Handled edges: Mentions are matched however the tweet spelled the username, and mentions by blocked or muted accounts are left out
+func (s *Server) MentionsHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see your mentions!")
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	tweets, err := s.store.Mentions(r.Context(), result.Username, page)
+	if err != nil {
+		internalError(w, r, "Error while loading mentions, please try again", err)
+		return
+	}
+	timeline, err := s.tweetPage(r.Context(), v, tweets, page, limit)
+	if err != nil {
+		internalError(w, r, "Error while loading mentions, please try again", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, timeline)
+	return
+}
+
+// notify stores the notifications, leaving out the ones people would get about themselves or
+// from accounts they block, are blocked by or mute, and pushes them to connected recipients.
+// Failing to store them is only logged, since whatever caused them already happened.
+func (s *Server) notify(ctx context.Context, notifications ...model.Notification) {
+	kept := make([]model.Notification, 0, len(notifications))
+	viewers := make(map[string]viewer)
+	now := time.Now()
+	for _, notification := range notifications {
+		if notification.Recipient == notification.Actor {
+			continue
+		}
+		v, ok := viewers[notification.Recipient]
+		if !ok {
+			var err error
+			v, err = s.viewerOf(ctx, notification.Recipient)
+			if err != nil {
+				log.Printf("notifications: loading who %s blocks and mutes: %v", notification.Recipient, err)
+				continue
+			}
+			viewers[notification.Recipient] = v
+		}
+		if v.hidesAccount(notification.Actor) {
+			continue
+		}
+		notification.ID = guuid.New()
+		notification.CreatedAt = now
+		kept = append(kept, notification)
+	}
+	err := s.store.AddNotifications(ctx, kept)
+	if err != nil {
+		log.Printf("notifications: storing %d notifications: %v", len(kept), err)
+		return
+	}
+	s.streamNotifications(ctx, kept, viewers)
+}
+
+// notifyTweet notifies whoever a new tweet mentions, replies to, quotes or retweets
+func (s *Server) notifyTweet(ctx context.Context, tweet model.Tweet) {
+	notifications := make([]model.Notification, 0)
+	id := tweet.ID
+	if tweet.InReplyToUser != "" {
+		notifications = append(notifications, model.Notification{Recipient: tweet.InReplyToUser, Kind: model.NotifyReply, Actor: tweet.Author, TweetID: &id})
+	}
+	if tweet.RetweetOf != nil {
+		if author, ok := s.tweetAuthor(ctx, *tweet.RetweetOf); ok {
+			notifications = append(notifications, model.Notification{Recipient: author, Kind: model.NotifyRetweet, Actor: tweet.Author, TweetID: tweet.RetweetOf})
+		}
+	}
+	if tweet.QuoteOf != nil {
+		if author, ok := s.tweetAuthor(ctx, *tweet.QuoteOf); ok {
+			notifications = append(notifications, model.Notification{Recipient: author, Kind: model.NotifyQuote, Actor: tweet.Author, TweetID: &id})
+		}
+	}
+	// someone replied to is told about the reply, not also about being mentioned in it
+	mentioned := map[string]bool{tweet.InReplyToUser: true}
+	for _, mention := range tweet.Entities.Mentions {
+		if mentioned[mention.Text] {
+			continue
+		}
+		mentioned[mention.Text] = true
+		notifications = append(notifications, model.Notification{Recipient: mention.Text, Kind: model.NotifyMention, Actor: tweet.Author, TweetID: &id})
+	}
+	if len(notifications) > 0 {
+		s.notify(ctx, notifications...)
+	}
+}
+
+func (s *Server) tweetAuthor(ctx context.Context, id guuid.UUID) (string, bool) {
+	tweet, err := s.store.GetTweet(ctx, id)
+	if err != nil {
+		log.Printf("notifications: loading tweet %s: %v", id, err)
+		return "", false
+	}
+	return tweet.Author, true
+}
+
+// notificationGroups folds a newest-first page of notifications into groups, each placed where
+// its newest notification was, and attaches the tweets they are about. Notifications from
+// accounts the viewer must not see, and groups about tweets they must not see, are left out.
+func (s *Server) notificationGroups(ctx context.Context, v viewer, notifications []model.Notification) ([]model.NotificationGroup, error) {
+	groups := make([]model.NotificationGroup, 0, len(notifications))
+	index := make(map[string]int)
+	actors := make([]map[string]bool, 0, len(notifications))
+	ids := make([]guuid.UUID, 0)
+	names := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		names = append(names, notification.Actor)
+	}
+	err := s.lookupAccounts(ctx, v, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, notification := range notifications {
+		if v.hidesAccount(notification.Actor) {
+			continue
+		}
+		key := notification.ID.String()
+		switch notification.Kind {
+		case model.NotifyFollow, model.NotifyFollowRequest:
+			key = notification.Kind
+		case model.NotifyLike, model.NotifyRetweet:
+			key = notification.Kind + ":" + notification.TweetID.String()
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, model.NotificationGroup{
+				Kind:      notification.Kind,
+				TweetID:   notification.TweetID,
+				CreatedAt: notification.CreatedAt,
+				Read:      true,
+			})
+			actors = append(actors, make(map[string]bool))
+			if notification.TweetID != nil {
+				ids = append(ids, *notification.TweetID)
+			}
+		}
+		if !actors[i][notification.Actor] {
+			actors[i][notification.Actor] = true
+			groups[i].Actors = append(groups[i].Actors, notification.Actor)
+		}
+		groups[i].Read = groups[i].Read && notification.Read
+	}
+	tweets, err := s.store.GetTweets(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]string, 0, len(tweets))
+	for _, tweet := range tweets {
+		authors = append(authors, tweet.Author)
+	}
+	err = s.lookupAccounts(ctx, v, authors)
+	if err != nil {
+		return nil, err
+	}
+	kept := groups[:0]
+	for _, group := range groups {
+		group.Summary = summary(group.Actors, group.Kind)
+		if group.TweetID != nil {
+			tweet, ok := tweets[*group.TweetID]
+			if ok && v.hides(tweet) {
+				continue
+			}
+			if ok {
+				resp := tweetResp(tweet)
+				group.Tweet = &resp
+			}
+		}
+		kept = append(kept, group)
+	}
+	return kept, nil
+}
+
+// summary describes a group, such as "alice and 3 others liked your tweet"
+func summary(actors []string, kind string) string {
+	who := "@" + actors[0]
+	switch {
+	case len(actors) == 2:
+		who += " and @" + actors[1]
+	case len(actors) > 2:
+		who += " and " + strconv.Itoa(len(actors)-1) + " others"
+	}
+	return who + " " + summaries[kind]
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+)
+
+// notifications loads a page of the inbox of the owner of token
+func (a *api) notifications(token string, query string) model.NotificationPage {
+	a.t.Helper()
+	var page model.NotificationPage
+	a.expect(a.do("GET", "/notifications?"+query, token, nil), http.StatusOK, &page)
+	return page
+}
+
+// groupSummaries lists the summary of every group on a page of notifications
+func groupSummaries(page model.NotificationPage) []string {
+	out := make([]string, 0, len(page.Notifications))
+	for _, group := range page.Notifications {
+		out = append(out, group.Summary)
+	}
+	return out
+}
+
+func TestNotifications(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	tokens := make(map[string]string)
+	for _, username := range []string{"bob", "carol", "dave", "erin"} {
+		tokens[username] = a.signup(username)
+		a.expect(a.do("POST", "/follow", tokens[username], model.Request{Input: "alice"}), http.StatusOK, nil)
+	}
+	// following again is no news
+	a.expect(a.do("POST", "/follow", tokens["bob"], model.Request{Input: "alice"}), http.StatusOK, nil)
+	hello := a.tweet(alice, "hello")
+	other := a.tweet(alice, "other")
+	a.expect(a.do("POST", "/tweets/"+hello.ID.String()+"/like", tokens["bob"], nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/tweets/"+other.ID.String()+"/like", tokens["dave"], nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/tweets/"+hello.ID.String()+"/like", tokens["carol"], nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/tweets/"+hello.ID.String()+"/retweet", tokens["dave"], nil), http.StatusCreated, nil)
+	// nobody is told about what they did themselves
+	a.expect(a.do("POST", "/tweets/"+hello.ID.String()+"/like", alice, nil), http.StatusCreated, nil)
+	// being replied to and mentioned in the same tweet is one notification
+	a.reply(tokens["erin"], hello, "@alice @BOB agreed")
+
+	page := a.notifications(alice, "")
+	want := []string{
+		"@erin replied to your tweet",
+		"@dave retweeted your tweet",
+		"@carol and @bob liked your tweet",
+		"@dave liked your tweet",
+		"@erin and 3 others followed you",
+	}
+	if !storetest.Equal(groupSummaries(page), want) {
+		t.Fatalf("alice's notifications = %q, want %q", groupSummaries(page), want)
+	}
+	likes := page.Notifications[2]
+	if likes.Kind != model.NotifyLike || likes.Tweet == nil || likes.Tweet.Text != "hello" || likes.Read {
+		t.Errorf("like group = %+v, want the unread likes of hello", likes)
+	}
+	follows := page.Notifications[4]
+	if len(follows.Actors) != 4 || follows.Actors[0] != "erin" || follows.Actors[3] != "bob" || follows.TweetID != nil {
+		t.Errorf("follow group = %+v, want the four followers, latest first", follows)
+	}
+	if page.UnreadCount != 9 {
+		t.Errorf("unread count = %d, want 9", page.UnreadCount)
+	}
+
+	// groups only form within a page
+	page = a.notifications(alice, "limit=4")
+	if !storetest.Equal(groupSummaries(page), []string{"@erin replied to your tweet", "@dave retweeted your tweet", "@carol liked your tweet", "@dave liked your tweet"}) {
+		t.Errorf("first page = %q", groupSummaries(page))
+	}
+	page = a.notifications(alice, "limit=4&cursor="+url.QueryEscape(page.NextCursor))
+	if !storetest.Equal(groupSummaries(page), []string{"@bob liked your tweet", "@erin and 2 others followed you"}) || page.UnreadCount != 9 {
+		t.Errorf("second page = %q, %d unread", groupSummaries(page), page.UnreadCount)
+	}
+
+	var res model.ResponseResult
+	a.expect(a.do("POST", "/notifications/read", alice, nil), http.StatusOK, &res)
+	if res.Result != "Marked 9 notifications as read." {
+		t.Errorf("marking as read = %q", res.Result)
+	}
+	a.expect(a.do("POST", "/tweets/"+hello.ID.String()+"/like", tokens["erin"], nil), http.StatusCreated, nil)
+	// the new like joins the earlier ones and makes their group unread again
+	page = a.notifications(alice, "")
+	if page.UnreadCount != 1 || page.Notifications[0].Summary != "@erin and 2 others liked your tweet" || page.Notifications[0].Read || !page.Notifications[1].Read {
+		t.Errorf("after reading = %q, %d unread", groupSummaries(page), page.UnreadCount)
+	}
+
+	// bob hears about the mention, spelled however the tweet spelled it
+	page = a.notifications(tokens["bob"], "")
+	if !storetest.Equal(groupSummaries(page), []string{"@erin mentioned you"}) || page.UnreadCount != 1 {
+		t.Errorf("bob's notifications = %q, %d unread", groupSummaries(page), page.UnreadCount)
+	}
+	texts, _ := a.timeline("/mentions", tokens["bob"])
+	if !storetest.Equal(texts, []string{"@alice @BOB agreed"}) {
+		t.Errorf("bob's mentions = %q", texts)
+	}
+
+	a.expectError(a.do("GET", "/notifications", "", nil), http.StatusUnauthorized, codeUnauthorized)
+	a.expectError(a.do("POST", "/notifications/read", "", nil), http.StatusUnauthorized, codeUnauthorized)
+	a.expectError(a.do("GET", "/mentions", "", nil), http.StatusUnauthorized, codeUnauthorized)
+}
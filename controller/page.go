@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"twitter-feed/store"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePage reads the "limit" and "cursor" query parameters of a paginated listing.
+// The returned page asks the store for one extra item so that pageCursors can tell
+// whether another page follows.
+func parsePage(r *http.Request) (store.Page, int, error) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		return store.Page{}, 0, err
+	}
+	page := store.Page{Limit: limit + 1}
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		cursor, err := store.ParseCursor(raw)
+		if err != nil {
+			return store.Page{}, 0, err
+		}
+		page.Cursor = &cursor
+	}
+	return page, limit, nil
+}
+
+// parseLimit reads the "limit" query parameter, capped at maxPageSize
+func parseLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultPageSize, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, strconv.ErrSyntax
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, nil
+}
+
+// parseRanked reads the "limit" and "cursor" query parameters of a listing ranked by something
+// other than time, such as relevance, which is paged by position instead of by store.Cursor
+func parseRanked(r *http.Request) (offset int, limit int, err error) {
+	limit, err = parseLimit(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	raw := r.URL.Query().Get("cursor")
+	if raw == "" {
+		return 0, limit, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || !strings.HasPrefix(string(decoded), "r:") {
+		return 0, 0, store.ErrBadCursor
+	}
+	offset, err = strconv.Atoi(strings.TrimPrefix(string(decoded), "r:"))
+	if err != nil || offset < 0 {
+		return 0, 0, store.ErrBadCursor
+	}
+	return offset, limit, nil
+}
+
+// rankedCursors returns the cursors of the pages around the one at offset, given that the store
+// was asked for limit+1 items and returned n
+func rankedCursors(n int, offset int, limit int) (next string, prev string) {
+	if n > limit {
+		next = offsetCursor(offset + limit)
+	}
+	if offset > 0 {
+		before := offset - limit
+		if before < 0 {
+			before = 0
+		}
+		prev = offsetCursor(before)
+	}
+	return next, prev
+}
+
+func offsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("r:" + strconv.Itoa(offset)))
+}
+
+// pageCursors trims the extra item fetched by parsePage off a newest-first listing of n items
+// and returns the bounds of the items to keep along with the cursors of the neighbouring pages.
+// at returns the position of the i-th item. The previous cursor is handed out whenever there
+// is something to anchor it to, so clients can always poll it for items newer than the page.
+func pageCursors(n int, page store.Page, limit int, at func(i int) store.Cursor) (lo int, hi int, next string, prev string) {
+	lo, hi = 0, n
+	more := n > limit
+	if more {
+		if page.Newer() {
+			lo = n - limit
+		} else {
+			hi = limit
+		}
+	}
+	if hi > lo {
+		last := at(hi - 1)
+		if more || page.Newer() {
+			next = last.String()
+		}
+		first := at(lo)
+		first.Newer = true
+		prev = first.String()
+	} else if page.Cursor != nil && page.Cursor.Newer {
+		prev = page.Cursor.String()
+	}
+	return lo, hi, next, prev
+}
+
+// pageError answers a request whose paging parameters parsePage rejected
+func pageError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == store.ErrBadCursor {
+		writeError(w, r, http.StatusBadRequest, codeInvalidCursor, "Invalid cursor -- use the cursors returned with the previous page.", nil)
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid limit -- it must be a positive number.", nil)
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+)
+
+func TestTimelinePagination(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	for i := 1; i <= 5; i++ {
+		a.tweet(alice, fmt.Sprint(i))
+	}
+
+	var pages [][]string
+	path := "/timeline?limit=2"
+	var last model.Timeline
+	for path != "" && len(pages) < 5 {
+		texts, timeline := a.timeline(path, bob)
+		pages = append(pages, texts)
+		last = timeline
+		path = ""
+		if timeline.NextCursor != "" {
+			path = "/timeline?limit=2&cursor=" + url.QueryEscape(timeline.NextCursor)
+		}
+	}
+	want := [][]string{{"5", "4"}, {"3", "2"}, {"1"}}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+
+	// the previous cursor of the last page leads back to the page before it
+	texts, _ := a.timeline("/timeline?limit=2&cursor="+url.QueryEscape(last.PrevCursor), bob)
+	if !storetest.Equal(texts, []string{"3", "2"}) {
+		t.Errorf("page before the last = %v, want [3 2]", texts)
+	}
+
+	a.tweet(alice, "6")
+	_, first := a.timeline("/timeline?limit=2", bob)
+	a.tweet(alice, "7")
+	texts, _ = a.timeline("/timeline?limit=2&cursor="+url.QueryEscape(first.PrevCursor), bob)
+	if !storetest.Equal(texts, []string{"7"}) {
+		t.Errorf("tweets newer than the first page = %v, want [7]", texts)
+	}
+
+	a.expectError(a.do("GET", "/timeline?cursor=garbage", bob, nil), http.StatusBadRequest, codeInvalidCursor)
+	a.expectError(a.do("GET", "/timeline?limit=0", bob, nil), http.StatusBadRequest, codeBadRequest)
+}
+
+func TestTimelineDuplicates(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	for _, username := range []string{"alice", "bob"} {
+		a.expect(a.do("POST", "/follow", carol, model.Request{Input: username}), http.StatusOK, nil)
+	}
+	first := a.tweet(alice, "first")
+	a.tweet(alice, "second")
+	a.expect(a.do("POST", "/tweets/"+first.ID.String()+"/retweet", bob, nil), http.StatusCreated, nil)
+
+	// the retweet moves alice's first tweet up and it is not listed again further down
+	texts, timeline := a.timeline("/timeline?limit=3", carol)
+	if !storetest.Equal(texts, []string{"first", "second"}) {
+		t.Errorf("carol's timeline = %v, want first once, at the retweet's position", texts)
+	}
+	if timeline.NextCursor != "" {
+		t.Errorf("next cursor = %q, want none after the last tweet", timeline.NextCursor)
+	}
+	// pages are cut before duplicates are folded, so the next page does not skip anything
+	texts, timeline = a.timeline("/timeline?limit=2", carol)
+	if !storetest.Equal(texts, []string{"first", "second"}) || timeline.NextCursor == "" {
+		t.Fatalf("first page = %v, next %q", texts, timeline.NextCursor)
+	}
+	texts, _ = a.timeline("/timeline?limit=2&cursor="+url.QueryEscape(timeline.NextCursor), carol)
+	if !storetest.Equal(texts, []string{"first"}) {
+		t.Errorf("second page = %v, want alice's tweet at its own position", texts)
+	}
+}
@@ -0,0 +1,440 @@
+package controller
+
+import (
+	"context"
+	guuid "github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/text/unicode/norm"
+	"net/http"
+	"strings"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/search"
+	"twitter-feed/store"
+	"twitter-feed/validation"
+)
+
+// BlockHandler Blocks an account, which stops it from following, messaging or seeing the caller
+// Requires: Authorization header, {username} to block
+// Handled edges: Follows and pending follow requests are removed both ways along with the block, and blocking someone twice only removes any made since
+func (s *Server) BlockHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before blocking users!")
+	if !ok {
+		return
+	}
+	other, ok := s.otherParam(w, r, result.Username, "You cannot block yourself.")
+	if !ok {
+		return
+	}
+	err := s.store.Block(r.Context(), model.Block{Blocker: result.Username, Blocked: other.Username, CreatedAt: time.Now()})
+	if err == store.ErrDuplicate {
+		res.Result = "You already block @" + other.Username + "."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while blocking user, please try again", err)
+		return
+	}
+	res.Result = "You blocked @" + other.Username + "."
+	writeJSON(w, http.StatusCreated, res)
+	return
+}
+
+// UnblockHandler Lifts a block
+// Requires: Authorization header, {username} to unblock
+// Handled edges: Unblocking someone you do not block is a no-op, and follows removed by the block stay removed
+func (s *Server) UnblockHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before unblocking users!")
+	if !ok {
+		return
+	}
+	username := mux.Vars(r)["username"]
+	err := s.store.Unblock(r.Context(), result.Username, username)
+	if err == store.ErrNotFound {
+		res.Result = "You do not block @" + username + "."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while unblocking user, please try again", err)
+		return
+	}
+	res.Result = "You unblocked @" + username + "."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// BlocksHandler Lists the accounts the caller blocks, most recently blocked first
+// Requires: Authorization header
+func (s *Server) BlocksHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see who you block!")
+	if !ok {
+		return
+	}
+	blocks, err := s.store.Blocks(r.Context(), result.Username)
+	if err != nil {
+		internalError(w, r, "Error while loading blocked accounts, please try again", err)
+		return
+	}
+	resp := model.BlockList{Blocks: make([]model.BlockResp, 0, len(blocks))}
+	for _, block := range blocks {
+		resp.Blocks = append(resp.Blocks, model.BlockResp{Username: block.Blocked, BlockedAt: block.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// MuteHandler Mutes an account, hiding its tweets and notifications from the caller without it knowing
+// Requires: Authorization header, {username} to mute, optional body with expires_in (seconds)
+// Handled edges: Muting someone again only changes when the mute expires, and follows are kept
+func (s *Server) MuteHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before muting users!")
+	if !ok {
+		return
+	}
+	other, ok := s.otherParam(w, r, result.Username, "You cannot mute yourself.")
+	if !ok {
+		return
+	}
+	var req model.MuteRequest
+	if r.ContentLength != 0 && !decodeBody(w, r, &req) {
+		return
+	}
+	s.mute(w, r, model.Mute{Username: result.Username, Account: other.Username}, req.ExpiresIn)
+	return
+}
+
+// UnmuteHandler Lifts the mute of an account
+// Requires: Authorization header, {username} to unmute
+// Handled edges: Unmuting someone you have not muted is a no-op
+func (s *Server) UnmuteHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before unmuting users!")
+	if !ok {
+		return
+	}
+	username := mux.Vars(r)["username"]
+	err := s.store.Unmute(r.Context(), result.Username, username)
+	if err == store.ErrNotFound {
+		res.Result = "You have not muted @" + username + "."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while unmuting user, please try again", err)
+		return
+	}
+	res.Result = "You unmuted @" + username + "."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// MuteWordHandler Mutes a word, phrase or #hashtag, hiding the tweets and notifications containing it from the caller
+// Requires: Authorization header, word, optional expires_in (seconds)
+// Handled edges: Words match in any letter case like in search, and muting a word again only changes when the mute expires
+func (s *Server) MuteWordHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before muting words!")
+	if !ok {
+		return
+	}
+	var req model.MuteRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	word := strings.Join(strings.Fields(strings.ToLower(norm.NFC.String(req.Word))), " ")
+	s.mute(w, r, model.Mute{Username: result.Username, Word: word}, req.ExpiresIn)
+	return
+}
+
+// UnmuteWordHandler Lifts the mute of a word
+// Requires: Authorization header, {id} of the muted word
+// Handled edges: Mutes of other users answer 404 like missing ones
+func (s *Server) UnmuteWordHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before unmuting words!")
+	if !ok {
+		return
+	}
+	id, err := guuid.Parse(mux.Vars(r)["id"])
+	if err == nil {
+		err = s.store.UnmuteWord(r.Context(), result.Username, id)
+	} else {
+		err = store.ErrNotFound
+	}
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "There is no such muted word.", nil)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while unmuting the word, please try again", err)
+		return
+	}
+	res.Result = "The word is no longer muted."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// MutesHandler Lists the accounts and words the caller mutes, most recently muted first
+// Requires: Authorization header
+// Handled edges: Mutes that have expired are left out
+func (s *Server) MutesHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to see what you mute!")
+	if !ok {
+		return
+	}
+	mutes, err := s.store.Mutes(r.Context(), result.Username, time.Now())
+	if err != nil {
+		internalError(w, r, "Error while loading mutes, please try again", err)
+		return
+	}
+	resp := model.MuteList{Mutes: make([]model.MuteResp, 0, len(mutes))}
+	for _, mute := range mutes {
+		resp.Mutes = append(resp.Mutes, muteResp(mute))
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// mute validates and stores the mute of an account or a word lasting expiresIn seconds, and
+// answers with the mute as stored
+func (s *Server) mute(w http.ResponseWriter, r *http.Request, mute model.Mute, expiresIn int64) {
+	var errs validation.Errors
+	if mute.Account == "" {
+		validation.MutedWord(&errs, "word", mute.Word)
+	}
+	validation.MuteExpiry(&errs, "expires_in", expiresIn)
+	if errs != nil {
+		validationError(w, r, errs)
+		return
+	}
+	mute.ID = guuid.New()
+	mute.CreatedAt = time.Now()
+	if expiresIn > 0 {
+		expires := mute.CreatedAt.Add(time.Duration(expiresIn) * time.Second)
+		mute.ExpiresAt = &expires
+	}
+	stored, err := s.store.Mute(r.Context(), mute)
+	if err != nil {
+		internalError(w, r, "Error while muting, please try again", err)
+		return
+	}
+	status := http.StatusOK
+	if stored.ID == mute.ID {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, muteResp(stored))
+}
+
+// otherParam loads the user named by {username}, answering with a 404 when there is no such user
+// and with a 422 carrying message when it is the caller, and returning false in both cases
+func (s *Server) otherParam(w http.ResponseWriter, r *http.Request, caller string, message string) (model.User, bool) {
+	user, err := s.store.GetUser(r.Context(), mux.Vars(r)["username"])
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "This user does not exist in Twitter.", nil)
+		return model.User{}, false
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading user, please try again", err)
+		return model.User{}, false
+	}
+	if user.Username == caller {
+		writeError(w, r, http.StatusUnprocessableEntity, codeValidation, message, nil)
+		return model.User{}, false
+	}
+	return user, true
+}
+
+// muteResp converts a stored mute into its API representation
+func muteResp(mute model.Mute) model.MuteResp {
+	return model.MuteResp{
+		ID:        mute.ID,
+		Account:   mute.Account,
+		Word:      mute.Word,
+		CreatedAt: mute.CreatedAt,
+		ExpiresAt: mute.ExpiresAt,
+	}
+}
+
+// viewer is what someone must not be shown: the accounts they block or are blocked by, the
+// accounts they mute, the tweets containing the words they mute and the tweets of protected
+// accounts they do not follow. The zero viewer hides nothing.
+type viewer struct {
+	username string
+	// blocks holds the accounts the viewer blocks, and blockedBy those blocking the viewer
+	blocks     map[string]bool
+	blockedBy  map[string]bool
+	muted      map[string]bool
+	words      []search.Query
+	followings map[string]bool
+	// protected and deactivated cache whether the accounts looked up with lookupAccounts are
+	// protected, and deactivated
+	protected   map[string]bool
+	deactivated map[string]bool
+}
+
+// viewerOf loads what username must not be shown; an empty username is someone logged out
+func (s *Server) viewerOf(ctx context.Context, username string) (viewer, error) {
+	v := viewer{username: username, blocks: make(map[string]bool), blockedBy: make(map[string]bool), muted: make(map[string]bool),
+		followings: make(map[string]bool), protected: make(map[string]bool), deactivated: make(map[string]bool)}
+	if username == "" {
+		return v, nil
+	}
+	followings, err := s.store.Followings(ctx, username)
+	if err != nil {
+		return v, err
+	}
+	for _, following := range followings {
+		v.followings[following] = true
+	}
+	blocks, err := s.store.Blocks(ctx, username)
+	if err != nil {
+		return v, err
+	}
+	for _, block := range blocks {
+		v.blocks[block.Blocked] = true
+	}
+	blockers, err := s.store.BlockedBy(ctx, username)
+	if err != nil {
+		return v, err
+	}
+	for _, blocker := range blockers {
+		v.blockedBy[blocker] = true
+	}
+	mutes, err := s.store.Mutes(ctx, username, time.Now())
+	if err != nil {
+		return v, err
+	}
+	for _, mute := range mutes {
+		if mute.Account != "" {
+			v.muted[mute.Account] = true
+		} else {
+			v.words = append(v.words, search.Muted(mute.Word))
+		}
+	}
+	return v, nil
+}
+
+// lookupAccounts finds out which of the accounts are protected or deactivated, so that the
+// viewer knows whether to hide their tweets. Accounts already looked up are not asked for again.
+func (s *Server) lookupAccounts(ctx context.Context, v viewer, usernames []string) error {
+	if v.protected == nil {
+		return nil
+	}
+	unknown := make([]string, 0)
+	for _, username := range usernames {
+		if _, ok := v.protected[username]; !ok {
+			v.protected[username] = false
+			unknown = append(unknown, username)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	protected, err := s.store.ProtectedAccounts(ctx, unknown)
+	var deactivated []string
+	if err == nil {
+		deactivated, err = s.store.DeactivatedAccounts(ctx, unknown)
+	}
+	if err != nil {
+		for _, username := range unknown {
+			delete(v.protected, username)
+		}
+		return err
+	}
+	for _, username := range protected {
+		v.protected[username] = true
+	}
+	for _, username := range deactivated {
+		v.deactivated[username] = true
+	}
+	return nil
+}
+
+// requestViewer loads what the caller of the request must not be shown, answering with a 500
+// and returning false when that fails
+func (s *Server) requestViewer(w http.ResponseWriter, r *http.Request) (viewer, bool) {
+	var username string
+	if session, ok := currentSession(r); ok {
+		username = session.Username
+	}
+	v, err := s.viewerOf(r.Context(), username)
+	if err != nil {
+		internalError(w, r, "Error while loading who you block and mute, please try again", err)
+		return v, false
+	}
+	return v, true
+}
+
+// blocked reports whether the viewer blocks the account or is blocked by it
+func (v viewer) blocked(username string) bool {
+	return v.blocks[username] || v.blockedBy[username]
+}
+
+// locked reports whether the account is protected and the viewer is not one of its approved
+// followers. Only accounts looked up with lookupAccounts are known to be protected.
+func (v viewer) locked(username string) bool {
+	return v.protected[username] && !v.followings[username] && username != v.username
+}
+
+// hidesAccount reports whether the account's tweets and notifications are kept from the viewer.
+// Only accounts looked up with lookupAccounts are known to be deactivated.
+func (v viewer) hidesAccount(username string) bool {
+	return v.blocked(username) || v.muted[username] || v.deactivated[username]
+}
+
+// hides reports whether the tweet is kept from the viewer. A retweet is hidden when its author
+// is, the tweet it reshares being checked separately. The viewer's own tweets are never hidden.
+func (v viewer) hides(tweet model.Tweet) bool {
+	if tweet.Author == v.username {
+		return false
+	}
+	if v.hidesAccount(tweet.Author) || v.locked(tweet.Author) {
+		return true
+	}
+	for _, q := range v.words {
+		if q.Match(tweet) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAuthor answers with a 403 and returns false when the viewer cannot act on the tweets of
+// author, because of a block or because they are protected from the viewer, and with a 404 when
+// author deactivated their account
+func (s *Server) checkAuthor(w http.ResponseWriter, r *http.Request, v viewer, author string, doing string) bool {
+	if !v.checkBlock(w, r, author, doing) {
+		return false
+	}
+	err := s.lookupAccounts(r.Context(), v, []string{author})
+	if err != nil {
+		internalError(w, r, "Error while checking who can see @"+author+"'s tweets, please try again", err)
+		return false
+	}
+	if v.deactivated[author] {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "@"+author+" deleted their account.", nil)
+		return false
+	}
+	if v.locked(author) {
+		writeError(w, r, http.StatusForbidden, codeProtected, "@"+author+"'s tweets are protected -- only the followers they approved can "+doing+".", nil)
+		return false
+	}
+	return true
+}
+
+// checkBlock answers with a 403 and returns false when the viewer blocks the account or is
+// blocked by it, doing is what the viewer was trying to do
+func (v viewer) checkBlock(w http.ResponseWriter, r *http.Request, username string, doing string) bool {
+	if v.blockedBy[username] {
+		writeError(w, r, http.StatusForbidden, codeBlocked, "@"+username+" has blocked you -- you cannot "+doing+".", nil)
+		return false
+	}
+	if v.blocks[username] {
+		writeError(w, r, http.StatusForbidden, codeBlocked, "You blocked @"+username+" -- unblock them to "+doing+".", nil)
+		return false
+	}
+	return true
+}
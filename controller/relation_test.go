@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+)
+
+// follows reports whether follower follows followee in the store
+func (a *api) follows(follower string, followee string) bool {
+	a.t.Helper()
+	followings, err := a.store.Followings(context.Background(), follower)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	for _, username := range followings {
+		if username == followee {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBlock(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", alice, model.Request{Input: "bob"}), http.StatusOK, nil)
+	tweet := a.tweet(alice, "secret plans")
+
+	a.expect(a.do("POST", "/blocks/bob", alice, nil), http.StatusCreated, nil)
+	if a.follows("bob", "alice") || a.follows("alice", "bob") {
+		t.Error("the block left a follow between alice and bob")
+	}
+	// blocking again clears a follow that slipped in meanwhile
+	err := a.store.Follow(context.Background(), "bob", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.expect(a.do("POST", "/blocks/bob", alice, nil), http.StatusOK, nil)
+	if a.follows("bob", "alice") {
+		t.Error("blocking bob again left his follow")
+	}
+	var blocks model.BlockList
+	a.expect(a.do("GET", "/blocks", alice, nil), http.StatusOK, &blocks)
+	if len(blocks.Blocks) != 1 || blocks.Blocks[0].Username != "bob" {
+		t.Errorf("alice's blocks = %+v, want bob", blocks.Blocks)
+	}
+
+	a.expectError(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusForbidden, codeBlocked)
+	a.expectError(a.do("GET", "/profile/alice", bob, nil), http.StatusForbidden, codeBlocked)
+	a.expectError(a.do("GET", "/users/alice/tweets", bob, nil), http.StatusForbidden, codeBlocked)
+	a.expectError(a.do("POST", "/tweets/"+tweet.ID.String()+"/like", bob, nil), http.StatusForbidden, codeBlocked)
+	a.expectError(a.do("POST", "/tweets/"+tweet.ID.String()+"/replies", bob, model.Request{Input: "hi"}), http.StatusForbidden, codeBlocked)
+	a.expectError(a.do("POST", "/follow", alice, model.Request{Input: "bob"}), http.StatusForbidden, codeBlocked)
+	if texts, _ := a.timeline("/search/tweets?q=plans", bob); len(texts) != 0 {
+		t.Errorf("bob finds %v in search, want nothing", texts)
+	}
+
+	a.expect(a.do("DELETE", "/blocks/bob", alice, nil), http.StatusOK, nil)
+	a.expect(a.do("DELETE", "/blocks/bob", alice, nil), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	if texts, _ := a.timeline("/timeline", bob); !storetest.Equal(texts, []string{"secret plans"}) {
+		t.Errorf("bob's timeline after the unblock = %v", texts)
+	}
+}
+
+func TestMute(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "carol"}), http.StatusOK, nil)
+	a.tweet(alice, "from alice")
+	a.tweet(carol, "the ending was a SPOILER")
+	a.tweet(carol, "from carol")
+
+	a.expect(a.do("POST", "/mutes/alice", bob, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/muted-words", bob, model.MuteRequest{Word: "spoiler"}), http.StatusCreated, nil)
+	if texts, _ := a.timeline("/timeline", bob); !storetest.Equal(texts, []string{"from carol"}) {
+		t.Errorf("bob's timeline = %v, want carol's tweet without the spoiler", texts)
+	}
+	// muting is silent: alice's own listing still shows her tweets, and she is still followed
+	if texts, _ := a.timeline("/users/alice/tweets", bob); !storetest.Equal(texts, []string{"from alice"}) {
+		t.Errorf("alice's tweets as bob sees them = %v", texts)
+	}
+	if !a.follows("bob", "alice") {
+		t.Error("muting alice unfollowed her")
+	}
+	a.expect(a.do("DELETE", "/mutes/alice", bob, nil), http.StatusOK, nil)
+	if texts, _ := a.timeline("/timeline", bob); !storetest.Equal(texts, []string{"from carol", "from alice"}) {
+		t.Errorf("bob's timeline after the unmute = %v", texts)
+	}
+}
+
+func TestHiddenReplies(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	dave := a.signup("dave")
+	root := a.tweet(alice, "root")
+	r1 := a.reply(bob, root, "r1")
+	a.reply(carol, r1, "below r1")
+	a.reply(carol, root, "r2")
+	a.reply(dave, root, "r3 SPOILER")
+
+	a.expect(a.do("POST", "/blocks/bob", alice, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/muted-words", alice, model.MuteRequest{Word: "spoiler"}), http.StatusCreated, nil)
+	// a hidden reply takes its replies with it
+	thread := a.thread(root, "", alice)
+	if got := replyTexts(thread.Tweet); !storetest.Equal(got, []string{"r2"}) {
+		t.Errorf("alice's thread = %v, want r2 alone", got)
+	}
+	if got := replyTexts(a.thread(root, "", carol).Tweet); len(got) != 3 {
+		t.Errorf("carol's thread = %v, want every reply", got)
+	}
+	a.expectError(a.do("GET", "/tweets/"+root.ID.String()+"/thread", bob, nil), http.StatusForbidden, codeBlocked)
+}
+
+func TestHiddenNotifications(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	dave := a.signup("dave")
+	hello := a.tweet(alice, "hello")
+	for _, token := range []string{bob, carol, dave} {
+		a.expect(a.do("POST", "/tweets/"+hello.ID.String()+"/like", token, nil), http.StatusCreated, nil)
+	}
+	a.reply(dave, hello, "@alice big SPOILER")
+
+	a.expect(a.do("POST", "/mutes/bob", alice, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/blocks/carol", alice, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/muted-words", alice, model.MuteRequest{Word: "spoiler"}), http.StatusCreated, nil)
+	want := []string{"@dave liked your tweet"}
+	if got := groupSummaries(a.notifications(alice, "")); !storetest.Equal(got, want) {
+		t.Errorf("alice's notifications = %q, want %q", got, want)
+	}
+}
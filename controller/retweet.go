@@ -0,0 +1,147 @@
+package controller
+
+import (
+	guuid "github.com/google/uuid"
+	"net/http"
+	"strings"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// RetweetHandler Reshares a tweet with your followers
+// Requires: Authorization header, {id} of the tweet to retweet
+// Handled edges: Retweeting a retweet reshares the original, retweeting the same tweet twice is a no-op, and neither side of a block can retweet the other
+func (s *Server) RetweetHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before retweeting!")
+	if !ok {
+		return
+	}
+	original, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, original.Author, "retweet their tweets") {
+		return
+	}
+	retweet := model.Tweet{
+		ID:        guuid.New(),
+		Author:    result.Username,
+		CreatedAt: time.Now(),
+		RetweetOf: &original.ID,
+	}
+	retweet.ConversationID = retweet.ID
+	err := s.publishTweet(r.Context(), retweet)
+	if err == store.ErrDuplicate {
+		res.Result = "You already retweeted @" + original.Author + "'s tweet."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while retweeting, please try again", err)
+		return
+	}
+	res.Result = "Successfully retweeted @" + original.Author + "'s tweet!"
+	writeJSON(w, http.StatusCreated, res)
+	return
+}
+
+// UnretweetHandler Takes back your retweet of a tweet
+// Requires: Authorization header, {id} of the retweeted tweet
+// Handled edges: Undoing a retweet you never made is a no-op
+func (s *Server) UnretweetHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before undoing a retweet!")
+	if !ok {
+		return
+	}
+	original, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	retweet, err := s.store.GetRetweet(r.Context(), result.Username, original.ID)
+	if err == nil {
+		err = s.store.DeleteTweet(r.Context(), result.Username, retweet.ID)
+	}
+	if err == store.ErrNotFound {
+		res.Result = "You have not retweeted @" + original.Author + "'s tweet."
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		internalError(w, r, "Error while undoing the retweet, please try again", err)
+		return
+	}
+	res.Result = "Your retweet of @" + original.Author + "'s tweet is gone."
+	writeJSON(w, http.StatusOK, res)
+	return
+}
+
+// QuoteHandler Posts a tweet commenting on another tweet, which is embedded below it
+// Requires: Authorization header, {id} of the tweet to quote, input
+// Handled edges: Quoting a retweet quotes the original, neither side of a block can quote the other, and the quote should not only contain whitespace
+func (s *Server) QuoteHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	var user model.Request
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before quoting tweets!")
+	if !ok {
+		return
+	}
+	original, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, original.Author, "quote their tweets") {
+		return
+	}
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	if strings.TrimSpace(user.Input) == "" {
+		writeError(w, r, http.StatusUnprocessableEntity, codeValidation, "Aren't you going to say anything about this Tweet? Write something!", nil)
+		return
+	}
+	text, entities, ok := s.tweetText(w, r, user.Input)
+	if !ok {
+		return
+	}
+	tweet := model.Tweet{
+		ID:        guuid.New(),
+		Author:    result.Username,
+		Text:      text,
+		Entities:  entities,
+		CreatedAt: time.Now(),
+		QuoteOf:   &original.ID,
+	}
+	tweet.ConversationID = tweet.ID
+	err := s.publishTweet(r.Context(), tweet)
+	if err != nil {
+		internalError(w, r, "Error while creating tweet, please try again", err)
+		return
+	}
+	res.Result = "Successfully quoted @" + original.Author + "'s tweet (id " + tweet.ID.String() + ")"
+	writeJSON(w, http.StatusCreated, res)
+	return
+}
+
+// originalParam loads the tweet named by the {id} route variable like tweetParam, following
+// retweets to the tweet they reshare
+func (s *Server) originalParam(w http.ResponseWriter, r *http.Request) (model.Tweet, bool) {
+	tweet, ok := s.tweetParam(w, r)
+	if !ok || tweet.RetweetOf == nil {
+		return tweet, ok
+	}
+	original, err := s.store.GetTweet(r.Context(), *tweet.RetweetOf)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeTweetNotFound, "There is no such tweet.", nil)
+		return model.Tweet{}, false
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading the tweet, please try again", err)
+		return model.Tweet{}, false
+	}
+	return original, true
+}
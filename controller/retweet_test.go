@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+)
+
+func TestRetweet(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	dave := a.signup("dave")
+	for _, username := range []string{"bob", "carol"} {
+		a.expect(a.do("POST", "/follow", dave, model.Request{Input: username}), http.StatusOK, nil)
+	}
+	original := a.tweet(alice, "original")
+	path := "/tweets/" + original.ID.String() + "/retweet"
+
+	a.expect(a.do("POST", path, bob, nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", path, bob, nil), http.StatusOK, nil)
+	// retweeting a retweet reshares the original
+	retweet := a.latest(bob)
+	if retweet.RetweetOf == nil || *retweet.RetweetOf != original.ID {
+		t.Fatalf("bob's retweet = %+v, want it to reshare alice's tweet", retweet)
+	}
+	a.expect(a.do("POST", "/tweets/"+retweet.ID.String()+"/retweet", carol, nil), http.StatusCreated, nil)
+
+	// dave sees alice's tweet once, credited to both of the accounts he follows
+	texts, timeline := a.timeline("/timeline", dave)
+	if !storetest.Equal(texts, []string{"original"}) {
+		t.Fatalf("dave's timeline = %v, want the original once", texts)
+	}
+	shown := timeline.Tweets[0]
+	if shown.ID != original.ID || shown.User != "alice" || shown.RetweetCount != 2 ||
+		fmt.Sprint(shown.RetweetedBy) != "[carol bob]" {
+		t.Errorf("retweeted tweet = %+v, want alice's, counted twice and retweeted by carol and bob", shown)
+	}
+
+	a.expect(a.do("DELETE", path, bob, nil), http.StatusOK, nil)
+	a.expect(a.do("DELETE", path, bob, nil), http.StatusOK, nil)
+	_, timeline = a.timeline("/timeline", dave)
+	if len(timeline.Tweets) != 1 || timeline.Tweets[0].RetweetCount != 1 || fmt.Sprint(timeline.Tweets[0].RetweetedBy) != "[carol]" {
+		t.Errorf("timeline after bob's undo = %+v", timeline.Tweets)
+	}
+	_, timeline = a.timeline("/users/bob/tweets", "")
+	if len(timeline.Tweets) != 0 {
+		t.Errorf("bob's tweets after the undo = %+v", timeline.Tweets)
+	}
+
+	// quotes count on the original and embed it
+	a.expect(a.do("POST", "/tweets/"+original.ID.String()+"/quote", bob, model.Request{Input: "so true"}), http.StatusCreated, nil)
+	_, timeline = a.timeline("/users/bob/tweets", "")
+	quote := timeline.Tweets[0]
+	if quote.Text != "so true" || quote.QuotedTweet == nil || quote.QuotedTweet.Text != "original" || quote.QuotedTweet.QuoteCount != 1 {
+		t.Errorf("quote = %+v, want alice's tweet embedded with its quote counted", quote)
+	}
+	a.expectError(a.do("POST", "/tweets/"+original.ID.String()+"/quote", bob, model.Request{Input: "  "}), http.StatusUnprocessableEntity, codeValidation)
+
+	// retweets go away with the tweet they reshare
+	a.expect(a.do("POST", "/untweet", alice, model.Request{Input: original.ID.String()}), http.StatusOK, nil)
+	_, timeline = a.timeline("/users/carol/tweets", "")
+	if len(timeline.Tweets) != 0 {
+		t.Errorf("carol's tweets after the original was deleted = %+v", timeline.Tweets)
+	}
+	_, timeline = a.timeline("/users/bob/tweets", "")
+	if len(timeline.Tweets) != 1 || timeline.Tweets[0].QuotedTweet != nil {
+		t.Errorf("bob's quote after the original was deleted = %+v, want it without the embed", timeline.Tweets)
+	}
+	a.expectError(a.do("POST", path, bob, nil), http.StatusNotFound, codeTweetNotFound)
+	a.expectError(a.do("POST", path, "", nil), http.StatusUnauthorized, codeUnauthorized)
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"net/http"
+	"twitter-feed/model"
+	"twitter-feed/search"
+)
+
+// SearchTweetsHandler Finds tweets matching a query, newest first or most relevant first
+// Requires: q query parameter, optional sort (recent or relevance), limit and cursor query parameters
+// Handled edges: q supports words, "phrases", #hashtags, -exclusions, from:, since: and until:, retweets are never returned, and blocked or muted accounts and muted words are left out
+func (s *Server) SearchTweetsHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.searchQuery(w, r)
+	if !ok {
+		return
+	}
+	switch r.URL.Query().Get("sort") {
+	case "", search.Recent:
+		s.recentSearch(w, r, q)
+	case search.Relevance:
+		s.rankedSearch(w, r, q)
+	default:
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid sort -- it must be recent or relevance.", nil)
+	}
+	return
+}
+
+// SearchUsersHandler Finds accounts by the start of their username, first name or last name
+// Requires: q query parameter, optional limit and cursor query parameters
+// Handled edges: Every word of q has to start one of the names, exact username matches come first, and accounts on either side of a block are left out
+func (s *Server) SearchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	prefixes := search.Words(r.URL.Query().Get("q"))
+	if len(prefixes) == 0 {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "What are you looking for? Pass some words in q.", nil)
+		return
+	}
+	offset, limit, err := parseRanked(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	users, err := s.store.SearchUsers(r.Context(), prefixes, offset, limit+1)
+	if err != nil {
+		internalError(w, r, "Error while searching, please try again", err)
+		return
+	}
+	var resp model.UserPage
+	resp.NextCursor, resp.PrevCursor = rankedCursors(len(users), offset, limit)
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	resp.Users = make([]model.PublicProfile, 0, len(users))
+	for _, user := range users {
+		if v.blocked(user.Username) {
+			continue
+		}
+		profile, err := s.publicProfile(r, user)
+		if err != nil {
+			internalError(w, r, "Error while searching, please try again", err)
+			return
+		}
+		resp.Users = append(resp.Users, profile)
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return
+}
+
+// searchQuery parses the q query parameter and spells the from: accounts like the accounts do,
+// answering with a 400 and returning false when it cannot be parsed
+func (s *Server) searchQuery(w http.ResponseWriter, r *http.Request) (search.Query, bool) {
+	q, err := search.Parse(r.URL.Query().Get("q"))
+	if err == search.ErrEmpty {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "What are you looking for? Pass some words in q.", nil)
+		return q, false
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid since: or until: -- dates must look like 2006-01-02.", nil)
+		return q, false
+	}
+	if len(q.From) > 0 {
+		usernames, err := s.store.Usernames(r.Context(), q.From)
+		if err != nil {
+			internalError(w, r, "Error while searching, please try again", err)
+			return q, false
+		}
+		for i, name := range q.From {
+			if username, ok := usernames[name]; ok {
+				q.From[i] = username
+			}
+		}
+	}
+	return q, true
+}
+
+func (s *Server) recentSearch(w http.ResponseWriter, r *http.Request, q search.Query) {
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	tweets, err := s.store.SearchTweets(r.Context(), q, page)
+	if err != nil {
+		internalError(w, r, "Error while searching, please try again", err)
+		return
+	}
+	timeline, err := s.tweetPage(r.Context(), v, tweets, page, limit)
+	if err != nil {
+		internalError(w, r, "Error while searching, please try again", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+func (s *Server) rankedSearch(w http.ResponseWriter, r *http.Request, q search.Query) {
+	offset, limit, err := parseRanked(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	tweets, err := s.store.RankTweets(r.Context(), q, offset, limit+1)
+	if err != nil {
+		internalError(w, r, "Error while searching, please try again", err)
+		return
+	}
+	var timeline model.Timeline
+	timeline.NextCursor, timeline.PrevCursor = rankedCursors(len(tweets), offset, limit)
+	if len(tweets) > limit {
+		tweets = tweets[:limit]
+	}
+	timeline.Tweets, err = s.tweetResps(r.Context(), v, tweets)
+	if err != nil {
+		internalError(w, r, "Error while searching, please try again", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
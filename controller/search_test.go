@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+)
+
+func TestSearch(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	a.signup("alicia")
+	a.tweet(alice, "Learning Go today")
+	a.tweet(bob, "go go go")
+	a.tweet(bob, "rust today")
+	search := func(query string) string { return "/search/tweets?q=" + url.QueryEscape(query) }
+
+	if texts, _ := a.timeline(search("go"), ""); !storetest.Equal(texts, []string{"go go go", "Learning Go today"}) {
+		t.Errorf("recent search = %v", texts)
+	}
+	// from: takes usernames in any letter case
+	if texts, _ := a.timeline(search("from:ALICE today"), ""); !storetest.Equal(texts, []string{"Learning Go today"}) {
+		t.Errorf("search from alice = %v", texts)
+	}
+	texts, timeline := a.timeline(search("today")+"&sort=relevance&limit=1", "")
+	if len(texts) != 1 || timeline.NextCursor == "" {
+		t.Fatalf("first ranked page = %v, next %q", texts, timeline.NextCursor)
+	}
+	more, timeline := a.timeline(search("today")+"&sort=relevance&limit=1&cursor="+url.QueryEscape(timeline.NextCursor), "")
+	if len(more) != 1 || more[0] == texts[0] || timeline.NextCursor != "" || timeline.PrevCursor == "" {
+		t.Errorf("second ranked page = %v after %v, next %q", more, texts, timeline.NextCursor)
+	}
+
+	a.expectError(a.do("GET", search(""), "", nil), http.StatusBadRequest, codeBadRequest)
+	a.expectError(a.do("GET", search("-go"), "", nil), http.StatusBadRequest, codeBadRequest)
+	a.expectError(a.do("GET", search("go since:june"), "", nil), http.StatusBadRequest, codeBadRequest)
+	a.expectError(a.do("GET", search("go")+"&sort=popular", "", nil), http.StatusBadRequest, codeBadRequest)
+
+	var users model.UserPage
+	a.expect(a.do("GET", "/search/users?q=ALI&limit=1", "", nil), http.StatusOK, &users)
+	if len(users.Users) != 1 || users.Users[0].Username != "alice" || users.NextCursor == "" {
+		t.Fatalf("user search = %+v", users)
+	}
+	var next model.UserPage
+	a.expect(a.do("GET", "/search/users?q=ALI&limit=1&cursor="+url.QueryEscape(users.NextCursor), "", nil), http.StatusOK, &next)
+	if len(next.Users) != 1 || next.Users[0].Username != "alicia" || next.NextCursor != "" {
+		t.Errorf("second page of the user search = %+v", next)
+	}
+	a.expectError(a.do("GET", "/search/users?q=%20", "", nil), http.StatusBadRequest, codeBadRequest)
+}
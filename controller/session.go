@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// sessionTTL is how long a bearer token stays valid after login
+const sessionTTL = 7 * 24 * time.Hour
+
+type contextKey int
+
+const (
+	sessionKey contextKey = iota
+	requestIDKey
+)
+
+// hashToken returns the hex SHA-256 of a bearer token, which is what gets stored server-side
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createSession issues a new random bearer token for the user and stores its session.
+// Every login gets its own session, so a user can be logged in from several devices at once.
+func (s *Server) createSession(username string, r *http.Request) (string, model.Session, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", model.Session{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+	session := model.Session{
+		ID:        hashToken(token),
+		Username:  username,
+		UserAgent: r.UserAgent(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionTTL),
+	}
+	err := s.store.CreateSession(r.Context(), session)
+	if err != nil {
+		return "", model.Session{}, err
+	}
+	return token, session, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// QueryToken lets clients that cannot set headers, such as browsers opening an EventSource or a
+// WebSocket, pass their token in the access_token query parameter. Use it before Authenticate.
+func QueryToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		if token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Authenticate resolves the caller's session from the Authorization header and stores it in the request context.
+// Requests without a token pass through anonymously; requests with an unknown or expired token are rejected.
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		session, err := s.store.GetSession(r.Context(), hashToken(token))
+		if err == store.ErrNotFound {
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Your session is invalid or has expired -- Please log in again.", nil)
+			return
+		}
+		if err != nil {
+			internalError(w, r, "Error while checking your session, please try again", err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), sessionKey, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// currentSession returns the session resolved by Authenticate, if any
+func currentSession(r *http.Request) (model.Session, bool) {
+	session, ok := r.Context().Value(sessionKey).(model.Session)
+	return session, ok
+}
+
+// requireUser looks up the authenticated caller's user document. When there is no valid caller
+// it answers with a 401 carrying message, or a 500 if the lookup fails, and returns false.
+func (s *Server) requireUser(w http.ResponseWriter, r *http.Request, message string) (model.User, bool) {
+	session, ok := currentSession(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, message, nil)
+		return model.User{}, false
+	}
+	result, err := s.store.GetUser(r.Context(), session.Username)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, message, nil)
+		return model.User{}, false
+	}
+	if err != nil {
+		internalError(w, r, "Error while checking your session, please try again", err)
+		return model.User{}, false
+	}
+	return result, true
+}
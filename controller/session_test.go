@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"twitter-feed/model"
+)
+
+func TestSessions(t *testing.T) {
+	a := newAPI(t)
+	a.register("alice")
+	rec := a.do("POST", "/login", "", model.Request{Username: "alice", Password: "wrong-password"})
+	a.expectError(rec, http.StatusUnauthorized, codeInvalidCredentials)
+
+	phone := a.login("alice")
+	laptop := a.login("alice")
+	if phone == laptop {
+		t.Fatal("two logins got the same token")
+	}
+	var self model.SelfProfile
+	a.expect(a.do("GET", "/profile/alice", phone, nil), http.StatusOK, &self)
+	if len(self.Sessions) != 2 || !self.Sessions[0].Current || self.Sessions[1].Current {
+		t.Errorf("alice's sessions = %+v, want the phone's and then the laptop's", self.Sessions)
+	}
+
+	a.expect(a.do("POST", "/logout", phone, nil), http.StatusOK, nil)
+	a.expectError(a.do("POST", "/tweet", phone, model.Request{Input: "hi"}), http.StatusUnauthorized, codeUnauthorized)
+	a.expect(a.do("POST", "/tweet", laptop, model.Request{Input: "hi"}), http.StatusCreated, nil)
+	a.expectError(a.do("POST", "/tweet", "not-a-token", model.Request{Input: "hi"}), http.StatusUnauthorized, codeUnauthorized)
+
+	// deleting the account logs it out everywhere
+	a.expect(a.do("POST", "/delete", laptop, model.Request{Password: testPassword}), http.StatusAccepted, nil)
+	a.expectError(a.do("POST", "/tweet", laptop, model.Request{Input: "hi"}), http.StatusUnauthorized, codeUnauthorized)
+}
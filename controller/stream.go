@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/stream"
+)
+
+// sseRetry is how soon EventSource clients reconnect once a stream ends
+const sseRetry = 2 * time.Second
+
+// socketWriteWait bounds how long writing one WebSocket message may take
+const socketWriteWait = 10 * time.Second
+
+// streamWorkers is how many goroutines push new tweets to streams
+const streamWorkers = 2
+
+// streamQueue is how many new tweets can wait to be pushed before posting blocks
+const streamQueue = 256
+
+// streamer pushes new tweets to streams off the request path: what each recipient sees depends
+// on whom they block and mute, which takes a few store calls per connected recipient
+type streamer struct {
+	tweets  chan model.Tweet
+	workers sync.WaitGroup
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// upgrader accepts WebSocket handshakes. Its default origin check turns away pages of other
+// sites, while clients that send no Origin, such as apps, are let through.
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// StreamTimelineHandler Streams new tweets for the caller's home timeline, new notifications and new direct messages as server-sent events
+// Requires: Authorization header or access_token query parameter, optional Last-Event-ID header or last_event_id query parameter
+// Handled edges: Reconnecting with the last event ID replays what was missed, or sends a reset event when that is no longer known
+func (s *Server) StreamTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to stream your timeline!")
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internalError(w, r, "Streaming is not supported on this connection", errors.New("response writer cannot flush"))
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	sub, ok := s.subscribe(w, r, result.Username, lastID)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+	opts := s.stream.Options()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keep proxies such as nginx from holding events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry/time.Millisecond)
+	for _, event := range sub.Replay() {
+		if err == nil {
+			err = writeEvent(w, event)
+		}
+	}
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(opts.Heartbeat)
+	defer heartbeat.Stop()
+	var expired <-chan time.Time
+	if opts.Lifetime > 0 {
+		timer := time.NewTimer(opts.Lifetime)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			err = writeEvent(w, event)
+			if reset, missed := sub.Missed(); missed && err == nil {
+				err = writeEvent(w, reset)
+			}
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		case <-expired:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// StreamSocketHandler Streams the same events as /stream/timeline over a WebSocket, one JSON message per event
+// Requires: Authorization header or access_token query parameter, optional last_event_id query parameter
+// Handled edges: Clients that stop answering pings are disconnected, and messages sent by clients are ignored
+func (s *Server) StreamSocketHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate to stream your timeline!")
+	if !ok {
+		return
+	}
+	sub, ok := s.subscribe(w, r, result.Username, r.URL.Query().Get("last_event_id"))
+	if !ok {
+		return
+	}
+	defer sub.Close()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the client
+		return
+	}
+	defer conn.Close()
+	heartbeat := s.stream.Options().Heartbeat
+
+	// clients only ever send pongs and close frames, which are handled while reading
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	send := func(event stream.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+		return conn.WriteJSON(event)
+	}
+	for _, event := range sub.Replay() {
+		if send(event) != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				code := websocket.CloseGoingAway
+				if sub.Err() == stream.ErrSlow {
+					code = websocket.CloseTryAgainLater
+				}
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(socketWriteWait))
+				return
+			}
+			err = send(event)
+			if reset, missed := sub.Missed(); missed && err == nil {
+				err = send(reset)
+			}
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+		case <-gone:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// subscribe subscribes username to the hub, resuming after lastID when it is set. It answers
+// with an error and returns false when the ID is invalid or the hub cannot take subscribers.
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request, username string, lastID string) (*stream.Subscription, bool) {
+	if s.stream == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "Streaming is not enabled on this server.", nil)
+		return nil, false
+	}
+	var id uint64
+	if lastID != "" {
+		var err error
+		id, err = strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid last event ID -- it must be the id of an event from a previous stream.", nil)
+			return nil, false
+		}
+	}
+	sub, err := s.stream.Subscribe(username, id, lastID != "")
+	if err != nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "The server is shutting down, please reconnect in a moment.", nil)
+		return nil, false
+	}
+	return sub, true
+}
+
+// writeEvent writes one server-sent event; JSON data never spans several lines
+func writeEvent(w io.Writer, event stream.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Kind, event.Data)
+	return err
+}
+
+// startStreaming launches the workers that push new tweets to streams
+func (s *Server) startStreaming() {
+	s.streamer = &streamer{tweets: make(chan model.Tweet, streamQueue)}
+	for i := 0; i < streamWorkers; i++ {
+		s.streamer.workers.Add(1)
+		go func() {
+			defer s.streamer.workers.Done()
+			for tweet := range s.streamer.tweets {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				s.streamTweet(ctx, tweet)
+				cancel()
+			}
+		}()
+	}
+}
+
+// stopStreaming refuses new tweets and waits for the queued ones to be pushed or for ctx to expire
+func (s *Server) stopStreaming(ctx context.Context) error {
+	s.streamer.mu.Lock()
+	if !s.streamer.stopped {
+		s.streamer.stopped = true
+		close(s.streamer.tweets)
+	}
+	s.streamer.mu.Unlock()
+	drained := make(chan struct{})
+	go func() {
+		s.streamer.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queueTweet hands a new tweet to the streaming workers, waiting for room in the queue until ctx
+// expires. Failures are only logged, since the tweet itself was saved.
+func (s *Server) queueTweet(ctx context.Context, tweet model.Tweet) {
+	if s.streamer == nil || !s.stream.Active() {
+		return
+	}
+	s.streamer.mu.RLock()
+	defer s.streamer.mu.RUnlock()
+	if s.streamer.stopped {
+		return
+	}
+	select {
+	case s.streamer.tweets <- tweet:
+	case <-ctx.Done():
+		log.Printf("stream: queueing tweet %s: %v", tweet.ID, ctx.Err())
+	}
+}
+
+// streamTweet pushes a new tweet to the connected followers whose home timeline shows it, unless
+// they mute its author or its words. Failures are only logged, since the tweet itself was saved.
+func (s *Server) streamTweet(ctx context.Context, tweet model.Tweet) {
+	if !s.stream.Active() {
+		return
+	}
+	// the connected users are few next to the followers a popular account has, so each of them
+	// is asked about instead of loading every follower
+	recipients := make([]string, 0)
+	for _, listener := range s.stream.AllListeners() {
+		if listener == tweet.Author {
+			continue
+		}
+		follows, err := s.store.Follows(ctx, listener, tweet.Author)
+		if err != nil {
+			log.Printf("stream: checking whether %s follows %s: %v", listener, tweet.Author, err)
+			return
+		}
+		// like home timelines, a reply only reaches those who also follow the account replied to
+		if follows && tweet.InReplyToUser != "" && tweet.InReplyToUser != tweet.Author {
+			follows, err = s.store.Follows(ctx, listener, tweet.InReplyToUser)
+			if err != nil {
+				log.Printf("stream: checking whether %s follows %s: %v", listener, tweet.InReplyToUser, err)
+				return
+			}
+		}
+		if follows {
+			recipients = append(recipients, listener)
+		}
+	}
+	// what each recipient blocks and mutes decides whether they get the tweet, and whether it
+	// comes with the tweet it quotes
+	for _, recipient := range recipients {
+		v, err := s.viewerOf(ctx, recipient)
+		if err != nil {
+			log.Printf("stream: loading who %s blocks and mutes: %v", recipient, err)
+			continue
+		}
+		resps, err := s.tweetResps(ctx, v, []model.Tweet{tweet})
+		if err != nil {
+			log.Printf("stream: loading tweet %s: %v", tweet.ID, err)
+			return
+		}
+		if len(resps) == 0 {
+			continue
+		}
+		data, err := json.Marshal(resps[0])
+		if err != nil {
+			log.Printf("stream: encoding tweet %s: %v", tweet.ID, err)
+			return
+		}
+		s.stream.Publish([]string{recipient}, stream.KindTweet, data)
+	}
+}
+
+// streamNotifications pushes stored notifications to their connected recipients, each shaped
+// like a group of /notifications. Those that /notifications would leave out for the recipient,
+// whose viewer is looked up in viewers, are not pushed.
+func (s *Server) streamNotifications(ctx context.Context, notifications []model.Notification, viewers map[string]viewer) {
+	if s.stream == nil {
+		return
+	}
+	for _, notification := range notifications {
+		if !s.stream.Listening(notification.Recipient) {
+			continue
+		}
+		groups, err := s.notificationGroups(ctx, viewers[notification.Recipient], []model.Notification{notification})
+		if err != nil {
+			log.Printf("stream: loading notification %s: %v", notification.ID, err)
+			continue
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		data, err := json.Marshal(groups[0])
+		if err != nil {
+			log.Printf("stream: encoding notification %s: %v", notification.ID, err)
+			continue
+		}
+		s.stream.Publish([]string{notification.Recipient}, stream.KindNotification, data)
+	}
+}
+
+// streamMessage pushes a new direct message to the connected participants of its conversation,
+// the sender's other devices included
+func (s *Server) streamMessage(ctx context.Context, conversation model.Conversation, message model.MessageResp) {
+	if s.stream == nil {
+		return
+	}
+	recipients := s.stream.Listeners(conversation.Participants)
+	if len(recipients) == 0 {
+		return
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("stream: encoding message %s: %v", message.ID, err)
+		return
+	}
+	s.stream.Publish(recipients, stream.KindMessage, data)
+}
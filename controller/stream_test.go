@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+	"twitter-feed/stream"
+)
+
+// streamed returns the texts of the tweets waiting on the subscription, sorted since several
+// workers push them
+func streamed(t *testing.T, sub *stream.Subscription) []string {
+	t.Helper()
+	out := make([]string, 0)
+	for {
+		select {
+		case event := <-sub.Events():
+			if event.Kind != stream.KindTweet {
+				continue
+			}
+			var tweet model.TweetResp
+			err := json.Unmarshal(event.Data, &tweet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, tweet.Text)
+		default:
+			sort.Strings(out)
+			return out
+		}
+	}
+}
+
+func TestStreamTweets(t *testing.T) {
+	hub := stream.New(stream.DefaultOptions)
+	a := newAPI(t, WithStream(hub))
+	tokens := make(map[string]string)
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		tokens[username] = a.signup(username)
+	}
+	a.expect(a.do("POST", "/follow", tokens["bob"], model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", tokens["carol"], model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", tokens["carol"], model.Request{Input: "dave"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/mutes/alice", tokens["dave"], nil), http.StatusCreated, nil)
+	a.expect(a.do("POST", "/follow", tokens["dave"], model.Request{Input: "alice"}), http.StatusOK, nil)
+	subs := make(map[string]*stream.Subscription)
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		sub, err := hub.Subscribe(username, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+		subs[username] = sub
+	}
+
+	hello := a.tweet(tokens["alice"], "hello")
+	// only carol follows dave as well as alice
+	a.reply(tokens["alice"], a.tweet(tokens["dave"], "from dave"), "to dave")
+	a.reply(tokens["alice"], hello, "to myself")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := a.server.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"alice": {},
+		"bob":   {"hello", "to myself"},
+		"carol": {"from dave", "hello", "to dave", "to myself"},
+		// dave follows alice but mutes her
+		"dave": {},
+	}
+	for username, sub := range subs {
+		if got := streamed(t, sub); !storetest.Equal(got, want[username]) {
+			t.Errorf("%s was streamed %q, want %q", username, got, want[username])
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// testPassword satisfies validation.DefaultPolicy
+const testPassword = "password1"
+
+// api drives a Server over an in-memory store through its routes
+type api struct {
+	t       *testing.T
+	store   *store.Memory
+	server  *Server
+	handler http.Handler
+}
+
+// newAPI returns an api over an empty store. Passwords are hashed at the lowest cost to keep
+// tests fast.
+func newAPI(t *testing.T, opts ...Option) *api {
+	return newAPIOver(t, store.NewMemory(), opts...)
+}
+
+// newAPIOver returns an api over st, for tests that share the store with a background service
+func newAPIOver(t *testing.T, st *store.Memory, opts ...Option) *api {
+	s := NewServer(st, append([]Option{WithBcryptCost(bcrypt.MinCost)}, opts...)...)
+	return &api{t: t, store: st, server: s, handler: routes(s)}
+}
+
+// routes mirrors the router main builds
+func routes(s *Server) http.Handler {
+	r := mux.NewRouter()
+	r.NotFoundHandler = RequestID(http.HandlerFunc(NotFoundHandler))
+	r.MethodNotAllowedHandler = RequestID(http.HandlerFunc(MethodNotAllowedHandler))
+	r.Use(RequestID, Recover, s.Authenticate)
+	r.HandleFunc("/register", s.RegisterHandler).Methods("POST")
+	r.HandleFunc("/login", s.LoginHandler).Methods("POST")
+	r.HandleFunc("/logout", s.LogoutHandler).Methods("POST")
+	r.HandleFunc("/follow", s.FollowHandler).Methods("POST")
+	r.HandleFunc("/unfollow", s.UnfollowHandler).Methods("POST")
+	r.HandleFunc("/tweet", s.TweetHandler).Methods("POST")
+	r.HandleFunc("/profile/{username}", s.ProfileHandler).Methods("GET")
+	r.HandleFunc("/timeline", s.TimelineHandler).Methods("GET")
+	r.HandleFunc("/users/{username}/tweets", s.UserTweetsHandler).Methods("GET")
+	r.HandleFunc("/tweets/{id}/replies", s.ReplyHandler).Methods("POST")
+	r.HandleFunc("/tweets/{id}/thread", s.ThreadHandler).Methods("GET")
+	r.HandleFunc("/tweets/{id}/retweet", s.RetweetHandler).Methods("POST")
+	r.HandleFunc("/tweets/{id}/retweet", s.UnretweetHandler).Methods("DELETE")
+	r.HandleFunc("/tweets/{id}/quote", s.QuoteHandler).Methods("POST")
+	r.HandleFunc("/tweets/{id}/like", s.LikeHandler).Methods("POST")
+	r.HandleFunc("/tweets/{id}/like", s.UnlikeHandler).Methods("DELETE")
+	r.HandleFunc("/tweets/{id}/likes", s.TweetLikesHandler).Methods("GET")
+	r.HandleFunc("/users/{username}/likes", s.UserLikesHandler).Methods("GET")
+	r.HandleFunc("/users/{username}/followers", s.FollowersHandler).Methods("GET")
+	r.HandleFunc("/users/{username}/following", s.FollowingHandler).Methods("GET")
+	r.HandleFunc("/search/tweets", s.SearchTweetsHandler).Methods("GET")
+	r.HandleFunc("/search/users", s.SearchUsersHandler).Methods("GET")
+	r.HandleFunc("/notifications", s.NotificationsHandler).Methods("GET")
+	r.HandleFunc("/notifications/read", s.ReadNotificationsHandler).Methods("POST")
+	r.HandleFunc("/mentions", s.MentionsHandler).Methods("GET")
+	r.HandleFunc("/dm/conversations", s.CreateConversationHandler).Methods("POST")
+	r.HandleFunc("/dm/conversations", s.ConversationsHandler).Methods("GET")
+	r.HandleFunc("/dm/conversations/{id}/messages", s.SendMessageHandler).Methods("POST")
+	r.HandleFunc("/dm/conversations/{id}/messages", s.MessagesHandler).Methods("GET")
+	r.HandleFunc("/dm/conversations/{id}/read", s.ReadConversationHandler).Methods("POST")
+	r.HandleFunc("/dm/settings", s.DMSettingsHandler).Methods("GET")
+	r.HandleFunc("/dm/settings", s.UpdateDMSettingsHandler).Methods("POST")
+	r.HandleFunc("/blocks", s.BlocksHandler).Methods("GET")
+	r.HandleFunc("/blocks/{username}", s.BlockHandler).Methods("POST")
+	r.HandleFunc("/blocks/{username}", s.UnblockHandler).Methods("DELETE")
+	r.HandleFunc("/mutes", s.MutesHandler).Methods("GET")
+	r.HandleFunc("/mutes/{username}", s.MuteHandler).Methods("POST")
+	r.HandleFunc("/mutes/{username}", s.UnmuteHandler).Methods("DELETE")
+	r.HandleFunc("/muted-words", s.MuteWordHandler).Methods("POST")
+	r.HandleFunc("/muted-words/{id}", s.UnmuteWordHandler).Methods("DELETE")
+	r.HandleFunc("/follow-requests", s.FollowRequestsHandler).Methods("GET")
+	r.HandleFunc("/follow-requests/{username}/accept", s.AcceptFollowRequestHandler).Methods("POST")
+	r.HandleFunc("/follow-requests/{username}/reject", s.RejectFollowRequestHandler).Methods("POST")
+	r.HandleFunc("/settings/privacy", s.PrivacySettingsHandler).Methods("GET")
+	r.HandleFunc("/settings/privacy", s.UpdatePrivacySettingsHandler).Methods("POST")
+	r.HandleFunc("/delete", s.DeleteHandler).Methods("POST")
+	r.HandleFunc("/untweet", s.UntweetHandler).Methods("POST")
+	return r
+}
+
+// do sends a request as the owner of token, or anonymously when it is empty, with body encoded
+// as JSON unless it is nil
+func (a *api) do(method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect fails the test unless rec has the status, and decodes its body into v unless v is nil
+func (a *api) expect(rec *httptest.ResponseRecorder, status int, v interface{}) {
+	a.t.Helper()
+	if rec.Code != status {
+		a.t.Fatalf("got status %d, want %d: %s", rec.Code, status, strings.TrimSpace(rec.Body.String()))
+	}
+	if v != nil {
+		err := json.Unmarshal(rec.Body.Bytes(), v)
+		if err != nil {
+			a.t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+	}
+}
+
+// expectError fails the test unless rec is an error response with the status and code
+func (a *api) expectError(rec *httptest.ResponseRecorder, status int, code string) {
+	a.t.Helper()
+	var body model.APIError
+	a.expect(rec, status, &body)
+	if body.Code != code {
+		a.t.Fatalf("got error code %q, want %q: %s", body.Code, code, body.Message)
+	}
+}
+
+func (a *api) register(username string) {
+	a.t.Helper()
+	rec := a.do("POST", "/register", "", model.Request{Username: username, FirstName: "F" + username, LastName: "L" + username, Password: testPassword})
+	a.expect(rec, http.StatusCreated, nil)
+}
+
+// login logs username in and returns the bearer token of the new session
+func (a *api) login(username string) string {
+	a.t.Helper()
+	var result model.LoginResult
+	a.expect(a.do("POST", "/login", "", model.Request{Username: username, Password: testPassword}), http.StatusOK, &result)
+	return result.Token
+}
+
+// signup registers username and logs them in
+func (a *api) signup(username string) string {
+	a.t.Helper()
+	a.register(username)
+	return a.login(username)
+}
+
+// tweet posts text as the owner of token and returns the tweet as stored
+func (a *api) tweet(token string, text string) model.Tweet {
+	a.t.Helper()
+	a.expect(a.do("POST", "/tweet", token, model.Request{Input: text}), http.StatusCreated, nil)
+	return a.latest(token)
+}
+
+// reply posts text as the owner of token in reply to parent and returns the reply as stored
+func (a *api) reply(token string, parent model.Tweet, text string) model.Tweet {
+	a.t.Helper()
+	a.expect(a.do("POST", "/tweets/"+parent.ID.String()+"/replies", token, model.Request{Input: text}), http.StatusCreated, nil)
+	return a.latest(token)
+}
+
+// latest returns the newest tweet of the owner of token
+func (a *api) latest(token string) model.Tweet {
+	a.t.Helper()
+	session, err := a.store.GetSession(context.Background(), hashToken(token))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	tweets, err := a.store.TweetsByAuthor(context.Background(), session.Username)
+	if err != nil || len(tweets) == 0 {
+		a.t.Fatalf("loading the new tweet: %v", err)
+	}
+	return tweets[len(tweets)-1]
+}
+
+// timeline returns the texts of the tweets on a page of a listing
+func (a *api) timeline(path string, token string) ([]string, model.Timeline) {
+	a.t.Helper()
+	var timeline model.Timeline
+	a.expect(a.do("GET", path, token, nil), http.StatusOK, &timeline)
+	texts := make([]string, 0, len(timeline.Tweets))
+	for _, tweet := range timeline.Tweets {
+		texts = append(texts, tweet.Text)
+	}
+	return texts, timeline
+}
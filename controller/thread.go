@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	guuid "github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+)
+
+// ReplyHandler Replies to a tweet, joining its conversation
+// Requires: Authorization header, {id} of the tweet to reply to, input
+// Handled edges: User should be logged in to reply, the tweet must exist and its author must not block or be blocked by the caller, and the reply should not only contain whitespace
+func (s *Server) ReplyHandler(w http.ResponseWriter, r *http.Request) {
+	var res model.ResponseResult
+	var user model.Request
+	result, ok := s.requireUser(w, r, "You are not logged in -- Please authenticate before replying!")
+	if !ok {
+		return
+	}
+	parent, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok || !s.checkAuthor(w, r, v, parent.Author, "reply to their tweets") {
+		return
+	}
+	if !decodeBody(w, r, &user) {
+		return
+	}
+	if strings.TrimSpace(user.Input) == "" {
+		writeError(w, r, http.StatusUnprocessableEntity, codeValidation, "Aren't you going to say anything in your reply? Write something!", nil)
+		return
+	}
+	text, entities, ok := s.tweetText(w, r, user.Input)
+	if !ok {
+		return
+	}
+	tweet := model.Tweet{
+		ID:             guuid.New(),
+		Author:         result.Username,
+		Text:           text,
+		Entities:       entities,
+		CreatedAt:      time.Now(),
+		InReplyToID:    &parent.ID,
+		InReplyToUser:  parent.Author,
+		ConversationID: parent.Conversation(),
+	}
+	err := s.publishTweet(r.Context(), tweet)
+	if err != nil {
+		internalError(w, r, "Error while creating reply, please try again", err)
+		return
+	}
+	res.Result = "Successfully replied to @" + parent.Author + " (id " + tweet.ID.String() + ")"
+	writeJSON(w, http.StatusCreated, res)
+	return
+}
+
+// ThreadHandler Displays the reply tree below a tweet, along with the tweet that started its conversation
+// Requires: {id} in request, optional depth, limit and cursor query parameters
+// Handled edges: limit applies to every level of the tree, cursor pages through the direct replies of {id}, tweets of deleted accounts are not found, and replies the caller must not see are left out
+func (s *Server) ThreadHandler(w http.ResponseWriter, r *http.Request) {
+	page, limit, err := parsePage(r)
+	if err != nil {
+		pageError(w, r, err)
+		return
+	}
+	depth := defaultThreadDepth
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		depth, err = strconv.Atoi(raw)
+		if err != nil || depth < 0 {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid depth -- it must be a number between 0 and "+strconv.Itoa(maxThreadDepth)+".", nil)
+			return
+		}
+		if depth > maxThreadDepth {
+			depth = maxThreadDepth
+		}
+	}
+	tweet, ok := s.originalParam(w, r)
+	if !ok {
+		return
+	}
+	v, ok := s.requestViewer(w, r)
+	if !ok {
+		return
+	}
+	if v.blockedBy[tweet.Author] {
+		writeError(w, r, http.StatusForbidden, codeBlocked, "@"+tweet.Author+" has blocked you -- you cannot see their tweets.", nil)
+		return
+	}
+	err = s.lookupAccounts(r.Context(), v, []string{tweet.Author})
+	if err != nil {
+		internalError(w, r, "Error while loading the thread, please try again", err)
+		return
+	}
+	if v.deactivated[tweet.Author] {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "@"+tweet.Author+" deleted their account.", nil)
+		return
+	}
+	if v.locked(tweet.Author) {
+		writeError(w, r, http.StatusForbidden, codeProtected, "@"+tweet.Author+"'s tweets are protected -- only the followers they approved can see them.", nil)
+		return
+	}
+	var thread model.Thread
+	if conversation := tweet.Conversation(); conversation != tweet.ID {
+		root, err := s.store.GetTweet(r.Context(), conversation)
+		if err == nil {
+			err = s.lookupAccounts(r.Context(), v, []string{root.Author})
+		}
+		if err == nil && !v.hides(root) {
+			resp := tweetResp(root)
+			thread.Root = &resp
+		} else if err != nil && err != store.ErrNotFound {
+			internalError(w, r, "Error while loading the thread, please try again", err)
+			return
+		}
+	}
+	thread.Tweet, err = s.replyTree(r.Context(), v, tweet, page, limit, depth)
+	if err != nil {
+		internalError(w, r, "Error while loading the thread, please try again", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, thread)
+	return
+}
+
+// tweetParam loads the tweet named by the {id} route variable, answering with a 404 and
+// returning false when there is no such tweet
+func (s *Server) tweetParam(w http.ResponseWriter, r *http.Request) (model.Tweet, bool) {
+	id, err := guuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, codeTweetNotFound, "There is no such tweet.", nil)
+		return model.Tweet{}, false
+	}
+	tweet, err := s.store.GetTweet(r.Context(), id)
+	if err == store.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeTweetNotFound, "There is no such tweet.", nil)
+		return model.Tweet{}, false
+	}
+	if err != nil {
+		internalError(w, r, "Error while loading the tweet, please try again", err)
+		return model.Tweet{}, false
+	}
+	return tweet, true
+}
+
+// replyTree expands tweet into a tree of replies depth levels deep, one store query per level.
+// The top level is read from page; deeper levels start at the newest reply. Every level keeps
+// at most limit replies per tweet, leaving out the ones the viewer must not see along with
+// everything below them.
+func (s *Server) replyTree(ctx context.Context, v viewer, tweet model.Tweet, page store.Page, limit int, depth int) (model.ThreadNode, error) {
+	root := model.ThreadNode{TweetResp: tweetResp(tweet), Replies: make([]model.ThreadNode, 0)}
+	level := []*model.ThreadNode{&root}
+	for d := 0; d <= depth && len(level) > 0; d++ {
+		parents := make([]guuid.UUID, 0, len(level))
+		for _, node := range level {
+			parents = append(parents, node.ID)
+		}
+		if d == depth {
+			// only find out whether the tweets at the bottom have replies of their own
+			page = store.Page{Limit: 1}
+		}
+		byParent, err := s.store.Replies(ctx, parents, page)
+		if err != nil {
+			return root, err
+		}
+		authors := make([]string, 0)
+		for _, replies := range byParent {
+			for _, reply := range replies {
+				authors = append(authors, reply.Author)
+			}
+		}
+		err = s.lookupAccounts(ctx, v, authors)
+		if err != nil {
+			return root, err
+		}
+		next := make([]*model.ThreadNode, 0)
+		for _, node := range level {
+			replies := byParent[node.ID]
+			if d == depth {
+				node.MoreReplies = len(replies) > 0
+				continue
+			}
+			lo, hi, cursor, _ := pageCursors(len(replies), page, limit, func(i int) store.Cursor {
+				return store.Cursor{CreatedAt: replies[i].CreatedAt, ID: replies[i].ID}
+			})
+			node.NextCursor = cursor
+			node.MoreReplies = cursor != ""
+			node.Replies = make([]model.ThreadNode, 0, hi-lo)
+			for _, reply := range replies[lo:hi] {
+				if v.hides(reply) {
+					continue
+				}
+				node.Replies = append(node.Replies, model.ThreadNode{TweetResp: tweetResp(reply), Replies: make([]model.ThreadNode, 0)})
+			}
+			for i := range node.Replies {
+				next = append(next, &node.Replies[i])
+			}
+		}
+		level = next
+		page = store.Page{Limit: limit + 1}
+	}
+	return root, nil
+}
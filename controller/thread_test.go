@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/store/storetest"
+)
+
+// thread loads the thread below tweet with the query parameters
+func (a *api) thread(tweet model.Tweet, query string, token string) model.Thread {
+	a.t.Helper()
+	var thread model.Thread
+	a.expect(a.do("GET", "/tweets/"+tweet.ID.String()+"/thread?"+query, token, nil), http.StatusOK, &thread)
+	return thread
+}
+
+// replyTexts lists the texts of the direct replies of a node
+func replyTexts(node model.ThreadNode) []string {
+	out := make([]string, 0, len(node.Replies))
+	for _, reply := range node.Replies {
+		out = append(out, reply.Text)
+	}
+	return out
+}
+
+func TestThread(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	root := a.tweet(alice, "root")
+	a.reply(bob, root, "r1")
+	a.reply(carol, root, "r2")
+	r3 := a.reply(bob, root, "r3")
+	c1 := a.reply(carol, r3, "c1")
+	c2 := a.reply(alice, r3, "c2")
+	a1 := a.reply(bob, c2, "a1")
+	if c2.InReplyToUser != "bob" || c2.ConversationID != root.ID || *a1.InReplyToID != c2.ID {
+		t.Errorf("reply c2 = %+v, want it in reply to bob in root's conversation", c2)
+	}
+
+	// limit applies to every level, and every level can be paged on its own
+	thread := a.thread(root, "limit=1", "")
+	top := thread.Tweet
+	if thread.Root != nil || !storetest.Equal(replyTexts(top), []string{"r3"}) || top.NextCursor == "" || !top.MoreReplies {
+		t.Fatalf("root's replies = %v, next %q", replyTexts(top), top.NextCursor)
+	}
+	node := top.Replies[0]
+	if !storetest.Equal(replyTexts(node), []string{"c2"}) || node.NextCursor == "" || !node.MoreReplies {
+		t.Fatalf("r3's replies = %v, next %q", replyTexts(node), node.NextCursor)
+	}
+	if !storetest.Equal(replyTexts(node.Replies[0]), []string{"a1"}) {
+		t.Errorf("c2's replies = %v", replyTexts(node.Replies[0]))
+	}
+	next := a.thread(r3, "limit=1&cursor="+url.QueryEscape(node.NextCursor), "")
+	if !storetest.Equal(replyTexts(next.Tweet), []string{"c1"}) || next.Tweet.NextCursor != "" {
+		t.Errorf("r3's second page = %v, next %q", replyTexts(next.Tweet), next.Tweet.NextCursor)
+	}
+	if next.Root == nil || next.Root.ID != root.ID {
+		t.Errorf("r3's thread starts at %+v, want root", next.Root)
+	}
+
+	// the tree stops at depth, flagging the tweets whose replies were cut off
+	thread = a.thread(root, "depth=1", "")
+	for _, reply := range thread.Tweet.Replies {
+		if len(reply.Replies) != 0 || reply.MoreReplies != (reply.ID == r3.ID) {
+			t.Errorf("reply %s at the depth limit: %d replies, more %v", reply.Text, len(reply.Replies), reply.MoreReplies)
+		}
+	}
+	thread = a.thread(root, "depth=0", "")
+	if len(thread.Tweet.Replies) != 0 || !thread.Tweet.MoreReplies {
+		t.Errorf("root at depth 0 = %+v, want no replies but more of them", thread.Tweet)
+	}
+	thread = a.thread(c1, "depth=0", "")
+	if thread.Tweet.MoreReplies {
+		t.Error("c1 has no replies, but more_replies is set")
+	}
+	// depths beyond the maximum are clamped
+	thread = a.thread(root, "depth=50", "")
+	if len(thread.Tweet.Replies) != 3 || len(thread.Tweet.Replies[0].Replies[0].Replies) != 1 {
+		t.Errorf("the whole tree was not listed at depth 50: %+v", thread.Tweet)
+	}
+
+	a.expectError(a.do("GET", "/tweets/"+root.ID.String()+"/thread?depth=-1", "", nil), http.StatusBadRequest, codeBadRequest)
+	a.expectError(a.do("GET", "/tweets/"+root.ID.String()+"/thread?depth=deep", "", nil), http.StatusBadRequest, codeBadRequest)
+	a.expectError(a.do("GET", "/tweets/nope/thread", "", nil), http.StatusNotFound, codeTweetNotFound)
+	a.expectError(a.do("POST", "/tweets/"+root.ID.String()+"/replies", bob, model.Request{Input: " "}), http.StatusUnprocessableEntity, codeValidation)
+	a.expectError(a.do("POST", "/tweets/"+root.ID.String()+"/replies", "", model.Request{Input: "hi"}), http.StatusUnauthorized, codeUnauthorized)
+}
+
+func TestReplyTimeline(t *testing.T) {
+	a := newAPI(t)
+	alice := a.signup("alice")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	dave := a.signup("dave")
+	a.expect(a.do("POST", "/follow", bob, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", dave, model.Request{Input: "alice"}), http.StatusOK, nil)
+	a.expect(a.do("POST", "/follow", dave, model.Request{Input: "carol"}), http.StatusOK, nil)
+	hello := a.tweet(carol, "hello")
+	a.reply(alice, hello, "hi carol")
+	mine := a.tweet(alice, "thread start")
+	a.reply(alice, mine, "thread continued")
+
+	// replies only show up for those who follow the account replied to as well
+	if texts, _ := a.timeline("/timeline", bob); !storetest.Equal(texts, []string{"thread continued", "thread start"}) {
+		t.Errorf("bob's timeline = %v, want alice's reply to carol left out", texts)
+	}
+	if texts, _ := a.timeline("/timeline", dave); !storetest.Equal(texts, []string{"thread continued", "thread start", "hi carol", "hello"}) {
+		t.Errorf("dave's timeline = %v", texts)
+	}
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"net/http"
+	"twitter-feed/model"
+	"twitter-feed/trends"
+)
+
+// TrendsHandler Displays the hashtags trending over the last hour or day
+// Requires: optional window query parameter, hour (the default) or day
+// Handled edges: Trends are recomputed in the background, so they can lag new tweets by a minute or so
+func (s *Server) TrendsHandler(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "hour"
+	}
+	if _, ok := trends.Windows[window]; !ok {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid window -- it must be hour or day.", nil)
+		return
+	}
+	if s.trends == nil {
+		writeJSON(w, http.StatusOK, model.Trends{Window: window, Trends: make([]model.Trend, 0)})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.trends.Trends(window))
+	return
+}
@@ -0,0 +1,210 @@
+// Package entities finds the hashtags, mentions, URLs and cashtags in tweet text so clients can
+// render them as links. Offsets count Unicode code points, not bytes or UTF-16 units, so an emoji
+// outside the Basic Multilingual Plane moves every later offset by one. An entity never ends in the
+// middle of a character: one followed by a combining mark or a joiner is not an entity at all.
+package entities
+
+import (
+	"strings"
+	"twitter-feed/model"
+	"unicode"
+)
+
+const (
+	maxMentionLength = 15
+	maxCashtagLength = 6
+	zwnj             = '\u200c'
+	zwj              = '\u200d'
+)
+
+// Parse returns every entity of text in order of appearance. Mentions are returned as typed;
+// whether the account exists is up to the caller.
+func Parse(text string) model.Entities {
+	var out model.Entities
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		end, ok := 0, false
+		if i == 0 || !isWord(runes[i-1]) {
+			switch runes[i] {
+			case '#', '＃':
+				if end, ok = hashtag(runes, i); ok {
+					out.Hashtags = append(out.Hashtags, entity(runes, i, end))
+				}
+			case '@', '＠':
+				if end, ok = mention(runes, i); ok {
+					out.Mentions = append(out.Mentions, entity(runes, i, end))
+				}
+			case '$':
+				if end, ok = cashtag(runes, i); ok {
+					out.Cashtags = append(out.Cashtags, entity(runes, i, end))
+				}
+			case 'h', 'H':
+				if end, ok = url(runes, i); ok {
+					out.URLs = append(out.URLs, model.Entity{Start: i, End: end, Text: string(runes[i:end])})
+				}
+			}
+		}
+		if ok {
+			i = end
+		} else {
+			i++
+		}
+	}
+	return out
+}
+
+// entity builds the entity spanning runes[start:end], whose text leaves out the leading sigil
+func entity(runes []rune, start int, end int) model.Entity {
+	return model.Entity{Start: start, End: end, Text: string(runes[start+1 : end])}
+}
+
+// isWord reports whether r can be part of a word, so that an entity cannot start right after it
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// joined reports whether the character at i belongs to the character before it, which would
+// leave an entity ending at i cut in half
+func joined(runes []rune, i int) bool {
+	return i < len(runes) && (unicode.IsMark(runes[i]) || runes[i] == zwj)
+}
+
+// hashtag matches #tag where tag is made of letters, combining marks, digits, underscores and
+// zero-width non-joiners and holds at least one letter. A sigil followed by a mark, as in the
+// keycap emoji #️⃣, is not a hashtag.
+func hashtag(runes []rune, start int) (int, bool) {
+	i := start + 1
+	if i >= len(runes) || unicode.IsMark(runes[i]) {
+		return 0, false
+	}
+	letter := false
+	for ; i < len(runes); i++ {
+		r := runes[i]
+		if !isWord(r) && r != zwnj {
+			break
+		}
+		letter = letter || unicode.IsLetter(r)
+	}
+	if !letter || joined(runes, i) {
+		return 0, false
+	}
+	if i < len(runes) && (runes[i] == '#' || runes[i] == '＃') {
+		return 0, false
+	}
+	return i, true
+}
+
+// mention matches @username using the characters allowed in usernames. A longer run of word
+// characters or a second @, as in an email address, is not a mention.
+func mention(runes []rune, start int) (int, bool) {
+	i := start + 1
+	for ; i < len(runes) && isUsernameChar(runes[i]); i++ {
+	}
+	n := i - start - 1
+	if n == 0 || n > maxMentionLength {
+		return 0, false
+	}
+	if i < len(runes) && (isWord(runes[i]) || runes[i] == '@' || runes[i] == '＠') {
+		return 0, false
+	}
+	return i, true
+}
+
+func isUsernameChar(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// cashtag matches $SYMBOL: up to six ASCII letters, optionally followed by a share class or
+// exchange suffix such as $BRK.A or $RDS_B
+func cashtag(runes []rune, start int) (int, bool) {
+	i := letters(runes, start+1, maxCashtagLength)
+	if i == start+1 {
+		return 0, false
+	}
+	if i+1 < len(runes) && (runes[i] == '.' || runes[i] == '_') {
+		if j := letters(runes, i+1, 2); j > i+1 && (j == len(runes) || !isWord(runes[j])) {
+			i = j
+		}
+	}
+	if i < len(runes) && isWord(runes[i]) {
+		return 0, false
+	}
+	return i, true
+}
+
+// letters returns the index after at most max ASCII letters starting at i
+func letters(runes []rune, i int, max int) int {
+	for n := 0; n < max && i < len(runes) && isASCIILetter(runes[i]); n++ {
+		i++
+	}
+	return i
+}
+
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// url matches an http or https URL running to the next space. Trailing punctuation is left out,
+// as is a closing bracket that does not close one opened inside the URL.
+func url(runes []rune, start int) (int, bool) {
+	rest := strings.ToLower(string(runes[start:min(len(runes), start+8)]))
+	var scheme int
+	switch {
+	case strings.HasPrefix(rest, "https://"):
+		scheme = 8
+	case strings.HasPrefix(rest, "http://"):
+		scheme = 7
+	default:
+		return 0, false
+	}
+	i := start + scheme
+	for ; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+	}
+	for i > start+scheme {
+		r := runes[i-1]
+		if strings.ContainsRune(".,:;!?'\"", r) || (opener(r) != 0 && !balanced(runes[start:i], r)) {
+			i--
+			continue
+		}
+		break
+	}
+	if i == start+scheme {
+		return 0, false
+	}
+	return i, true
+}
+
+// opener returns the opening bracket matching r, or 0 if r is not a closing bracket
+func opener(r rune) rune {
+	switch r {
+	case ')':
+		return '('
+	case ']':
+		return '['
+	case '}':
+		return '{'
+	}
+	return 0
+}
+
+// balanced reports whether the closing bracket at the end of s closes a bracket opened in s
+func balanced(s []rune, closing rune) bool {
+	opening := opener(closing)
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case opening:
+			depth++
+		case closing:
+			depth--
+		}
+	}
+	return depth >= 0
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package entities
+
+import (
+	"fmt"
+	"testing"
+	"twitter-feed/model"
+)
+
+// describe lists the entities as "kind text start-end", hashtags first, then mentions, cashtags and URLs
+func describe(e model.Entities) []string {
+	out := make([]string, 0)
+	for _, kind := range []struct {
+		name     string
+		entities []model.Entity
+	}{{"#", e.Hashtags}, {"@", e.Mentions}, {"$", e.Cashtags}, {"url", e.URLs}} {
+		for _, entity := range kind.entities {
+			out = append(out, fmt.Sprintf("%s %s %d-%d", kind.name, entity.Text, entity.Start, entity.End))
+		}
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"hi #go and @bob", []string{"# go 3-6", "@ bob 11-15"}},
+		{"#one#two", nil},
+		{"#1 #1st", []string{"# 1st 3-7"}},
+		{"#café_2021", []string{"# café_2021 0-10"}},
+		{"＃wide ＠bob", []string{"# wide 0-5", "@ bob 6-10"}},
+		// offsets count code points: the woman technologist is three of them, a flag two
+		{"👩\u200d💻 #go @bob", []string{"# go 4-7", "@ bob 8-12"}},
+		{"🇯🇵 #japan", []string{"# japan 3-9"}},
+		{"😀😀 https://go.dev", []string{"url https://go.dev 3-17"}},
+		// combining marks belong to the letter before them
+		{"#cafe\u0301 ok", []string{"# cafe\u0301 0-6"}},
+		{"e\u0301#tag", nil},
+		{"@bob\u0301", nil},
+		{"#️⃣ keycap", nil},
+		// trailing punctuation and unbalanced brackets are left out of URLs
+		{"see https://example.com/a.", []string{"url https://example.com/a 4-25"}},
+		{"really? http://x.io/?q=1!?", []string{"url http://x.io/?q=1 8-24"}},
+		{"(https://en.wikipedia.org/wiki/Go_(language))", []string{"url https://en.wikipedia.org/wiki/Go_(language) 1-44"}},
+		{"HTTPS://GO.DEV", []string{"url HTTPS://GO.DEV 0-14"}},
+		{"https:// alone", nil},
+		{"ftp://example.com", nil},
+		// cashtags
+		{"$AAPL up, $BRK.A and $RDS_B", []string{"$ AAPL 0-5", "$ BRK.A 10-16", "$ RDS_B 21-27"}},
+		{"$toolong $5 US$AAPL", nil},
+		{"$GOOG.", []string{"$ GOOG 0-5"}},
+		// sigils inside words start nothing
+		{"mail bob@example.com", nil},
+		{"c#sharp and a@b", nil},
+		{"@sixteen_chars_12", nil},
+		{"@fifteen_chars_1 hi", []string{"@ fifteen_chars_1 0-16"}},
+		{"@bob's @élise", []string{"@ bob 0-4"}},
+	}
+	for _, c := range cases {
+		got := describe(Parse(c.text))
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("Parse(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
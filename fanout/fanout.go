@@ -0,0 +1,293 @@
+// Package fanout materializes home timelines on write. When a tweet is posted a job pushes it
+// into the stored timeline of every follower; accounts with more followers than a threshold are
+// skipped and merged in at read time instead, since pushing to all of their followers would be
+// too expensive.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// ErrStopped is returned when work is submitted after Stop
+var ErrStopped = errors.New("fanout: service stopped")
+
+// Options tune the fan-out service
+type Options struct {
+	// Workers is the number of goroutines processing jobs
+	Workers int
+	// QueueSize is how many jobs can wait before submitting blocks
+	QueueSize int
+	// Capacity is how many entries each materialized timeline keeps
+	Capacity int
+	// CelebrityThreshold is the follower count above which an author's tweets are not fanned out
+	CelebrityThreshold int
+	// MaxAttempts is how many times a failing job is tried before it is dropped
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry; it doubles on every further attempt
+	RetryDelay time.Duration
+}
+
+// DefaultOptions are sensible settings for a single instance
+var DefaultOptions = Options{
+	Workers:            4,
+	QueueSize:          1024,
+	Capacity:           800,
+	CelebrityThreshold: 10000,
+	MaxAttempts:        5,
+	RetryDelay:         500 * time.Millisecond,
+}
+
+type jobKind int
+
+const (
+	// tweetJob pushes a new tweet to the author's followers
+	tweetJob jobKind = iota
+	// followJob backfills the followee's recent tweets into a new follower's timeline
+	followJob
+)
+
+type job struct {
+	kind     jobKind
+	tweet    model.Tweet
+	follower string
+	followee string
+	attempt  int
+}
+
+// Service runs the fan-out worker pool and serves hybrid timelines
+type Service struct {
+	store   store.Store
+	opts    Options
+	jobs    chan job
+	quit    chan struct{}
+	workers sync.WaitGroup
+	pending sync.WaitGroup
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// New returns a Service over the store. Call Start before submitting work.
+func New(st store.Store, opts Options) *Service {
+	return &Service{
+		store: st,
+		opts:  opts,
+		jobs:  make(chan job, opts.QueueSize),
+		quit:  make(chan struct{}),
+	}
+}
+
+// Start launches the worker pool
+func (s *Service) Start() {
+	for i := 0; i < s.opts.Workers; i++ {
+		s.workers.Add(1)
+		go s.work()
+	}
+}
+
+// Stop refuses new work, waits for queued jobs and scheduled retries to finish or for ctx
+// to expire, and then shuts the workers down
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	close(s.quit)
+	s.workers.Wait()
+	return err
+}
+
+// TweetCreated schedules the tweet to be pushed into its author's followers' timelines
+func (s *Service) TweetCreated(ctx context.Context, tweet model.Tweet) error {
+	return s.submit(ctx, job{kind: tweetJob, tweet: tweet})
+}
+
+// Followed schedules the followee's recent tweets to be copied into the follower's timeline
+func (s *Service) Followed(ctx context.Context, follower string, followee string) error {
+	return s.submit(ctx, job{kind: followJob, follower: follower, followee: followee})
+}
+
+func (s *Service) submit(ctx context.Context, j job) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return ErrStopped
+	}
+	s.pending.Add(1)
+	select {
+	case s.jobs <- j:
+		return nil
+	case <-ctx.Done():
+		s.pending.Done()
+		return ctx.Err()
+	}
+}
+
+func (s *Service) work() {
+	defer s.workers.Done()
+	for {
+		select {
+		case j := <-s.jobs:
+			s.run(j)
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// run processes a job and schedules a retry with exponential backoff when it fails
+func (s *Service) run(j job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := s.process(ctx, j)
+	cancel()
+	if err == nil {
+		s.pending.Done()
+		return
+	}
+	j.attempt++
+	if j.attempt >= s.opts.MaxAttempts {
+		log.Printf("fanout: giving up after %d attempts: %v", j.attempt, err)
+		s.pending.Done()
+		return
+	}
+	delay := s.opts.RetryDelay << uint(j.attempt-1)
+	time.AfterFunc(delay, func() {
+		select {
+		case s.jobs <- j:
+		case <-s.quit:
+			s.pending.Done()
+		}
+	})
+}
+
+func (s *Service) process(ctx context.Context, j job) error {
+	switch j.kind {
+	case tweetJob:
+		followers, err := s.store.Followers(ctx, j.tweet.Author)
+		if err != nil {
+			return err
+		}
+		if len(followers) > s.opts.CelebrityThreshold {
+			return s.store.MarkCelebrity(ctx, j.tweet.Author)
+		}
+		return s.store.PushFeed(ctx, followers, []model.FeedEntry{feedEntry(j.tweet)}, s.opts.Capacity)
+	case followJob:
+		celebrity, err := s.isCelebrity(ctx, j.followee)
+		if err != nil || celebrity {
+			return err
+		}
+		tweets, err := s.store.TweetsByAuthors(ctx, []string{j.followee}, store.Page{Limit: s.opts.Capacity})
+		if err != nil {
+			return err
+		}
+		entries := make([]model.FeedEntry, 0, len(tweets))
+		for _, tweet := range tweets {
+			entries = append(entries, feedEntry(tweet))
+		}
+		return s.store.PushFeed(ctx, []string{j.follower}, entries, s.opts.Capacity)
+	}
+	return nil
+}
+
+func feedEntry(tweet model.Tweet) model.FeedEntry {
+	return model.FeedEntry{
+		TweetID:       tweet.ID,
+		Author:        tweet.Author,
+		CreatedAt:     tweet.CreatedAt,
+		InReplyToUser: tweet.InReplyToUser,
+	}
+}
+
+func (s *Service) isCelebrity(ctx context.Context, author string) (bool, error) {
+	celebrities, err := s.store.Celebrities(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, celebrity := range celebrities {
+		if celebrity == author {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Timeline returns a newest-first page of username's home timeline, reading the materialized
+// timeline and merging in the tweets of followed accounts that are not fanned out
+func (s *Service) Timeline(ctx context.Context, username string, page store.Page) ([]model.Tweet, error) {
+	followings, err := s.store.Followings(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	tweets, err := s.store.ReadFeed(ctx, username, followings, page)
+	if err != nil {
+		return nil, err
+	}
+	celebrities, err := s.store.Celebrities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pulled := make([]string, 0)
+	for _, celebrity := range celebrities {
+		for _, following := range followings {
+			if following == celebrity {
+				pulled = append(pulled, celebrity)
+				break
+			}
+		}
+	}
+	if len(pulled) == 0 {
+		return tweets, nil
+	}
+	extra, err := s.store.TimelineTweets(ctx, pulled, followings, page)
+	if err != nil {
+		return nil, err
+	}
+	return merge(tweets, extra, page), nil
+}
+
+// merge combines two newest-first pages of the same listing into one, dropping duplicates.
+// Pages walking towards newer tweets keep the tweets closest to the cursor, which are the oldest.
+func merge(a []model.Tweet, b []model.Tweet, page store.Page) []model.Tweet {
+	seen := make(map[uuid.UUID]bool, len(a)+len(b))
+	out := make([]model.Tweet, 0, len(a)+len(b))
+	for _, tweet := range append(append([]model.Tweet{}, a...), b...) {
+		if seen[tweet.ID] {
+			continue
+		}
+		seen[tweet.ID] = true
+		out = append(out, tweet)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID.String() > out[j].ID.String()
+	})
+	if len(out) > page.Limit {
+		if page.Newer() {
+			out = out[len(out)-page.Limit:]
+		} else {
+			out = out[:page.Limit]
+		}
+	}
+	return out
+}
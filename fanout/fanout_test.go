@@ -0,0 +1,126 @@
+package fanout
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+	"twitter-feed/store/storetest"
+)
+
+// setup returns a memory store holding the users, along with a started service over it
+func setup(t *testing.T, threshold int, users ...string) (*store.Memory, *Service) {
+	st := store.NewMemory()
+	for _, username := range users {
+		storetest.CreateUser(t, st, username)
+	}
+	opts := DefaultOptions
+	opts.Workers = 2
+	opts.CelebrityThreshold = threshold
+	opts.RetryDelay = time.Millisecond
+	s := New(st, opts)
+	s.Start()
+	return st, s
+}
+
+// stop waits for every queued job to be done
+func stop(t *testing.T, s *Service) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// post hands a stored tweet to the service
+func post(t *testing.T, s *Service, tweet model.Tweet) {
+	err := s.TweetCreated(context.Background(), tweet)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func follow(t *testing.T, st store.Store, follower string, followee string) {
+	err := st.Follow(context.Background(), follower, followee)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func timeline(t *testing.T, s *Service, username string) []string {
+	tweets, err := s.Timeline(context.Background(), username, store.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storetest.Texts(tweets)
+}
+
+func TestFanout(t *testing.T) {
+	st, s := setup(t, 100, "alice", "bob", "carol", "dave")
+	follow(t, st, "bob", "alice")
+	post(t, s, storetest.CreateTweet(t, st, "carol", "before the follow", storetest.At(1)))
+	post(t, s, storetest.CreateTweet(t, st, "alice", "hello", storetest.At(2)))
+	// bob does not follow dave, so alice's reply to him stays out of bob's timeline
+	dave := storetest.CreateTweet(t, st, "dave", "from dave", storetest.At(3))
+	post(t, s, storetest.CreateReply(t, st, "alice", dave, "@dave hi", storetest.At(4)))
+	post(t, s, storetest.CreateTweet(t, st, "alice", "again", storetest.At(5)))
+	follow(t, st, "bob", "carol")
+	err := s.Followed(context.Background(), "bob", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop(t, s)
+
+	got := timeline(t, s, "bob")
+	if !storetest.Equal(got, []string{"again", "hello", "before the follow"}) {
+		t.Errorf("bob's timeline = %v", got)
+	}
+	if got := timeline(t, s, "dave"); len(got) != 0 {
+		t.Errorf("dave's timeline = %v, want it empty", got)
+	}
+	err = s.TweetCreated(context.Background(), model.Tweet{})
+	if err != ErrStopped {
+		t.Errorf("TweetCreated after Stop: got %v, want ErrStopped", err)
+	}
+}
+
+func TestCelebrities(t *testing.T) {
+	st, s := setup(t, 1, "alice", "bob", "carol")
+	follow(t, st, "bob", "alice")
+	follow(t, st, "carol", "alice")
+	follow(t, st, "bob", "carol")
+	post(t, s, storetest.CreateTweet(t, st, "carol", "from carol", storetest.At(1)))
+	post(t, s, storetest.CreateTweet(t, st, "alice", "from alice", storetest.At(2)))
+	stop(t, s)
+
+	celebrities, err := st.Celebrities(context.Background())
+	if err != nil || !storetest.Equal(celebrities, []string{"alice"}) {
+		t.Fatalf("celebrities = %v, %v, want [alice]", celebrities, err)
+	}
+	// alice's tweets are not pushed, but merged in when bob reads his timeline
+	feed, err := st.ReadFeed(context.Background(), "bob", []string{"alice", "carol"}, store.Page{Limit: 10})
+	if err != nil || !storetest.Equal(storetest.Texts(feed), []string{"from carol"}) {
+		t.Errorf("bob's stored timeline = %v, %v, want carol's tweet alone", storetest.Texts(feed), err)
+	}
+	if got := timeline(t, s, "bob"); !storetest.Equal(got, []string{"from alice", "from carol"}) {
+		t.Errorf("bob's timeline = %v", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tweet := func(text string, minute int) model.Tweet {
+		return model.Tweet{ID: uuid.New(), Text: text, CreatedAt: storetest.At(minute)}
+	}
+	t1, t2, t3, t4 := tweet("1", 1), tweet("2", 2), tweet("3", 3), tweet("4", 4)
+	got := merge([]model.Tweet{t4, t2}, []model.Tweet{t3, t2, t1}, store.Page{Limit: 3})
+	if !storetest.Equal(storetest.Texts(got), []string{"4", "3", "2"}) {
+		t.Errorf("older page = %v, want [4 3 2]", storetest.Texts(got))
+	}
+	got = merge([]model.Tweet{t4, t2}, []model.Tweet{t3, t1}, store.Page{Limit: 2, Cursor: &store.Cursor{Newer: true}})
+	if !storetest.Equal(storetest.Texts(got), []string{"2", "1"}) {
+		t.Errorf("newer page = %v, want the two closest to the cursor, [2 1]", storetest.Texts(got))
+	}
+}
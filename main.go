@@ -1,36 +1,318 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"twitter-feed/config"
+	"twitter-feed/config/db"
 	"twitter-feed/controller"
+	"twitter-feed/fanout"
+	"twitter-feed/purge"
+	"twitter-feed/store"
+	"twitter-feed/stream"
+	"twitter-feed/trends"
+	"twitter-feed/validation"
 )
 
 func main() {
+	defaults := config.Default()
+	configPath := flag.String("config", os.Getenv("TWITTER_CONFIG"), "JSON config file (env: TWITTER_CONFIG)")
+	backend := flag.String("store", defaults.Store, "storage backend to use: mongo or memory")
+	timeline := flag.String("timeline", defaults.Timeline, "home timeline strategy: pull (query on read) or fanout (materialize on write)")
+	addr := flag.String("addr", defaults.HTTP.Addr, "address to listen on")
+	fanoutWorkers := flag.Int("fanout-workers", defaults.Fanout.Workers, "fan-out worker goroutines")
+	fanoutThreshold := flag.Int("fanout-threshold", defaults.Fanout.Threshold, "follower count above which tweets are merged at read time instead of fanned out")
+	fanoutCapacity := flag.Int("fanout-capacity", defaults.Fanout.Capacity, "entries kept in each materialized timeline")
+	minLength := flag.Int("password-min-length", defaults.Password.MinLength, "minimum password length")
+	requireSymbol := flag.Bool("password-require-symbol", defaults.Password.RequireSymbol, "require passwords to contain a symbol")
+	blocklist := flag.String("password-blocklist", defaults.Password.Blocklist, "file of breached passwords to reject, one per line")
+	tweetMaxLength := flag.Int("tweet-max-length", defaults.Tweet.MaxLength, "maximum tweet length in weighted characters")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// flags given on the command line win over the file and the environment
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "store":
+			cfg.Store = *backend
+		case "timeline":
+			cfg.Timeline = *timeline
+		case "addr":
+			cfg.HTTP.Addr = *addr
+		case "fanout-workers":
+			cfg.Fanout.Workers = *fanoutWorkers
+		case "fanout-threshold":
+			cfg.Fanout.Threshold = *fanoutThreshold
+		case "fanout-capacity":
+			cfg.Fanout.Capacity = *fanoutCapacity
+		case "password-min-length":
+			cfg.Password.MinLength = *minLength
+		case "password-require-symbol":
+			cfg.Password.RequireSymbol = *requireSymbol
+		case "password-blocklist":
+			cfg.Password.Blocklist = *blocklist
+		case "tweet-max-length":
+			cfg.Tweet.MaxLength = *tweetMaxLength
+		}
+	})
+	err = cfg.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy := validation.DefaultPolicy
+	policy.MinLength = cfg.Password.MinLength
+	policy.RequireSymbol = cfg.Password.RequireSymbol
+	if cfg.Password.Blocklist != "" {
+		policy.Blocklist, err = validation.LoadBlocklist(cfg.Password.Blocklist)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var st store.Store
+	var client *mongo.Client
+	switch cfg.Store {
+	case "memory":
+		st = store.NewMemory()
+	case "mongo":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Mongo.ConnectTimeout))
+		client, err = db.Connect(ctx, cfg.Mongo.URI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		st, err = store.NewMongo(ctx, client.Database(cfg.Mongo.Database), cfg.Mongo.Collections)
+		cancel()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	tweetLimit := validation.TweetLimit{MaxWeight: cfg.Tweet.MaxLength, URLWeight: cfg.Tweet.URLLength}
+	dmLimits := validation.DMLimits{MaxLength: cfg.DM.MaxLength, MaxParticipants: cfg.DM.MaxParticipants}
+	opts := []controller.Option{controller.WithPasswordPolicy(policy), controller.WithBcryptCost(cfg.BcryptCost),
+		controller.WithTweetLimit(tweetLimit), controller.WithDMLimits(dmLimits)}
+	var f *fanout.Service
+	if cfg.Timeline == "fanout" {
+		fanoutOpts := fanout.DefaultOptions
+		fanoutOpts.Workers = cfg.Fanout.Workers
+		fanoutOpts.CelebrityThreshold = cfg.Fanout.Threshold
+		fanoutOpts.Capacity = cfg.Fanout.Capacity
+		f = fanout.New(st, fanoutOpts)
+		f.Start()
+		opts = append(opts, controller.WithFanout(f))
+	}
+	trendOpts := trends.DefaultOptions
+	trendOpts.Bucket = time.Duration(cfg.Trends.Bucket)
+	trendOpts.Baseline = time.Duration(cfg.Trends.Baseline)
+	trendOpts.Interval = time.Duration(cfg.Trends.Interval)
+	trendOpts.Size = cfg.Trends.Size
+	trendOpts.MinCount = cfg.Trends.MinCount
+	t := trends.New(trendOpts)
+	t.Start()
+	opts = append(opts, controller.WithTrends(t))
+	streamOpts := stream.Options{
+		Buffer:    cfg.Stream.Buffer,
+		Replay:    cfg.Stream.Replay,
+		Retain:    time.Duration(cfg.Stream.Retain),
+		Policy:    cfg.Stream.Policy,
+		Heartbeat: time.Duration(cfg.Stream.Heartbeat),
+		Lifetime:  time.Duration(cfg.Stream.Lifetime),
+	}
+	hub := stream.New(streamOpts)
+	opts = append(opts, controller.WithStream(hub))
+	purgeOpts := purge.DefaultOptions
+	purgeOpts.Interval = time.Duration(cfg.Deletion.Interval)
+	p := purge.New(st, purgeOpts)
+	p.Start()
+	opts = append(opts, controller.WithDeletion(p, time.Duration(cfg.Deletion.GracePeriod)))
+	s := controller.NewServer(st, opts...)
+
 	r := mux.NewRouter()
-	r.HandleFunc("/register", controller.RegisterHandler).
+	r.NotFoundHandler = controller.RequestID(http.HandlerFunc(controller.NotFoundHandler))
+	r.MethodNotAllowedHandler = controller.RequestID(http.HandlerFunc(controller.MethodNotAllowedHandler))
+	r.Use(controller.RequestID, controller.Recover, controller.Timeout(time.Duration(cfg.HTTP.RequestTimeout)), s.Authenticate)
+	r.HandleFunc("/register", s.RegisterHandler).
+		Methods("POST")
+	r.HandleFunc("/login", s.LoginHandler).
+		Methods("POST")
+	r.HandleFunc("/logout", s.LogoutHandler).
+		Methods("POST")
+	r.HandleFunc("/follow", s.FollowHandler).
+		Methods("POST")
+	r.HandleFunc("/unfollow", s.UnfollowHandler).
+		Methods("POST")
+	r.HandleFunc("/tweet", s.TweetHandler).
+		Methods("POST")
+	r.HandleFunc("/profile/{username}", s.ProfileHandler).
+		Methods("GET")
+	r.HandleFunc("/timeline", s.TimelineHandler).
+		Methods("GET")
+	r.HandleFunc("/users/{username}/tweets", s.UserTweetsHandler).
+		Methods("GET")
+	r.HandleFunc("/tweets/{id}/replies", s.ReplyHandler).
+		Methods("POST")
+	r.HandleFunc("/tweets/{id}/thread", s.ThreadHandler).
+		Methods("GET")
+	r.HandleFunc("/tweets/{id}/retweet", s.RetweetHandler).
+		Methods("POST")
+	r.HandleFunc("/tweets/{id}/retweet", s.UnretweetHandler).
+		Methods("DELETE")
+	r.HandleFunc("/tweets/{id}/quote", s.QuoteHandler).
+		Methods("POST")
+	r.HandleFunc("/tweets/{id}/like", s.LikeHandler).
+		Methods("POST")
+	r.HandleFunc("/tweets/{id}/like", s.UnlikeHandler).
+		Methods("DELETE")
+	r.HandleFunc("/tweets/{id}/likes", s.TweetLikesHandler).
+		Methods("GET")
+	r.HandleFunc("/users/{username}/likes", s.UserLikesHandler).
+		Methods("GET")
+	r.HandleFunc("/users/{username}/followers", s.FollowersHandler).
+		Methods("GET")
+	r.HandleFunc("/users/{username}/following", s.FollowingHandler).
+		Methods("GET")
+	r.HandleFunc("/search/tweets", s.SearchTweetsHandler).
+		Methods("GET")
+	r.HandleFunc("/search/users", s.SearchUsersHandler).
+		Methods("GET")
+	r.HandleFunc("/trends", s.TrendsHandler).
+		Methods("GET")
+	r.HandleFunc("/notifications", s.NotificationsHandler).
+		Methods("GET")
+	r.HandleFunc("/notifications/read", s.ReadNotificationsHandler).
 		Methods("POST")
-	r.HandleFunc("/login", controller.LoginHandler).
+	r.HandleFunc("/mentions", s.MentionsHandler).
+		Methods("GET")
+	r.HandleFunc("/dm/conversations", s.CreateConversationHandler).
 		Methods("POST")
-	r.HandleFunc("/logout", controller.LogoutHandler).
+	r.HandleFunc("/dm/conversations", s.ConversationsHandler).
+		Methods("GET")
+	r.HandleFunc("/dm/conversations/{id}/messages", s.SendMessageHandler).
 		Methods("POST")
-	r.HandleFunc("/follow", controller.FollowHandler).
+	r.HandleFunc("/dm/conversations/{id}/messages", s.MessagesHandler).
+		Methods("GET")
+	r.HandleFunc("/dm/conversations/{id}/read", s.ReadConversationHandler).
 		Methods("POST")
-	r.HandleFunc("/unfollow", controller.UnfollowHandler).
+	r.HandleFunc("/dm/settings", s.DMSettingsHandler).
+		Methods("GET")
+	r.HandleFunc("/dm/settings", s.UpdateDMSettingsHandler).
 		Methods("POST")
-	r.HandleFunc("/tweet", controller.TweetHandler).
+	r.HandleFunc("/blocks", s.BlocksHandler).
+		Methods("GET")
+	r.HandleFunc("/blocks/{username}", s.BlockHandler).
 		Methods("POST")
-	r.HandleFunc("/profile/{username}", controller.ProfileHandler).
+	r.HandleFunc("/blocks/{username}", s.UnblockHandler).
+		Methods("DELETE")
+	r.HandleFunc("/mutes", s.MutesHandler).
 		Methods("GET")
-	r.HandleFunc("/timeline", controller.TimelineHandler).
+	r.HandleFunc("/mutes/{username}", s.MuteHandler).
+		Methods("POST")
+	r.HandleFunc("/mutes/{username}", s.UnmuteHandler).
+		Methods("DELETE")
+	r.HandleFunc("/muted-words", s.MuteWordHandler).
+		Methods("POST")
+	r.HandleFunc("/muted-words/{id}", s.UnmuteWordHandler).
+		Methods("DELETE")
+	r.HandleFunc("/follow-requests", s.FollowRequestsHandler).
 		Methods("GET")
-	r.HandleFunc("/delete", controller.DeleteHandler).
+	r.HandleFunc("/follow-requests/{username}/accept", s.AcceptFollowRequestHandler).
+		Methods("POST")
+	r.HandleFunc("/follow-requests/{username}/reject", s.RejectFollowRequestHandler).
+		Methods("POST")
+	r.HandleFunc("/settings/privacy", s.PrivacySettingsHandler).
+		Methods("GET")
+	r.HandleFunc("/settings/privacy", s.UpdatePrivacySettingsHandler).
+		Methods("POST")
+	r.HandleFunc("/delete", s.DeleteHandler).
 		Methods("POST")
-	r.HandleFunc("/untweet", controller.UntweetHandler).
+	r.HandleFunc("/untweet", s.UntweetHandler).
 		Methods("POST")
-	r.HandleFunc("/update", controller.UpdateHandler).
+	r.HandleFunc("/update", s.UpdateHandler).
 		Methods("POST")
 
-	log.Fatal(http.ListenAndServe(":8080", r))
+	// streams stay open far longer than the request timeout, so they get a router without it
+	streams := mux.NewRouter()
+	streams.NotFoundHandler = r.NotFoundHandler
+	streams.MethodNotAllowedHandler = r.MethodNotAllowedHandler
+	streams.Use(controller.RequestID, controller.Recover, controller.QueryToken, s.Authenticate)
+	streams.HandleFunc("/stream/timeline", s.StreamTimelineHandler).
+		Methods("GET")
+	streams.HandleFunc("/stream/ws", s.StreamSocketHandler).
+		Methods("GET")
+	root := http.NewServeMux()
+	root.Handle("/stream/", streams)
+	root.Handle("/", r)
+
+	server := &http.Server{
+		Addr:         cfg.HTTP.Addr,
+		Handler:      root,
+		ReadTimeout:  time.Duration(cfg.HTTP.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.HTTP.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.HTTP.IdleTimeout),
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.HTTP.TLSCert != "" {
+			serveErr <- server.ListenAndServeTLS(cfg.HTTP.TLSCert, cfg.HTTP.TLSKey)
+			return
+		}
+		serveErr <- server.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case sig := <-stop:
+		log.Printf("received %s, shutting down", sig)
+	}
+
+	// end the streams, which would otherwise never finish, stop accepting connections and let
+	// in-flight requests finish, then drain the streaming, fan-out and trends queues they may
+	// have added to, interrupt the purge, which resumes on the next start, and only then close
+	// the database
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.HTTP.ShutdownTimeout))
+	defer cancel()
+	hub.Close()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("shutting down http server: %v", err)
+	}
+	err = s.Close(ctx)
+	if err != nil {
+		log.Printf("stopping streaming: %v", err)
+	}
+	if f != nil {
+		err = f.Stop(ctx)
+		if err != nil {
+			log.Printf("stopping fanout: %v", err)
+		}
+	}
+	err = t.Stop(ctx)
+	if err != nil {
+		log.Printf("stopping trends: %v", err)
+	}
+	err = p.Stop(ctx)
+	if err != nil {
+		log.Printf("stopping purge: %v", err)
+	}
+	if client != nil {
+		err = client.Disconnect(ctx)
+		if err != nil {
+			log.Printf("disconnecting from mongo: %v", err)
+		}
+	}
+	log.Print("shutdown complete")
 }
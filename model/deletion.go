@@ -0,0 +1,38 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Deletion stages, in the order an account goes through them
+const (
+	// DeletionPending waits for the grace period to end, during which logging in cancels the deletion
+	DeletionPending    = "pending"
+	DeletionTweets     = "tweets"
+	DeletionLikes      = "likes"
+	DeletionFollows    = "follows"
+	DeletionReferences = "references"
+	DeletionAccount    = "account"
+	DeletionDone       = "done"
+)
+
+// Deletion tracks the deletion of an account, from the request to the end of its purge. Stage is
+// the next stage to run; it only moves on once everything before it has been removed.
+type Deletion struct {
+	ID          uuid.UUID `bson:"_id"`
+	Username    string    `bson:"username"`
+	RequestedAt time.Time `bson:"requested_at"`
+	// PurgeAt is when the grace period ends and the purge may start
+	PurgeAt    time.Time  `bson:"purge_at"`
+	Stage      string     `bson:"stage"`
+	StartedAt  *time.Time `bson:"started_at,omitempty"`
+	FinishedAt *time.Time `bson:"finished_at,omitempty"`
+	// TweetsDeleted, LikesRemoved and FollowsRemoved count what the purge has removed so far
+	TweetsDeleted  int64 `bson:"tweets_deleted"`
+	LikesRemoved   int64 `bson:"likes_removed"`
+	FollowsRemoved int64 `bson:"follows_removed"`
+	// Failures counts the purge runs that stopped on an error, and LastError is the latest one
+	Failures  int    `bson:"failures"`
+	LastError string `bson:"last_error,omitempty"`
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Who can start a direct message conversation with a user
+const (
+	// DMFollowing only lets the accounts the user follows message them; it is the default
+	DMFollowing = "following"
+	// DMEveryone lets any account message the user
+	DMEveryone = "everyone"
+)
+
+// Conversation is a private one-to-one or group conversation
+type Conversation struct {
+	ID uuid.UUID `bson:"_id"`
+	// Key is unique among conversations: the participants joined by commas for one-to-one
+	// conversations, so that each pair has only one, and the ID for groups
+	Key string `bson:"key"`
+	// Participants are sorted and include the creator
+	Participants []string  `bson:"participants"`
+	Group        bool      `bson:"group"`
+	CreatedBy    string    `bson:"created_by"`
+	CreatedAt    time.Time `bson:"created_at"`
+	// LastMessageAt orders conversations by activity; it is CreatedAt until the first message
+	LastMessageAt time.Time `bson:"last_message_at"`
+	LastMessage   *Message  `bson:"last_message,omitempty"`
+	// ReadAt is how far each participant has read the conversation
+	ReadAt map[string]time.Time `bson:"read_at"`
+}
+
+// Message is one message of a conversation
+type Message struct {
+	ID             uuid.UUID `bson:"_id"`
+	ConversationID uuid.UUID `bson:"conversation_id"`
+	Sender         string    `bson:"sender"`
+	Text           string    `bson:"text"`
+	CreatedAt      time.Time `bson:"created_at"`
+}
+
+// ConversationRequest is the body of a request starting a conversation
+type ConversationRequest struct {
+	// Participants are the people to talk to, without the caller
+	Participants []string `json:"participants"`
+}
+
+// DMSettings is who can start a conversation with the caller
+type DMSettings struct {
+	AllowFrom string `json:"allow_from"`
+}
+
+// ReadReceipt tells how far a participant has read a conversation
+type ReadReceipt struct {
+	Username string    `json:"username"`
+	ReadAt   time.Time `json:"read_at"`
+}
+
+// ConversationResp is a conversation as the API returns it to one of its participants
+type ConversationResp struct {
+	ID            uuid.UUID    `json:"id"`
+	Participants  []string     `json:"participants"`
+	Group         bool         `json:"group"`
+	CreatedBy     string       `json:"created_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+	LastMessageAt time.Time    `json:"last_message_at"`
+	LastMessage   *MessageResp `json:"last_message,omitempty"`
+	// UnreadCount counts the messages from others the caller has not read yet
+	UnreadCount  int64         `json:"unread_count"`
+	ReadReceipts []ReadReceipt `json:"read_receipts"`
+}
+
+// MessageResp is a message as the API returns it
+type MessageResp struct {
+	ID             uuid.UUID `json:"id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Sender         string    `json:"sender"`
+	Text           string    `json:"text"`
+	CreatedAt      time.Time `json:"created_at"`
+	// ReadBy lists the other participants who have read the message
+	ReadBy []string `json:"read_by"`
+}
+
+// ConversationPage is one page of the caller's conversations, most recently active first
+type ConversationPage struct {
+	Conversations []ConversationResp `json:"conversations"`
+	NextCursor    string             `json:"next_cursor,omitempty"`
+	PrevCursor    string             `json:"prev_cursor,omitempty"`
+}
+
+// MessagePage is one page of a conversation's messages, newest first
+type MessagePage struct {
+	Messages   []MessageResp `json:"messages"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	PrevCursor string        `json:"prev_cursor,omitempty"`
+}
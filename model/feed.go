@@ -0,0 +1,15 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// FeedEntry is one tweet pushed into a user's materialized home timeline
+type FeedEntry struct {
+	TweetID   uuid.UUID `json:"tweet_id" bson:"tweet_id"`
+	Author    string    `json:"author" bson:"author"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// InReplyToUser is copied from the tweet so that replies can be filtered without loading it
+	InReplyToUser string `json:"in_reply_to_user,omitempty" bson:"in_reply_to_user,omitempty"`
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Follow is the edge recording that one user follows another
+type Follow struct {
+	ID        uuid.UUID `bson:"_id"`
+	Follower  string    `bson:"follower"`
+	Followee  string    `bson:"followee"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// FollowResp is one entry of a list of followers or followed accounts
+type FollowResp struct {
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowPage is one page of an account's followers or followed accounts, most recently followed first
+type FollowPage struct {
+	Users      []FollowResp `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	PrevCursor string       `json:"prev_cursor,omitempty"`
+}
+
+// FollowRequest is a pending request to follow a protected account
+type FollowRequest struct {
+	ID        uuid.UUID `bson:"_id"`
+	Requester string    `bson:"requester"`
+	Target    string    `bson:"target"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// FollowRequestResp is one entry of the caller's pending follow requests
+type FollowRequestResp struct {
+	Username    string    `json:"username"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// FollowRequestPage is one page of the requests to follow the caller, newest first
+type FollowRequestPage struct {
+	Requests   []FollowRequestResp `json:"requests"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	PrevCursor string              `json:"prev_cursor,omitempty"`
+}
+
+// PrivacySettings is whether the caller's account is protected
+type PrivacySettings struct {
+	Protected bool `json:"protected"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Like records that a user liked a tweet
+type Like struct {
+	ID        uuid.UUID `bson:"_id"`
+	TweetID   uuid.UUID `bson:"tweet_id"`
+	Username  string    `bson:"username"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// LikeResp is one entry of a tweet's "liked by" listing
+type LikeResp struct {
+	Username string    `json:"username"`
+	LikedAt  time.Time `json:"liked_at"`
+}
+
+// LikePage is one page of the users who liked a tweet, most recent like first
+type LikePage struct {
+	Likes      []LikeResp `json:"likes"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	PrevCursor string     `json:"prev_cursor,omitempty"`
+}
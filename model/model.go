@@ -1,21 +1,49 @@
 package model
 
-import "github.com/google/uuid"
+import "time"
 
+// User is an account as it is persisted. It is never written to API responses directly;
+// handlers convert it to a PublicProfile or SelfProfile instead.
 type User struct {
-	Username     string      `json:"username"`
-	FirstName    string      `json:"firstname"`
-	LastName     string      `json:"lastname"`
-	Password     string      `json:"password"`
-	ActiveStatus bool        `json:"active" bson:"active"`
-	Bio          string      `json:"bio" bson:"bio"`
-	Followings   []string    `json:"followings" bson:"followings"`
-	Followers    []string    `json:"followers" bson:"followers"`
-	Input        string      `json:"input" bson:"input"`
-	TweetIDs     []uuid.UUID `json:"tweetids" bson:"tweetids"`
+	Username  string `json:"username"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Password  string `json:"-"`
+	Bio       string `json:"bio" bson:"bio"`
+	// FollowersCount and FollowingCount mirror the user's follow edges, which the store keeps in
+	// step with them
+	FollowersCount int64 `json:"followers_count" bson:"followers_count"`
+	FollowingCount int64 `json:"following_count" bson:"following_count"`
+	// DMPolicy is who can start a conversation with the user; empty means model.DMFollowing
+	DMPolicy string `json:"dm_policy" bson:"dm_policy,omitempty"`
+	// Protected accounts approve each follower, and only show their tweets to them
+	Protected bool `json:"protected" bson:"protected,omitempty"`
+	// DeactivatedAt is when the user asked for the account to be deleted; deactivated accounts
+	// are hidden until they are restored or purged
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty" bson:"deactivated_at,omitempty"`
+	// PurgedAt is when a deleted account was purged, after which only its username is kept
+	PurgedAt *time.Time `json:"purged_at,omitempty" bson:"purged_at,omitempty"`
+}
+
+// Request is the JSON body accepted by the handlers that take user input
+type Request struct {
+	Username  string `json:"username"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Password  string `json:"password"`
+	Bio       string `json:"bio"`
+	Input     string `json:"input"`
 }
 
 type ResponseResult struct {
-	Error  string `json:"error"`
 	Result string `json:"result"`
 }
+
+// APIError is the body of every error response. Code is a stable machine-readable identifier,
+// Message is meant for humans, and Details carries extra structured context such as field errors.
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id"`
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Notification kinds
+const (
+	NotifyFollow  = "follow"
+	NotifyMention = "mention"
+	NotifyReply   = "reply"
+	NotifyQuote   = "quote"
+	NotifyRetweet = "retweet"
+	NotifyLike    = "like"
+	// NotifyFollowRequest asks a protected account to approve a follower, and NotifyFollowAccept
+	// tells the follower it was approved
+	NotifyFollowRequest = "follow_request"
+	NotifyFollowAccept  = "follow_accept"
+)
+
+// Notification tells Recipient that Actor did something involving them
+type Notification struct {
+	ID        uuid.UUID `bson:"_id"`
+	Recipient string    `bson:"recipient"`
+	Kind      string    `bson:"kind"`
+	Actor     string    `bson:"actor"`
+	// TweetID is the recipient's tweet that was liked or retweeted, or the actor's tweet that
+	// mentions, replies to or quotes the recipient. Follows have none.
+	TweetID   *uuid.UUID `bson:"tweet_id,omitempty"`
+	CreatedAt time.Time  `bson:"created_at"`
+	Read      bool       `bson:"read"`
+}
+
+// NotificationGroup folds the notifications of a page that are about the same thing, such as
+// every like of one tweet, into a single entry
+type NotificationGroup struct {
+	Kind string `json:"kind"`
+	// Actors lists who did it, most recent first
+	Actors []string `json:"actors"`
+	// Summary reads like "alice and 3 others liked your tweet"
+	Summary string     `json:"summary"`
+	TweetID *uuid.UUID `json:"tweet_id,omitempty"`
+	// Tweet is the tweet TweetID refers to, unless it has been deleted
+	Tweet *TweetResp `json:"tweet,omitempty"`
+	// CreatedAt is when the most recent of the grouped notifications happened
+	CreatedAt time.Time `json:"created_at"`
+	// Read is false while any of the grouped notifications is unread
+	Read bool `json:"read"`
+}
+
+// NotificationPage is one page of the notifications inbox, newest first
+type NotificationPage struct {
+	Notifications []NotificationGroup `json:"notifications"`
+	// UnreadCount counts every unread notification, not only the ones on the page
+	UnreadCount int64  `json:"unread_count"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	PrevCursor  string `json:"prev_cursor,omitempty"`
+}
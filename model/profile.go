@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// PublicProfile is what anyone can see about a user
+type PublicProfile struct {
+	Username       string `json:"username"`
+	FirstName      string `json:"firstname"`
+	LastName       string `json:"lastname"`
+	Bio            string `json:"bio"`
+	FollowersCount int64  `json:"followers_count"`
+	FollowingCount int64  `json:"following_count"`
+	TweetCount     int64  `json:"tweet_count"`
+	Protected      bool   `json:"protected"`
+}
+
+// SelfProfile is what the authenticated owner sees about their own account
+type SelfProfile struct {
+	PublicProfile
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// SessionInfo describes one of the devices the owner is logged in on
+type SessionInfo struct {
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Current   bool      `json:"current"`
+}
+
+// UserPage is one page of accounts, such as user search results
+type UserPage struct {
+	Users      []PublicProfile `json:"users"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	PrevCursor string          `json:"prev_cursor,omitempty"`
+}
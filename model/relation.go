@@ -0,0 +1,59 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Block records that a user blocked another account
+type Block struct {
+	Blocker   string    `bson:"blocker"`
+	Blocked   string    `bson:"blocked"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// Mute hides an account, or the tweets containing a word, from a user. Exactly one of Account
+// and Word is set.
+type Mute struct {
+	ID       uuid.UUID `bson:"_id"`
+	Username string    `bson:"username"`
+	Account  string    `bson:"account,omitempty"`
+	// Word is a lowercase word, phrase or #hashtag
+	Word      string    `bson:"word,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+	// ExpiresAt ends the mute; mutes without it last until they are undone
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+}
+
+// MuteRequest is the body of a request muting an account or a word
+type MuteRequest struct {
+	// Word is the word, phrase or #hashtag to mute; it is ignored when muting an account
+	Word string `json:"word"`
+	// ExpiresIn is how many seconds the mute lasts; zero mutes until undone
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// BlockResp is one entry of the caller's blocked accounts
+type BlockResp struct {
+	Username  string    `json:"username"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// BlockList is every account the caller blocks, most recently blocked first
+type BlockList struct {
+	Blocks []BlockResp `json:"blocks"`
+}
+
+// MuteResp is a mute as the API returns it
+type MuteResp struct {
+	ID        uuid.UUID  `json:"id"`
+	Account   string     `json:"account,omitempty"`
+	Word      string     `json:"word,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// MuteList is every mute of the caller still in effect, most recent first
+type MuteList struct {
+	Mutes []MuteResp `json:"mutes"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Session is a server-side login session. The bearer token handed to the client is
+// never stored; only its SHA-256 hash is kept as the document ID.
+type Session struct {
+	ID        string    `bson:"_id"`
+	Username  string    `bson:"username"`
+	UserAgent string    `bson:"user_agent"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type LoginResult struct {
+	Result    string    `json:"result"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
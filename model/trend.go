@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Trend is a hashtag trending over a window
+type Trend struct {
+	Tag string `json:"tag"`
+	// TweetCount is how many tweets used the hashtag within the window
+	TweetCount int `json:"tweet_count"`
+	// Score is how far the hashtag's recent use exceeds its usual rate
+	Score float64 `json:"score"`
+}
+
+// Trends lists the top hashtags of a window, highest score first
+type Trends struct {
+	Window string    `json:"window"`
+	AsOf   time.Time `json:"as_of"`
+	Trends []Trend   `json:"trends"`
+}
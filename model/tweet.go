@@ -2,22 +2,102 @@ package model
 
 import (
 	"github.com/google/uuid"
+	"time"
 )
 
 type Tweet struct {
-	ID   uuid.UUID `json:"id,omitempty" bson:"_id"`
-	Text string    `json:"text" bson:"text"`
-	Date string    `json:"date" bson:"date"`
-	Time string    `json:"time" bson:"time"`
+	ID        uuid.UUID `json:"id,omitempty" bson:"_id"`
+	Author    string    `json:"author" bson:"author"`
+	Text      string    `json:"text" bson:"text"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// InReplyToID is the tweet this one answers; it is nil for tweets that start a conversation
+	InReplyToID *uuid.UUID `json:"in_reply_to_tweet_id,omitempty" bson:"in_reply_to_tweet_id,omitempty"`
+	// InReplyToUser is the author of the tweet this one answers
+	InReplyToUser string `json:"in_reply_to_user,omitempty" bson:"in_reply_to_user,omitempty"`
+	// ConversationID is the ID of the tweet that started the thread
+	ConversationID uuid.UUID `json:"conversation_id" bson:"conversation_id"`
+	// RetweetOf is set on retweets to the tweet they reshare; retweets have no text of their own
+	RetweetOf *uuid.UUID `json:"retweet_of,omitempty" bson:"retweet_of,omitempty"`
+	// QuoteOf is set on quote tweets to the tweet they comment on
+	QuoteOf *uuid.UUID `json:"quote_of,omitempty" bson:"quote_of,omitempty"`
+	// RetweetCount and QuoteCount are maintained by the store as retweets and quotes come and go
+	RetweetCount int64 `json:"retweet_count" bson:"retweet_count"`
+	QuoteCount   int64 `json:"quote_count" bson:"quote_count"`
+	// LikeCount is maintained by the store as likes come and go
+	LikeCount int64 `json:"like_count" bson:"like_count"`
+	// Entities are parsed from Text when the tweet is posted
+	Entities Entities `json:"entities" bson:"entities"`
+}
+
+// Entities locates the parts of a tweet's text that clients render as links
+type Entities struct {
+	Hashtags []Entity `json:"hashtags,omitempty" bson:"hashtags,omitempty"`
+	// Mentions name the mentioned accounts as they are spelled on the account, whatever the letter case in the text
+	Mentions []Entity `json:"mentions,omitempty" bson:"mentions,omitempty"`
+	URLs     []Entity `json:"urls,omitempty" bson:"urls,omitempty"`
+	Cashtags []Entity `json:"cashtags,omitempty" bson:"cashtags,omitempty"`
+}
+
+// Entity spans the code points [Start, End) of the text. Text is the hashtag, username or
+// cashtag without its leading sign, or the whole URL.
+type Entity struct {
+	Start int    `json:"start" bson:"start"`
+	End   int    `json:"end" bson:"end"`
+	Text  string `json:"text" bson:"text"`
+}
+
+// Conversation returns the ID of the tweet that started the tweet's thread. Tweets stored
+// before replies existed have no conversation ID and start their own.
+func (t Tweet) Conversation() uuid.UUID {
+	if t.ConversationID == uuid.Nil {
+		return t.ID
+	}
+	return t.ConversationID
 }
 
 type TweetResp struct {
-	User string `json:"user"`
-	Date string `json:"date" bson:"date"`
-	Time string `json:"time" bson:"time"`
-	Text string `json:"text" bson:"text"`
+	ID               uuid.UUID  `json:"id"`
+	User             string     `json:"user"`
+	Date             string     `json:"date" bson:"date"`
+	Time             string     `json:"time" bson:"time"`
+	Text             string     `json:"text" bson:"text"`
+	CreatedAt        time.Time  `json:"created_at"`
+	InReplyToTweetID *uuid.UUID `json:"in_reply_to_tweet_id,omitempty"`
+	InReplyToUser    string     `json:"in_reply_to_user,omitempty"`
+	ConversationID   uuid.UUID  `json:"conversation_id"`
+	RetweetCount     int64      `json:"retweet_count"`
+	QuoteCount       int64      `json:"quote_count"`
+	LikeCount        int64      `json:"like_count"`
+	QuotedTweetID    *uuid.UUID `json:"quoted_tweet_id,omitempty"`
+	Entities         Entities   `json:"entities"`
+	// QuotedTweet embeds the quoted tweet in listings, unless it has been deleted
+	QuotedTweet *TweetResp `json:"quoted_tweet,omitempty"`
+	// RetweetedBy lists who, among the accounts in the listing, retweeted the tweet
+	RetweetedBy []string `json:"retweeted_by,omitempty"`
+}
+
+// ThreadNode is a tweet along with a newest-first page of its direct replies. NextCursor,
+// passed to the thread endpoint of this tweet, fetches the following page of replies.
+// MoreReplies is set when the tweet has replies that are not included, either because they
+// are on a later page or because the tree was cut off at the requested depth.
+type ThreadNode struct {
+	TweetResp
+	Replies     []ThreadNode `json:"replies"`
+	NextCursor  string       `json:"next_cursor,omitempty"`
+	MoreReplies bool         `json:"more_replies"`
+}
+
+// Thread is the reply tree below a tweet. Root is the tweet that started the conversation,
+// included when that is another tweet and it has not been deleted.
+type Thread struct {
+	Root  *TweetResp `json:"root,omitempty"`
+	Tweet ThreadNode `json:"tweet"`
 }
 
+// Timeline is one page of tweets, newest first. NextCursor fetches older tweets and is empty
+// on the last page; PrevCursor fetches tweets newer than the page.
 type Timeline struct {
-	Tweets []TweetResp `json:"tweets"`
+	Tweets     []TweetResp `json:"tweets"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
 }
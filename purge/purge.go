@@ -0,0 +1,272 @@
+// Package purge carries out account deletions. Deleting an account only deactivates it and
+// records a model.Deletion; once its grace period is over, a background loop removes the
+// account's tweets, its likes, its follows and every other reference to it, and finally strips
+// the account down to its username, which stays taken.
+//
+// Every stage only removes what is still there, and the deletion is saved after each one, so a
+// purge stopped by an error or a restart picks up where it left off on the next run.
+package purge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// Options tune the purge service
+type Options struct {
+	// Interval is how often deletions whose grace period is over are looked for
+	Interval time.Duration
+	// BatchSize is how many likes are loaded at a time, and how many tweets are deleted between
+	// two saves of the deletion's progress
+	BatchSize int
+}
+
+// DefaultOptions are sensible settings for a single instance
+var DefaultOptions = Options{
+	Interval:  time.Minute,
+	BatchSize: 100,
+}
+
+// stages maps each stage to the one that follows it
+var stages = map[string]string{
+	model.DeletionTweets:     model.DeletionLikes,
+	model.DeletionLikes:      model.DeletionFollows,
+	model.DeletionFollows:    model.DeletionReferences,
+	model.DeletionReferences: model.DeletionAccount,
+	model.DeletionAccount:    model.DeletionDone,
+}
+
+// Service runs the purge loop
+type Service struct {
+	store store.Store
+	opts  Options
+	wake  chan struct{}
+	quit  chan struct{}
+	stop  sync.Once
+	done  sync.WaitGroup
+}
+
+// New returns a Service over the store. Call Start to begin purging.
+func New(st store.Store, opts Options) *Service {
+	return &Service{
+		store: st,
+		opts:  opts,
+		wake:  make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+	}
+}
+
+// Start launches the loop, which looks for due deletions right away and then every Interval
+func (s *Service) Start() {
+	s.done.Add(1)
+	go s.loop()
+}
+
+// Wake makes the loop look for due deletions now instead of at its next tick
+func (s *Service) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop interrupts the purge in progress, which resumes on the next Start, and waits for the
+// loop to return or for ctx to expire. Stopping again only waits.
+func (s *Service) Stop(ctx context.Context) error {
+	s.stop.Do(func() { close(s.quit) })
+	stopped := make(chan struct{})
+	go func() {
+		s.done.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) loop() {
+	defer s.done.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		s.run(ctx)
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// run purges every deletion that is due, one after the other
+func (s *Service) run(ctx context.Context) {
+	deletions, err := s.store.DueDeletions(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("purge: loading due deletions: %v", err)
+		}
+		return
+	}
+	for _, deletion := range deletions {
+		if ctx.Err() != nil {
+			return
+		}
+		err = s.Purge(ctx, deletion)
+		if err != nil && err != store.ErrNotFound && ctx.Err() == nil {
+			log.Printf("purge: deleting @%s: %v", deletion.Username, err)
+		}
+	}
+}
+
+// Purge runs the remaining stages of the deletion, saving it after each one. It returns
+// store.ErrNotFound if the deletion was cancelled before it could start.
+func (s *Service) Purge(ctx context.Context, deletion model.Deletion) error {
+	if deletion.StartedAt == nil {
+		now := time.Now()
+		err := s.store.StartDeletion(ctx, deletion.ID, now)
+		if err != nil {
+			return err
+		}
+		deletion.StartedAt = &now
+		deletion.Stage = model.DeletionTweets
+	}
+	for deletion.Stage != model.DeletionDone {
+		err := s.stage(ctx, &deletion)
+		if err != nil {
+			err = fmt.Errorf("%s stage: %w", deletion.Stage, err)
+			deletion.Failures++
+			deletion.LastError = err.Error()
+			if ctx.Err() == nil {
+				s.store.UpdateDeletion(ctx, deletion)
+			}
+			return err
+		}
+		deletion.Stage = stages[deletion.Stage]
+		if deletion.Stage == model.DeletionDone {
+			now := time.Now()
+			deletion.FinishedAt = &now
+		}
+		err = s.store.UpdateDeletion(ctx, deletion)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("purge: deleted @%s: %d tweets, %d likes, %d follows", deletion.Username,
+		deletion.TweetsDeleted, deletion.LikesRemoved, deletion.FollowsRemoved)
+	return nil
+}
+
+// stage removes everything the deletion's current stage is about, counting it on the deletion
+func (s *Service) stage(ctx context.Context, deletion *model.Deletion) error {
+	username := deletion.Username
+	switch deletion.Stage {
+	case model.DeletionTweets:
+		// deleting a tweet also removes its retweets and the likes it got
+		tweets, err := s.store.TweetsByAuthor(ctx, username)
+		if err != nil {
+			return err
+		}
+		for i, tweet := range tweets {
+			err = s.store.DeleteTweet(ctx, username, tweet.ID)
+			if err == store.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			deletion.TweetsDeleted++
+			if (i+1)%s.opts.BatchSize == 0 {
+				err = s.store.UpdateDeletion(ctx, *deletion)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case model.DeletionLikes:
+		// the cursor moves past every like seen, so likes that turn out to be gone already are
+		// skipped instead of being read again or ending the stage early
+		page := store.Page{Limit: s.opts.BatchSize}
+		for {
+			likes, err := s.store.UserLikes(ctx, username, page)
+			if err != nil {
+				return err
+			}
+			removed := 0
+			for _, like := range likes {
+				err = s.store.Unlike(ctx, like.TweetID, username)
+				if err == store.ErrNotFound {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				removed++
+			}
+			if removed > 0 {
+				deletion.LikesRemoved += int64(removed)
+				err = s.store.UpdateDeletion(ctx, *deletion)
+				if err != nil {
+					return err
+				}
+			}
+			if len(likes) < s.opts.BatchSize {
+				break
+			}
+			last := likes[len(likes)-1]
+			page.Cursor = &store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+	case model.DeletionFollows:
+		followers, err := s.store.Followers(ctx, username)
+		if err != nil {
+			return err
+		}
+		followings, err := s.store.Followings(ctx, username)
+		if err != nil {
+			return err
+		}
+		edges := make([][2]string, 0, len(followers)+len(followings))
+		for _, follower := range followers {
+			edges = append(edges, [2]string{follower, username})
+		}
+		for _, followee := range followings {
+			edges = append(edges, [2]string{username, followee})
+		}
+		for _, edge := range edges {
+			err = s.store.Unfollow(ctx, edge[0], edge[1])
+			if err == store.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			deletion.FollowsRemoved++
+		}
+	case model.DeletionReferences:
+		return s.store.PurgeReferences(ctx, username)
+	case model.DeletionAccount:
+		// the username stays taken, so no one else inherits its conversations and mentions
+		err := s.store.PurgeAccount(ctx, username, time.Now())
+		if err != store.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+	"twitter-feed/store/storetest"
+)
+
+// requestDeletion deactivates the user's account with a deletion that is already due
+func requestDeletion(t *testing.T, st store.Store, username string) model.Deletion {
+	t.Helper()
+	now := time.Now()
+	deletion := model.Deletion{ID: uuid.New(), Username: username, RequestedAt: now, PurgeAt: now, Stage: model.DeletionPending}
+	err := st.RequestDeletion(context.Background(), deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deletion
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	storetest.CreateUser(t, st, "alice")
+	storetest.CreateUser(t, st, "bob")
+	first := storetest.CreateTweet(t, st, "alice", "first", storetest.At(1))
+	storetest.CreateTweet(t, st, "alice", "second", storetest.At(2))
+	ours := storetest.CreateTweet(t, st, "bob", "from bob", storetest.At(3))
+	retweet := model.Tweet{ID: uuid.New(), Author: "bob", CreatedAt: storetest.At(4), RetweetOf: &first.ID}
+	err := st.CreateTweet(ctx, retweet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, like := range []model.Like{{TweetID: ours.ID, Username: "alice"}, {TweetID: first.ID, Username: "bob"}} {
+		like.ID = uuid.New()
+		like.CreatedAt = storetest.At(5)
+		err = st.Like(ctx, like)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	st.Follow(ctx, "alice", "bob")
+	st.Follow(ctx, "bob", "alice")
+	st.Block(ctx, model.Block{Blocker: "alice", Blocked: "bob", CreatedAt: storetest.At(6)})
+	deletion := requestDeletion(t, st, "alice")
+
+	// a small batch size makes the purge save its progress along the way
+	s := New(st, Options{Interval: time.Hour, BatchSize: 1})
+	err = s.Purge(ctx, deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweets, _ := st.TweetsByAuthor(ctx, "alice")
+	if len(tweets) != 0 {
+		t.Errorf("alice still has %d tweets", len(tweets))
+	}
+	tweets, _ = st.TweetsByAuthor(ctx, "bob")
+	if len(tweets) != 1 || tweets[0].ID != ours.ID || tweets[0].LikeCount != 0 {
+		t.Errorf("bob's tweets = %+v, want his own without alice's like and without his retweet", tweets)
+	}
+	bob, _ := st.GetUser(ctx, "bob")
+	if bob.FollowersCount != 0 || bob.FollowingCount != 0 {
+		t.Errorf("bob still counts %d followers and %d following", bob.FollowersCount, bob.FollowingCount)
+	}
+	blockers, _ := st.BlockedBy(ctx, "bob")
+	if len(blockers) != 0 {
+		t.Errorf("bob is still blocked by %v", blockers)
+	}
+	account, err := st.GetAccount(ctx, "alice")
+	if err != nil || account.PurgedAt == nil || account.FirstName != "" {
+		t.Errorf("alice's account = %+v, %v, want it purged", account, err)
+	}
+	due, _ := st.DueDeletions(ctx, time.Now())
+	if len(due) != 0 {
+		t.Errorf("deletions still due after the purge: %+v", due)
+	}
+
+	// every stage only removes what is left, so purging again is harmless
+	err = s.Purge(ctx, deletion)
+	if err != nil {
+		t.Errorf("purging again: %v", err)
+	}
+}
+
+// staleLikes still lists the likes of the tweets in gone, but unliking them finds nothing, as
+// when the like is removed between the listing and the unlike
+type staleLikes struct {
+	*store.Memory
+	gone map[uuid.UUID]bool
+}
+
+func (s staleLikes) Unlike(ctx context.Context, tweetID uuid.UUID, username string) error {
+	if s.gone[tweetID] {
+		return store.ErrNotFound
+	}
+	return s.Memory.Unlike(ctx, tweetID, username)
+}
+
+func TestPurgeSkipsLikesGone(t *testing.T) {
+	ctx := context.Background()
+	st := staleLikes{Memory: store.NewMemory(), gone: make(map[uuid.UUID]bool)}
+	storetest.CreateUser(t, st, "alice")
+	storetest.CreateUser(t, st, "bob")
+	for i := 1; i <= 5; i++ {
+		tweet := storetest.CreateTweet(t, st, "bob", fmt.Sprint("tweet ", i), storetest.At(i))
+		err := st.Like(ctx, model.Like{ID: uuid.New(), TweetID: tweet.ID, Username: "alice", CreatedAt: storetest.At(10 + i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the newest likes fill the first pages
+		if i >= 4 {
+			st.gone[tweet.ID] = true
+		}
+	}
+	deletion := requestDeletion(t, st, "alice")
+	err := New(st, Options{Interval: time.Hour, BatchSize: 2}).Purge(ctx, deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	likes, _ := st.UserLikes(ctx, "alice", store.Page{Limit: 10})
+	if len(likes) != 2 {
+		t.Errorf("alice has %d likes left, want only the 2 that were gone", len(likes))
+	}
+	tweets, _ := st.TweetsByAuthor(ctx, "bob")
+	for _, tweet := range tweets {
+		if want := map[bool]int64{true: 1, false: 0}[st.gone[tweet.ID]]; tweet.LikeCount != want {
+			t.Errorf("%q has %d likes, want %d", tweet.Text, tweet.LikeCount, want)
+		}
+	}
+}
+
+func TestPurgeCancelled(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	storetest.CreateUser(t, st, "alice")
+	storetest.CreateTweet(t, st, "alice", "still here", storetest.At(1))
+	deletion := requestDeletion(t, st, "alice")
+	err := st.CancelDeletion(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = New(st, DefaultOptions).Purge(ctx, deletion)
+	if err != store.ErrNotFound {
+		t.Errorf("purging a cancelled deletion: got %v, want store.ErrNotFound", err)
+	}
+	tweets, _ := st.TweetsByAuthor(ctx, "alice")
+	if len(tweets) != 1 {
+		t.Errorf("alice has %d tweets left, want 1", len(tweets))
+	}
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	s := New(st, Options{Interval: time.Hour, BatchSize: 10})
+	s.Start()
+	storetest.CreateUser(t, st, "alice")
+	requestDeletion(t, st, "alice")
+	s.Wake()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		account, err := st.GetAccount(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if account.PurgedAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the service did not purge alice after being woken")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err := s.Stop(stopCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Stop(stopCtx)
+	if err != nil {
+		t.Errorf("stopping twice: %v", err)
+	}
+}
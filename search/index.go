@@ -0,0 +1,95 @@
+package search
+
+import (
+	"github.com/google/uuid"
+	"math"
+	"sync"
+)
+
+// Index is an inverted index from words to the documents containing them. It is safe for
+// concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// postings maps each word to the documents containing it and how often they do
+	postings map[string]map[uuid.UUID]int
+	docs     int
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{postings: make(map[string]map[uuid.UUID]int)}
+}
+
+// Add indexes the words of text under id
+func (ix *Index) Add(id uuid.UUID, text string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, word := range Words(text) {
+		docs, ok := ix.postings[word]
+		if !ok {
+			docs = make(map[uuid.UUID]int)
+			ix.postings[word] = docs
+		}
+		docs[id]++
+	}
+	ix.docs++
+}
+
+// Remove drops the document added under id with the given text
+func (ix *Index) Remove(id uuid.UUID, text string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, word := range Words(text) {
+		docs := ix.postings[word]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(ix.postings, word)
+		}
+	}
+	ix.docs--
+}
+
+// Lookup returns the documents containing every one of the words
+func (ix *Index) Lookup(words []string) map[uuid.UUID]bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	found := make(map[uuid.UUID]bool)
+	if len(words) == 0 {
+		return found
+	}
+	// start from the rarest word so the intersection stays small
+	rarest := words[0]
+	for _, word := range words[1:] {
+		if len(ix.postings[word]) < len(ix.postings[rarest]) {
+			rarest = word
+		}
+	}
+	for id := range ix.postings[rarest] {
+		all := true
+		for _, word := range words {
+			if _, ok := ix.postings[word][id]; !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			found[id] = true
+		}
+	}
+	return found
+}
+
+// Score rates how relevant the document is to the words with tf-idf: words that appear often in
+// the document and rarely elsewhere count the most
+func (ix *Index) Score(id uuid.UUID, words []string) float64 {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	score := 0.0
+	for _, word := range words {
+		docs := ix.postings[word]
+		if tf := docs[id]; tf > 0 {
+			score += float64(tf) * math.Log(1+float64(ix.docs)/float64(len(docs)))
+		}
+	}
+	return score
+}
@@ -0,0 +1,50 @@
+package search
+
+import (
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	ix := NewIndex()
+	gophers, rust, both, other := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	ix.Add(gophers, "Go go GO, said the gophers")
+	ix.Add(rust, "Rust and more rust")
+	ix.Add(both, "go or rust?")
+	ix.Add(other, "nothing to see here")
+
+	found := ix.Lookup([]string{"go"})
+	if len(found) != 2 || !found[gophers] || !found[both] {
+		t.Errorf("Lookup(go) = %v, want the two tweets about go", found)
+	}
+	found = ix.Lookup([]string{"rust", "go"})
+	if len(found) != 1 || !found[both] {
+		t.Errorf("Lookup(rust go) = %v, want the tweet with both", found)
+	}
+	if found = ix.Lookup([]string{"java"}); len(found) != 0 {
+		t.Errorf("Lookup(java) = %v, want nothing", found)
+	}
+	if found = ix.Lookup(nil); len(found) != 0 {
+		t.Errorf("Lookup() = %v, want nothing", found)
+	}
+
+	// repeated words count more, and rare words more than common ones
+	if ix.Score(gophers, []string{"go"}) <= ix.Score(both, []string{"go"}) {
+		t.Error("a tweet saying go three times does not outrank one saying it once")
+	}
+	if ix.Score(both, []string{"or"}) <= ix.Score(both, []string{"go"}) {
+		t.Error("a word found in one tweet does not outweigh one found in two")
+	}
+	if score := ix.Score(other, []string{"go"}); score != 0 {
+		t.Errorf("score of a tweet without the word = %v, want 0", score)
+	}
+
+	ix.Remove(gophers, "Go go GO, said the gophers")
+	found = ix.Lookup([]string{"go"})
+	if len(found) != 1 || !found[both] {
+		t.Errorf("Lookup(go) after removing a tweet = %v", found)
+	}
+	if found = ix.Lookup([]string{"gophers"}); len(found) != 0 {
+		t.Errorf("Lookup(gophers) after removing the only tweet with it = %v", found)
+	}
+}
@@ -0,0 +1,208 @@
+// Package search parses search queries and holds the in-process inverted index the in-memory
+// store searches tweets with. Text is split into lowercase words of letters, digits, combining
+// marks and underscores, without stemming or stop words, which matches how the Mongo store's
+// text index is configured.
+package search
+
+import (
+	"errors"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"time"
+	"twitter-feed/model"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Orders results can be ranked in
+const (
+	Recent    = "recent"
+	Relevance = "relevance"
+)
+
+// ErrEmpty is returned for a query with nothing to look for
+var ErrEmpty = errors.New("search: empty query")
+
+// ErrBadDate is returned when since: or until: is not a YYYY-MM-DD date
+var ErrBadDate = errors.New("search: dates must look like 2006-01-02")
+
+// Query is a parsed tweet search. Every condition must hold for a tweet to match.
+type Query struct {
+	// Terms must each appear as a word of the text
+	Terms []string
+	// Phrases must each appear as consecutive words of the text
+	Phrases [][]string
+	// Exclude are words the text must not contain
+	Exclude []string
+	// From restricts the authors, matched in any letter case
+	From []string
+	// Hashtags must each be one of the tweet's hashtags, matched in any letter case
+	Hashtags []string
+	// Since and Until bound the creation time when not zero; Until is exclusive
+	Since time.Time
+	Until time.Time
+}
+
+// Parse reads a query made of words, "quoted phrases", #hashtags, -excluded words and the
+// from:username, since:YYYY-MM-DD and until:YYYY-MM-DD operators. Dates are in UTC.
+func Parse(raw string) (Query, error) {
+	var q Query
+	raw = norm.NFC.String(raw)
+	for raw = strings.TrimSpace(raw); raw != ""; raw = strings.TrimSpace(raw) {
+		if raw[0] == '"' {
+			end := strings.IndexByte(raw[1:], '"')
+			var phrase string
+			if end < 0 {
+				phrase, raw = raw[1:], ""
+			} else {
+				phrase, raw = raw[1:end+1], raw[end+2:]
+			}
+			if words := Words(phrase); len(words) > 0 {
+				q.Phrases = append(q.Phrases, words)
+			}
+			continue
+		}
+		token := raw
+		if end := strings.IndexFunc(raw, unicode.IsSpace); end >= 0 {
+			token, raw = raw[:end], raw[end:]
+		} else {
+			raw = ""
+		}
+		err := q.add(token)
+		if err != nil {
+			return q, err
+		}
+	}
+	if len(q.Terms) == 0 && len(q.Phrases) == 0 && len(q.From) == 0 && len(q.Hashtags) == 0 {
+		return q, ErrEmpty
+	}
+	return q, nil
+}
+
+func (q *Query) add(token string) error {
+	lower := strings.ToLower(token)
+	var err error
+	switch {
+	case strings.HasPrefix(lower, "from:"):
+		if user := strings.TrimPrefix(token[len("from:"):], "@"); user != "" {
+			q.From = append(q.From, user)
+		}
+	case strings.HasPrefix(lower, "since:"):
+		q.Since, err = parseDate(token[len("since:"):])
+	case strings.HasPrefix(lower, "until:"):
+		q.Until, err = parseDate(token[len("until:"):])
+	case strings.HasPrefix(token, "#") || strings.HasPrefix(token, "＃"):
+		_, size := utf8.DecodeRuneInString(token)
+		q.Hashtags = append(q.Hashtags, Words(token[size:])...)
+	case strings.HasPrefix(token, "-") && len(token) > 1:
+		q.Exclude = append(q.Exclude, Words(token[1:])...)
+	default:
+		q.Terms = append(q.Terms, Words(token)...)
+	}
+	return err
+}
+
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, ErrBadDate
+	}
+	return t, nil
+}
+
+// Muted returns the query matching the tweets that muting word hides: those with a hashtag
+// muted as #hashtag, or containing the words of anything else in a row
+func Muted(word string) Query {
+	if strings.HasPrefix(word, "#") || strings.HasPrefix(word, "＃") {
+		_, size := utf8.DecodeRuneInString(word)
+		return Query{Hashtags: Words(word[size:])}
+	}
+	return Query{Phrases: [][]string{Words(word)}}
+}
+
+// Words splits text into lowercase words
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_')
+	})
+}
+
+// Match reports whether the tweet meets every condition of the query
+func (q Query) Match(tweet model.Tweet) bool {
+	if tweet.RetweetOf != nil {
+		return false
+	}
+	if !q.Since.IsZero() && tweet.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !tweet.CreatedAt.Before(q.Until) {
+		return false
+	}
+	if len(q.From) > 0 && !containsFold(q.From, tweet.Author) {
+		return false
+	}
+	for _, tag := range q.Hashtags {
+		found := false
+		for _, hashtag := range tweet.Entities.Hashtags {
+			found = found || strings.EqualFold(hashtag.Text, tag)
+		}
+		if !found {
+			return false
+		}
+	}
+	words := Words(tweet.Text)
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	for _, term := range q.Terms {
+		if !set[term] {
+			return false
+		}
+	}
+	for _, term := range q.Exclude {
+		if set[term] {
+			return false
+		}
+	}
+	for _, phrase := range q.Phrases {
+		if !containsPhrase(words, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+// Keywords lists the words a matching tweet is known to contain, which rank it by relevance
+func (q Query) Keywords() []string {
+	keywords := append([]string{}, q.Terms...)
+	for _, phrase := range q.Phrases {
+		keywords = append(keywords, phrase...)
+	}
+	return keywords
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPhrase(words []string, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		match := true
+		for j, word := range phrase {
+			if words[i+j] != word {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"twitter-feed/model"
+)
+
+func TestParse(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	cases := []struct {
+		raw  string
+		want Query
+		err  error
+	}{
+		{"Go  Rust", Query{Terms: []string{"go", "rust"}}, nil},
+		{"don't-panic", Query{Terms: []string{"don", "t", "panic"}}, nil},
+		{`"Hello, World" go`, Query{Terms: []string{"go"}, Phrases: [][]string{{"hello", "world"}}}, nil},
+		// an unterminated quote runs to the end of the query
+		{`go "to the end`, Query{Terms: []string{"go"}, Phrases: [][]string{{"to", "the", "end"}}}, nil},
+		{`"" go`, Query{Terms: []string{"go"}}, nil},
+		{"from:Alice FROM:@bob", Query{From: []string{"Alice", "bob"}}, nil},
+		{"#GoLang ＃rust", Query{Hashtags: []string{"golang", "rust"}}, nil},
+		{"go -rust -", Query{Terms: []string{"go"}, Exclude: []string{"rust"}}, nil},
+		{"go since:2021-06-01 until:2021-07-01", Query{Terms: []string{"go"}, Since: day("2021-06-01"), Until: day("2021-07-01")}, nil},
+		// NFC folds the decomposed é of the query into the composed one of stored text
+		{"cafe\u0301", Query{Terms: []string{"caf\u00e9"}}, nil},
+		{"", Query{}, ErrEmpty},
+		{"   ", Query{}, ErrEmpty},
+		{"-rust -java", Query{}, ErrEmpty},
+		{"since:2021-06-01", Query{}, ErrEmpty},
+		{`""`, Query{}, ErrEmpty},
+		{"go since:yesterday", Query{}, ErrBadDate},
+		{"go until:2021-13-01", Query{}, ErrBadDate},
+	}
+	for _, c := range cases {
+		got, err := Parse(c.raw)
+		if err != c.err {
+			t.Errorf("Parse(%q) error = %v, want %v", c.raw, err, c.err)
+			continue
+		}
+		if err == nil && fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", c.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	created := time.Date(2021, time.June, 15, 12, 0, 0, 0, time.UTC)
+	tweet := model.Tweet{
+		Author:    "alice",
+		Text:      "Hello, brave new World of #Go",
+		CreatedAt: created,
+		Entities:  model.Entities{Hashtags: []model.Entity{{Start: 26, End: 29, Text: "Go"}}},
+	}
+	cases := []struct {
+		raw  string
+		want bool
+	}{
+		{"hello world", true},
+		{"hello rust", false},
+		{"wor", false},
+		{`"new world"`, true},
+		{`"world new"`, false},
+		{"hello -rust", true},
+		{"hello -brave", false},
+		{"from:ALICE", true},
+		{"from:bob hello", false},
+		{"#go", true},
+		{"#golang", false},
+		{"go since:2021-06-15", true},
+		{"go since:2021-06-16", false},
+		{"go until:2021-06-16", true},
+		// until is exclusive
+		{"go until:2021-06-15", false},
+	}
+	for _, c := range cases {
+		q, err := Parse(c.raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.raw, err)
+		}
+		if got := q.Match(tweet); got != c.want {
+			t.Errorf("%q matches = %v, want %v", c.raw, got, c.want)
+		}
+	}
+	retweet := tweet
+	retweet.RetweetOf = &retweet.ID
+	q, _ := Parse("hello")
+	if q.Match(retweet) {
+		t.Error("a retweet matched")
+	}
+}
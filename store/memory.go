@@ -0,0 +1,1252 @@
+package store
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/search"
+)
+
+// Memory is a Store that keeps everything in process memory. It is meant for tests and
+// for running the API locally without MongoDB; nothing survives a restart.
+type Memory struct {
+	mu            sync.RWMutex
+	users         map[string]*model.User
+	tweets        map[uuid.UUID]model.Tweet
+	sessions      map[string]model.Session
+	feeds         map[string][]model.FeedEntry
+	celebrities   map[string]bool
+	likes         map[uuid.UUID]model.Like
+	notifications map[uuid.UUID]model.Notification
+	conversations map[uuid.UUID]model.Conversation
+	messages      map[uuid.UUID]model.Message
+	blocks        []model.Block
+	mutes         map[uuid.UUID]model.Mute
+	follows       map[uuid.UUID]model.Follow
+	requests      map[uuid.UUID]model.FollowRequest
+	deletions     map[uuid.UUID]model.Deletion
+	// index holds the words of every tweet except retweets
+	index *search.Index
+}
+
+// NewMemory returns an empty in-memory Store
+func NewMemory() *Memory {
+	return &Memory{
+		users:         make(map[string]*model.User),
+		tweets:        make(map[uuid.UUID]model.Tweet),
+		sessions:      make(map[string]model.Session),
+		feeds:         make(map[string][]model.FeedEntry),
+		celebrities:   make(map[string]bool),
+		likes:         make(map[uuid.UUID]model.Like),
+		index:         search.NewIndex(),
+		notifications: make(map[uuid.UUID]model.Notification),
+		conversations: make(map[uuid.UUID]model.Conversation),
+		messages:      make(map[uuid.UUID]model.Message),
+		mutes:         make(map[uuid.UUID]model.Mute),
+		follows:       make(map[uuid.UUID]model.Follow),
+		requests:      make(map[uuid.UUID]model.FollowRequest),
+		deletions:     make(map[uuid.UUID]model.Deletion),
+	}
+}
+
+// pageTweets cuts the requested page out of an unordered set of tweets, newest first
+func pageTweets(tweets []model.Tweet, page Page) []model.Tweet {
+	indexes := pageIndexes(len(tweets), func(i int) (time.Time, uuid.UUID) {
+		return tweets[i].CreatedAt, tweets[i].ID
+	}, page)
+	out := make([]model.Tweet, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, tweets[i])
+	}
+	return out
+}
+
+// pageIndexes cuts the requested page out of an unordered set of n items, where at returns
+// the position of the i-th item, and returns the indexes of the items on it, newest first
+func pageIndexes(n int, at func(i int) (time.Time, uuid.UUID), page Page) []int {
+	indexes := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if page.Contains(at(i)) {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		ti, idi := at(indexes[i])
+		tj, idj := at(indexes[j])
+		if page.Newer() {
+			return newer(tj, idj, ti, idi)
+		}
+		return newer(ti, idi, tj, idj)
+	})
+	if len(indexes) > page.Limit {
+		indexes = indexes[:page.Limit]
+	}
+	if page.Newer() {
+		for i, j := 0, len(indexes)-1; i < j; i, j = i+1, j-1 {
+			indexes[i], indexes[j] = indexes[j], indexes[i]
+		}
+	}
+	return indexes
+}
+
+// visible reports whether a tweet by author replying to inReplyTo belongs in the home timeline of
+// someone following followings. Replies only show up when the account replied to is followed too,
+// except for authors replying to themselves.
+func visible(author string, inReplyTo string, followings []string) bool {
+	return inReplyTo == "" || inReplyTo == author || contains(followings, inReplyTo)
+}
+
+// contains reports whether value is in list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateUser(ctx context.Context, user model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for username := range m.users {
+		if strings.EqualFold(username, user.Username) {
+			return ErrDuplicate
+		}
+	}
+	m.users[user.Username] = &user
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, username string) (model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[username]
+	if !ok || user.DeactivatedAt != nil {
+		return model.User{}, ErrNotFound
+	}
+	return *user, nil
+}
+
+func (m *Memory) GetAccount(ctx context.Context, username string) (model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[username]
+	if !ok {
+		return model.User{}, ErrNotFound
+	}
+	return *user, nil
+}
+
+func (m *Memory) Usernames(ctx context.Context, names []string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found := make(map[string]string, len(names))
+	for username, user := range m.users {
+		if user.DeactivatedAt != nil {
+			continue
+		}
+		for _, name := range names {
+			if strings.EqualFold(name, username) {
+				found[name] = username
+			}
+		}
+	}
+	return found, nil
+}
+
+func (m *Memory) UpdatePassword(ctx context.Context, username string, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hash
+	return nil
+}
+
+func (m *Memory) SetDMPolicy(ctx context.Context, username string, policy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	user.DMPolicy = policy
+	return nil
+}
+
+func (m *Memory) SetProtected(ctx context.Context, username string, protected bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Protected = protected
+	return nil
+}
+
+func (m *Memory) ProtectedAccounts(ctx context.Context, usernames []string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	protected := make([]string, 0)
+	for _, username := range usernames {
+		if user, ok := m.users[username]; ok && user.Protected {
+			protected = append(protected, username)
+		}
+	}
+	return protected, nil
+}
+
+func (m *Memory) DeactivatedAccounts(ctx context.Context, usernames []string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	deactivated := make([]string, 0)
+	for _, username := range usernames {
+		if user, ok := m.users[username]; ok && user.DeactivatedAt != nil {
+			deactivated = append(deactivated, username)
+		}
+	}
+	return deactivated, nil
+}
+
+func (m *Memory) CreateTweet(ctx context.Context, tweet model.Tweet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tweets[tweet.ID]; ok {
+		return ErrDuplicate
+	}
+	if tweet.RetweetOf != nil {
+		if _, ok := m.retweet(tweet.Author, *tweet.RetweetOf); ok {
+			return ErrDuplicate
+		}
+	}
+	m.tweets[tweet.ID] = tweet
+	m.count(tweet, 1)
+	if tweet.RetweetOf == nil {
+		m.index.Add(tweet.ID, tweet.Text)
+	}
+	return nil
+}
+
+// count adds delta to the retweet or quote count of the tweet that tweet reshares
+func (m *Memory) count(tweet model.Tweet, delta int64) {
+	if tweet.RetweetOf != nil {
+		if original, ok := m.tweets[*tweet.RetweetOf]; ok {
+			original.RetweetCount += delta
+			m.tweets[original.ID] = original
+		}
+	}
+	if tweet.QuoteOf != nil {
+		if original, ok := m.tweets[*tweet.QuoteOf]; ok {
+			original.QuoteCount += delta
+			m.tweets[original.ID] = original
+		}
+	}
+}
+
+func (m *Memory) retweet(author string, original uuid.UUID) (model.Tweet, bool) {
+	for _, tweet := range m.tweets {
+		if tweet.Author == author && tweet.RetweetOf != nil && *tweet.RetweetOf == original {
+			return tweet, true
+		}
+	}
+	return model.Tweet{}, false
+}
+
+func (m *Memory) GetTweet(ctx context.Context, id uuid.UUID) (model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweet, ok := m.tweets[id]
+	if !ok {
+		return model.Tweet{}, ErrNotFound
+	}
+	return tweet, nil
+}
+
+func (m *Memory) GetTweets(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	byID := make(map[uuid.UUID]model.Tweet, len(ids))
+	for _, id := range ids {
+		if tweet, ok := m.tweets[id]; ok {
+			byID[id] = tweet
+		}
+	}
+	return byID, nil
+}
+
+func (m *Memory) GetRetweet(ctx context.Context, author string, original uuid.UUID) (model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweet, ok := m.retweet(author, original)
+	if !ok {
+		return model.Tweet{}, ErrNotFound
+	}
+	return tweet, nil
+}
+
+func (m *Memory) CountTweets(ctx context.Context, author string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var n int64
+	for _, tweet := range m.tweets {
+		if tweet.Author == author {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) TweetsByAuthor(ctx context.Context, author string) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweets := make([]model.Tweet, 0)
+	for _, tweet := range m.tweets {
+		if tweet.Author == author {
+			tweets = append(tweets, tweet)
+		}
+	}
+	sort.Slice(tweets, func(i, j int) bool {
+		return tweets[i].CreatedAt.Before(tweets[j].CreatedAt)
+	})
+	return tweets, nil
+}
+
+func (m *Memory) TweetsByAuthors(ctx context.Context, authors []string, page Page) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweets := make([]model.Tweet, 0)
+	for _, tweet := range m.tweets {
+		if contains(authors, tweet.Author) {
+			tweets = append(tweets, tweet)
+		}
+	}
+	return pageTweets(tweets, page), nil
+}
+
+func (m *Memory) HomeTimeline(ctx context.Context, username string, page Page) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweets := make([]model.Tweet, 0)
+	followings := m.followings(username)
+	for _, tweet := range m.tweets {
+		if contains(followings, tweet.Author) && visible(tweet.Author, tweet.InReplyToUser, followings) {
+			tweets = append(tweets, tweet)
+		}
+	}
+	return pageTweets(tweets, page), nil
+}
+
+func (m *Memory) TimelineTweets(ctx context.Context, authors []string, followings []string, page Page) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweets := make([]model.Tweet, 0)
+	for _, tweet := range m.tweets {
+		if contains(authors, tweet.Author) && visible(tweet.Author, tweet.InReplyToUser, followings) {
+			tweets = append(tweets, tweet)
+		}
+	}
+	return pageTweets(tweets, page), nil
+}
+
+func (m *Memory) Replies(ctx context.Context, parents []uuid.UUID, page Page) (map[uuid.UUID][]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	byParent := make(map[uuid.UUID][]model.Tweet, len(parents))
+	for _, parent := range parents {
+		byParent[parent] = make([]model.Tweet, 0)
+	}
+	for _, tweet := range m.tweets {
+		if tweet.InReplyToID == nil {
+			continue
+		}
+		if replies, ok := byParent[*tweet.InReplyToID]; ok {
+			byParent[*tweet.InReplyToID] = append(replies, tweet)
+		}
+	}
+	for parent, replies := range byParent {
+		byParent[parent] = pageTweets(replies, page)
+	}
+	return byParent, nil
+}
+
+func (m *Memory) DeleteTweet(ctx context.Context, author string, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tweet, ok := m.tweets[id]
+	if !ok || tweet.Author != author {
+		return ErrNotFound
+	}
+	delete(m.tweets, id)
+	m.count(tweet, -1)
+	if tweet.RetweetOf == nil {
+		m.index.Remove(id, tweet.Text)
+	}
+	for other, retweet := range m.tweets {
+		if retweet.RetweetOf != nil && *retweet.RetweetOf == id {
+			delete(m.tweets, other)
+		}
+	}
+	for likeID, like := range m.likes {
+		if like.TweetID == id {
+			delete(m.likes, likeID)
+		}
+	}
+	return nil
+}
+
+// follow returns the ID of the edge from follower to followee, if there is one. m.mu must be held.
+func (m *Memory) follow(follower string, followee string) (uuid.UUID, bool) {
+	for id, edge := range m.follows {
+		if edge.Follower == follower && edge.Followee == followee {
+			return id, true
+		}
+	}
+	return uuid.UUID{}, false
+}
+
+// countFollow adds delta to the counts of the users on both ends of a follow edge. m.mu must be held.
+func (m *Memory) countFollow(follower string, followee string, delta int64) {
+	if user, ok := m.users[follower]; ok {
+		user.FollowingCount += delta
+	}
+	if user, ok := m.users[followee]; ok {
+		user.FollowersCount += delta
+	}
+}
+
+// followings lists the usernames the user follows. m.mu must be held.
+func (m *Memory) followings(username string) []string {
+	followings := make([]string, 0)
+	for _, edge := range m.follows {
+		if edge.Follower == username {
+			followings = append(followings, edge.Followee)
+		}
+	}
+	return followings
+}
+
+// pageFollows cuts the requested page out of the edges that keep selects, most recent first
+func (m *Memory) pageFollows(keep func(edge model.Follow) bool, page Page) []model.Follow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	edges := make([]model.Follow, 0)
+	for _, edge := range m.follows {
+		if keep(edge) {
+			edges = append(edges, edge)
+		}
+	}
+	indexes := pageIndexes(len(edges), func(i int) (time.Time, uuid.UUID) {
+		return edges[i].CreatedAt, edges[i].ID
+	}, page)
+	out := make([]model.Follow, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, edges[i])
+	}
+	return out
+}
+
+func (m *Memory) Follow(ctx context.Context, follower string, followee string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.follow(follower, followee); ok {
+		return ErrDuplicate
+	}
+	edge := model.Follow{ID: uuid.New(), Follower: follower, Followee: followee, CreatedAt: time.Now()}
+	m.follows[edge.ID] = edge
+	m.countFollow(follower, followee, 1)
+	return nil
+}
+
+func (m *Memory) Unfollow(ctx context.Context, follower string, followee string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.follow(follower, followee)
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.follows, id)
+	m.countFollow(follower, followee, -1)
+	return nil
+}
+
+func (m *Memory) Follows(ctx context.Context, follower string, followee string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.follow(follower, followee)
+	return ok, nil
+}
+
+func (m *Memory) Followings(ctx context.Context, username string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.followings(username), nil
+}
+
+func (m *Memory) Followers(ctx context.Context, username string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	followers := make([]string, 0)
+	for _, edge := range m.follows {
+		if edge.Followee == username {
+			followers = append(followers, edge.Follower)
+		}
+	}
+	return followers, nil
+}
+
+func (m *Memory) FollowingPage(ctx context.Context, username string, page Page) ([]model.Follow, error) {
+	return m.pageFollows(func(edge model.Follow) bool { return edge.Follower == username }, page), nil
+}
+
+func (m *Memory) FollowersPage(ctx context.Context, username string, page Page) ([]model.Follow, error) {
+	return m.pageFollows(func(edge model.Follow) bool { return edge.Followee == username }, page), nil
+}
+
+func (m *Memory) RequestFollow(ctx context.Context, request model.FollowRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.requests {
+		if other.Requester == request.Requester && other.Target == request.Target {
+			return ErrDuplicate
+		}
+	}
+	m.requests[request.ID] = request
+	return nil
+}
+
+func (m *Memory) FollowRequests(ctx context.Context, target string, page Page) ([]model.FollowRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	requests := make([]model.FollowRequest, 0)
+	for _, request := range m.requests {
+		if request.Target == target {
+			requests = append(requests, request)
+		}
+	}
+	indexes := pageIndexes(len(requests), func(i int) (time.Time, uuid.UUID) {
+		return requests[i].CreatedAt, requests[i].ID
+	}, page)
+	out := make([]model.FollowRequest, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, requests[i])
+	}
+	return out, nil
+}
+
+func (m *Memory) DeleteFollowRequest(ctx context.Context, requester string, target string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, request := range m.requests {
+		if request.Requester == requester && request.Target == target {
+			delete(m.requests, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) CreateSession(ctx context.Context, session model.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[session.ID]; ok {
+		return ErrDuplicate
+	}
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *Memory) GetSession(ctx context.Context, id string) (model.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return model.Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (m *Memory) UserSessions(ctx context.Context, username string) ([]model.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessions := make([]model.Session, 0)
+	for _, session := range m.sessions {
+		if session.Username == username && session.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (m *Memory) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *Memory) DeleteUserSessions(ctx context.Context, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, session := range m.sessions {
+		if session.Username == username {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) PushFeed(ctx context.Context, owners []string, entries []model.FeedEntry, capacity int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, owner := range owners {
+		feed := append(m.feeds[owner], entries...)
+		sort.Slice(feed, func(i, j int) bool {
+			return newer(feed[i].CreatedAt, feed[i].TweetID, feed[j].CreatedAt, feed[j].TweetID)
+		})
+		if len(feed) > capacity {
+			feed = feed[:capacity]
+		}
+		m.feeds[owner] = feed
+	}
+	return nil
+}
+
+func (m *Memory) ReadFeed(ctx context.Context, owner string, authors []string, page Page) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[uuid.UUID]bool)
+	tweets := make([]model.Tweet, 0)
+	for _, entry := range m.feeds[owner] {
+		tweet, ok := m.tweets[entry.TweetID]
+		if !ok || seen[entry.TweetID] || !contains(authors, entry.Author) || !visible(entry.Author, entry.InReplyToUser, authors) {
+			continue
+		}
+		seen[entry.TweetID] = true
+		tweets = append(tweets, tweet)
+	}
+	return pageTweets(tweets, page), nil
+}
+
+func (m *Memory) MarkCelebrity(ctx context.Context, author string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.celebrities[author] = true
+	return nil
+}
+
+func (m *Memory) Celebrities(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	authors := make([]string, 0, len(m.celebrities))
+	for author := range m.celebrities {
+		authors = append(authors, author)
+	}
+	return authors, nil
+}
+
+func (m *Memory) Like(ctx context.Context, like model.Like) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.likes {
+		if other.TweetID == like.TweetID && other.Username == like.Username {
+			return ErrDuplicate
+		}
+	}
+	tweet, ok := m.tweets[like.TweetID]
+	if !ok {
+		return ErrNotFound
+	}
+	m.likes[like.ID] = like
+	tweet.LikeCount++
+	m.tweets[tweet.ID] = tweet
+	return nil
+}
+
+func (m *Memory) Unlike(ctx context.Context, tweetID uuid.UUID, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, like := range m.likes {
+		if like.TweetID == tweetID && like.Username == username {
+			delete(m.likes, id)
+			if tweet, ok := m.tweets[tweetID]; ok {
+				tweet.LikeCount--
+				m.tweets[tweet.ID] = tweet
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) TweetLikes(ctx context.Context, tweetID uuid.UUID, page Page) ([]model.Like, error) {
+	return m.pageLikes(func(like model.Like) bool { return like.TweetID == tweetID }, page), nil
+}
+
+func (m *Memory) UserLikes(ctx context.Context, username string, page Page) ([]model.Like, error) {
+	return m.pageLikes(func(like model.Like) bool { return like.Username == username }, page), nil
+}
+
+func (m *Memory) pageLikes(match func(model.Like) bool, page Page) []model.Like {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	likes := make([]model.Like, 0)
+	for _, like := range m.likes {
+		if match(like) {
+			likes = append(likes, like)
+		}
+	}
+	indexes := pageIndexes(len(likes), func(i int) (time.Time, uuid.UUID) {
+		return likes[i].CreatedAt, likes[i].ID
+	}, page)
+	out := make([]model.Like, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, likes[i])
+	}
+	return out
+}
+
+func (m *Memory) SearchTweets(ctx context.Context, q search.Query, page Page) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return pageTweets(m.matches(q), page), nil
+}
+
+func (m *Memory) RankTweets(ctx context.Context, q search.Query, offset int, limit int) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweets := m.matches(q)
+	keywords := q.Keywords()
+	scores := make(map[uuid.UUID]float64, len(tweets))
+	for _, tweet := range tweets {
+		scores[tweet.ID] = m.index.Score(tweet.ID, keywords)
+	}
+	sort.Slice(tweets, func(i, j int) bool {
+		if si, sj := scores[tweets[i].ID], scores[tweets[j].ID]; si != sj {
+			return si > sj
+		}
+		return newer(tweets[i].CreatedAt, tweets[i].ID, tweets[j].CreatedAt, tweets[j].ID)
+	})
+	lo, hi := window(len(tweets), offset, limit)
+	return tweets[lo:hi], nil
+}
+
+// matches returns the tweets matching the query, in no particular order. Queries with words
+// only look at the tweets the index finds them in.
+func (m *Memory) matches(q search.Query) []model.Tweet {
+	tweets := make([]model.Tweet, 0)
+	if keywords := q.Keywords(); len(keywords) > 0 {
+		for id := range m.index.Lookup(keywords) {
+			if tweet, ok := m.tweets[id]; ok && q.Match(tweet) {
+				tweets = append(tweets, tweet)
+			}
+		}
+		return tweets
+	}
+	for _, tweet := range m.tweets {
+		if q.Match(tweet) {
+			tweets = append(tweets, tweet)
+		}
+	}
+	return tweets
+}
+
+func (m *Memory) SearchUsers(ctx context.Context, prefixes []string, offset int, limit int) ([]model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]model.User, 0)
+	ranks := make(map[string]int)
+	for _, user := range m.users {
+		if user.DeactivatedAt != nil || !prefixMatch(user, prefixes) {
+			continue
+		}
+		users = append(users, *user)
+		ranks[user.Username] = userRank(user.Username, prefixes[0])
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if ri, rj := ranks[users[i].Username], ranks[users[j].Username]; ri != rj {
+			return ri < rj
+		}
+		return users[i].Username < users[j].Username
+	})
+	lo, hi := window(len(users), offset, limit)
+	return users[lo:hi], nil
+}
+
+// window returns the bounds of the limit items after the first offset of n
+func window(n int, offset int, limit int) (int, int) {
+	lo := offset
+	if lo > n {
+		lo = n
+	}
+	hi := lo + limit
+	if hi > n {
+		hi = n
+	}
+	return lo, hi
+}
+
+// prefixMatch reports whether every prefix starts the user's username, first name or last name
+func prefixMatch(user *model.User, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(strings.ToLower(user.Username), prefix) &&
+			!strings.HasPrefix(strings.ToLower(user.FirstName), prefix) &&
+			!strings.HasPrefix(strings.ToLower(user.LastName), prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// userRank orders user search results: 0 when the username is prefix, 1 when it starts with it, 2 otherwise
+func userRank(username string, prefix string) int {
+	switch lower := strings.ToLower(username); {
+	case lower == prefix:
+		return 0
+	case strings.HasPrefix(lower, prefix):
+		return 1
+	}
+	return 2
+}
+
+func (m *Memory) Mentions(ctx context.Context, username string, page Page) ([]model.Tweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tweets := make([]model.Tweet, 0)
+	for _, tweet := range m.tweets {
+		for _, mention := range tweet.Entities.Mentions {
+			if mention.Text == username {
+				tweets = append(tweets, tweet)
+				break
+			}
+		}
+	}
+	return pageTweets(tweets, page), nil
+}
+
+func (m *Memory) AddNotifications(ctx context.Context, notifications []model.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, notification := range notifications {
+		m.notifications[notification.ID] = notification
+	}
+	return nil
+}
+
+func (m *Memory) Notifications(ctx context.Context, recipient string, page Page) ([]model.Notification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	notifications := make([]model.Notification, 0)
+	for _, notification := range m.notifications {
+		if notification.Recipient == recipient {
+			notifications = append(notifications, notification)
+		}
+	}
+	indexes := pageIndexes(len(notifications), func(i int) (time.Time, uuid.UUID) {
+		return notifications[i].CreatedAt, notifications[i].ID
+	}, page)
+	out := make([]model.Notification, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, notifications[i])
+	}
+	return out, nil
+}
+
+func (m *Memory) UnreadCount(ctx context.Context, recipient string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var unread int64
+	for _, notification := range m.notifications {
+		if notification.Recipient == recipient && !notification.Read {
+			unread++
+		}
+	}
+	return unread, nil
+}
+
+func (m *Memory) MarkRead(ctx context.Context, recipient string, upTo time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var marked int64
+	for id, notification := range m.notifications {
+		if notification.Recipient == recipient && !notification.Read && !notification.CreatedAt.After(upTo) {
+			notification.Read = true
+			m.notifications[id] = notification
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+// copyConversation returns a copy of the conversation that shares no slices or maps with the stored one
+func copyConversation(conversation model.Conversation) model.Conversation {
+	c := conversation
+	c.Participants = append([]string{}, conversation.Participants...)
+	c.ReadAt = make(map[string]time.Time, len(conversation.ReadAt))
+	for username, at := range conversation.ReadAt {
+		c.ReadAt[username] = at
+	}
+	if conversation.LastMessage != nil {
+		message := *conversation.LastMessage
+		c.LastMessage = &message
+	}
+	return c
+}
+
+func (m *Memory) CreateConversation(ctx context.Context, conversation model.Conversation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.conversations {
+		if existing.Key == conversation.Key {
+			return ErrDuplicate
+		}
+	}
+	m.conversations[conversation.ID] = copyConversation(conversation)
+	return nil
+}
+
+func (m *Memory) GetConversation(ctx context.Context, id uuid.UUID) (model.Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	conversation, ok := m.conversations[id]
+	if !ok {
+		return model.Conversation{}, ErrNotFound
+	}
+	return copyConversation(conversation), nil
+}
+
+func (m *Memory) ConversationByKey(ctx context.Context, key string) (model.Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, conversation := range m.conversations {
+		if conversation.Key == key {
+			return copyConversation(conversation), nil
+		}
+	}
+	return model.Conversation{}, ErrNotFound
+}
+
+func (m *Memory) Conversations(ctx context.Context, username string, page Page) ([]model.Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	conversations := make([]model.Conversation, 0)
+	for _, conversation := range m.conversations {
+		if contains(conversation.Participants, username) {
+			conversations = append(conversations, conversation)
+		}
+	}
+	indexes := pageIndexes(len(conversations), func(i int) (time.Time, uuid.UUID) {
+		return conversations[i].LastMessageAt, conversations[i].ID
+	}, page)
+	out := make([]model.Conversation, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, copyConversation(conversations[i]))
+	}
+	return out, nil
+}
+
+func (m *Memory) AddMessage(ctx context.Context, message model.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages[message.ID] = message
+	conversation, ok := m.conversations[message.ConversationID]
+	if !ok {
+		return nil
+	}
+	if !message.CreatedAt.Before(conversation.LastMessageAt) {
+		conversation.LastMessageAt = message.CreatedAt
+		conversation.LastMessage = &message
+	}
+	if message.CreatedAt.After(conversation.ReadAt[message.Sender]) {
+		conversation.ReadAt[message.Sender] = message.CreatedAt
+	}
+	m.conversations[message.ConversationID] = conversation
+	return nil
+}
+
+func (m *Memory) Messages(ctx context.Context, conversationID uuid.UUID, page Page) ([]model.Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	messages := make([]model.Message, 0)
+	for _, message := range m.messages {
+		if message.ConversationID == conversationID {
+			messages = append(messages, message)
+		}
+	}
+	indexes := pageIndexes(len(messages), func(i int) (time.Time, uuid.UUID) {
+		return messages[i].CreatedAt, messages[i].ID
+	}, page)
+	out := make([]model.Message, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, messages[i])
+	}
+	return out, nil
+}
+
+func (m *Memory) MarkConversationRead(ctx context.Context, conversationID uuid.UUID, username string, upTo time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, ok := m.conversations[conversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	if upTo.After(conversation.ReadAt[username]) {
+		conversation.ReadAt[username] = upTo
+	}
+	return nil
+}
+
+func (m *Memory) UnreadMessages(ctx context.Context, username string, conversations []model.Conversation) (map[uuid.UUID]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	readAt := make(map[uuid.UUID]time.Time, len(conversations))
+	for _, conversation := range conversations {
+		readAt[conversation.ID] = conversation.ReadAt[username]
+	}
+	unread := make(map[uuid.UUID]int64)
+	for _, message := range m.messages {
+		at, ok := readAt[message.ConversationID]
+		if ok && message.Sender != username && message.CreatedAt.After(at) {
+			unread[message.ConversationID]++
+		}
+	}
+	return unread, nil
+}
+
+func (m *Memory) Block(ctx context.Context, block model.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, pair := range [][2]string{{block.Blocker, block.Blocked}, {block.Blocked, block.Blocker}} {
+		if id, ok := m.follow(pair[0], pair[1]); ok {
+			delete(m.follows, id)
+			m.countFollow(pair[0], pair[1], -1)
+		}
+		for id, request := range m.requests {
+			if request.Requester == pair[0] && request.Target == pair[1] {
+				delete(m.requests, id)
+			}
+		}
+	}
+	for _, other := range m.blocks {
+		if other.Blocker == block.Blocker && other.Blocked == block.Blocked {
+			return ErrDuplicate
+		}
+	}
+	m.blocks = append(m.blocks, block)
+	return nil
+}
+
+func (m *Memory) Unblock(ctx context.Context, blocker string, blocked string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, block := range m.blocks {
+		if block.Blocker == blocker && block.Blocked == blocked {
+			m.blocks = append(m.blocks[:i], m.blocks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) Blocks(ctx context.Context, blocker string) ([]model.Block, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	blocks := make([]model.Block, 0)
+	for i := len(m.blocks) - 1; i >= 0; i-- {
+		if m.blocks[i].Blocker == blocker {
+			blocks = append(blocks, m.blocks[i])
+		}
+	}
+	return blocks, nil
+}
+
+func (m *Memory) BlockedBy(ctx context.Context, blocked string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	blockers := make([]string, 0)
+	for _, block := range m.blocks {
+		if block.Blocked == blocked {
+			blockers = append(blockers, block.Blocker)
+		}
+	}
+	return blockers, nil
+}
+
+func (m *Memory) Mute(ctx context.Context, mute model.Mute) (model.Mute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, other := range m.mutes {
+		if other.Username == mute.Username && other.Account == mute.Account && other.Word == mute.Word {
+			other.ExpiresAt = mute.ExpiresAt
+			m.mutes[id] = other
+			return other, nil
+		}
+	}
+	m.mutes[mute.ID] = mute
+	return mute, nil
+}
+
+func (m *Memory) Unmute(ctx context.Context, username string, account string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, mute := range m.mutes {
+		if mute.Username == username && mute.Account == account {
+			delete(m.mutes, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) UnmuteWord(ctx context.Context, username string, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mute, ok := m.mutes[id]
+	if !ok || mute.Username != username || mute.Word == "" {
+		return ErrNotFound
+	}
+	delete(m.mutes, id)
+	return nil
+}
+
+func (m *Memory) Mutes(ctx context.Context, username string, now time.Time) ([]model.Mute, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mutes := make([]model.Mute, 0)
+	for _, mute := range m.mutes {
+		if mute.Username == username && (mute.ExpiresAt == nil || mute.ExpiresAt.After(now)) {
+			mutes = append(mutes, mute)
+		}
+	}
+	sort.Slice(mutes, func(i, j int) bool {
+		return newer(mutes[i].CreatedAt, mutes[i].ID, mutes[j].CreatedAt, mutes[j].ID)
+	})
+	return mutes, nil
+}
+
+func (m *Memory) RequestDeletion(ctx context.Context, deletion model.Deletion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[deletion.Username]
+	if !ok || user.DeactivatedAt != nil {
+		return ErrNotFound
+	}
+	if _, ok := m.deletions[deletion.ID]; ok {
+		return ErrDuplicate
+	}
+	at := deletion.RequestedAt
+	user.DeactivatedAt = &at
+	m.deletions[deletion.ID] = deletion
+	return nil
+}
+
+func (m *Memory) UpdateDeletion(ctx context.Context, deletion model.Deletion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deletions[deletion.ID]; !ok {
+		return ErrNotFound
+	}
+	m.deletions[deletion.ID] = deletion
+	return nil
+}
+
+func (m *Memory) CancelDeletion(ctx context.Context, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, deletion := range m.deletions {
+		if deletion.Username == username && deletion.StartedAt == nil {
+			delete(m.deletions, id)
+			if user, ok := m.users[username]; ok {
+				user.DeactivatedAt = nil
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) StartDeletion(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deletion, ok := m.deletions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if deletion.StartedAt == nil {
+		deletion.StartedAt = &at
+		deletion.Stage = model.DeletionTweets
+		m.deletions[id] = deletion
+	}
+	return nil
+}
+
+func (m *Memory) DueDeletions(ctx context.Context, now time.Time) ([]model.Deletion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	due := make([]model.Deletion, 0)
+	for _, deletion := range m.deletions {
+		if deletion.FinishedAt == nil && !deletion.PurgeAt.After(now) {
+			due = append(due, deletion)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].PurgeAt.Before(due[j].PurgeAt)
+	})
+	return due, nil
+}
+
+func (m *Memory) PurgeReferences(ctx context.Context, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, notification := range m.notifications {
+		if notification.Recipient == username || notification.Actor == username {
+			delete(m.notifications, id)
+		}
+	}
+	blocks := m.blocks[:0]
+	for _, block := range m.blocks {
+		if block.Blocker != username && block.Blocked != username {
+			blocks = append(blocks, block)
+		}
+	}
+	m.blocks = blocks
+	for id, mute := range m.mutes {
+		if mute.Username == username || mute.Account == username {
+			delete(m.mutes, id)
+		}
+	}
+	for id, request := range m.requests {
+		if request.Requester == username || request.Target == username {
+			delete(m.requests, id)
+		}
+	}
+	for id, session := range m.sessions {
+		if session.Username == username {
+			delete(m.sessions, id)
+		}
+	}
+	delete(m.feeds, username)
+	delete(m.celebrities, username)
+	return nil
+}
+
+func (m *Memory) PurgeAccount(ctx context.Context, username string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	*user = model.User{Username: user.Username, DeactivatedAt: user.DeactivatedAt, PurgedAt: &at}
+	return nil
+}
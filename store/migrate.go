@@ -0,0 +1,340 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"time"
+	"twitter-feed/model"
+)
+
+// legacyTweet is a tweet document as it was stored in the shared users collection
+type legacyTweet struct {
+	ID   uuid.UUID `bson:"_id"`
+	Text string    `bson:"text"`
+	Date string    `bson:"date"`
+	Time string    `bson:"time"`
+}
+
+// legacyOwner is the part of a legacy user document that lists the tweets it posted
+type legacyOwner struct {
+	Username string      `bson:"username"`
+	TweetIDs []uuid.UUID `bson:"tweetids"`
+}
+
+// MigrationReport describes what SplitTweets did, or would do on a dry run
+type MigrationReport struct {
+	TweetsMoved    int
+	UndatedTweets  int
+	OrphanedTweets []uuid.UUID
+	UsersCleaned   int64
+	// DuplicateUsernames lists, lowercased, the usernames held by more than one account when case is ignored
+	DuplicateUsernames []string
+}
+
+// SplitTweets moves the tweets stored in the legacy shared users collection into the tweets
+// collection, stamping each with its author and a real timestamp, strips the old per-user
+// tweet lists and scratch fields and creates the store's indexes. Running it again after it succeeded is a no-op.
+// Tweets that no user claims are reported and left where they are.
+func SplitTweets(ctx context.Context, database *mongo.Database, names Collections, dryRun bool) (MigrationReport, error) {
+	var report MigrationReport
+	users := database.Collection(names.Users)
+	tweets := database.Collection(names.Tweets)
+
+	owners := make(map[uuid.UUID]string)
+	cursor, err := users.Find(ctx, bson.M{"username": bson.M{"$exists": true}, "tweetids": bson.M{"$exists": true}})
+	if err != nil {
+		return report, err
+	}
+	for cursor.Next(ctx) {
+		var owner legacyOwner
+		if err := cursor.Decode(&owner); err != nil {
+			return report, err
+		}
+		for _, id := range owner.TweetIDs {
+			owners[id] = owner.Username
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+
+	cursor, err = users.Find(ctx, bson.M{"username": bson.M{"$exists": false}, "text": bson.M{"$exists": true}})
+	if err != nil {
+		return report, err
+	}
+	for cursor.Next(ctx) {
+		var old legacyTweet
+		if err := cursor.Decode(&old); err != nil {
+			return report, err
+		}
+		author, ok := owners[old.ID]
+		if !ok {
+			report.OrphanedTweets = append(report.OrphanedTweets, old.ID)
+			continue
+		}
+		createdAt, err := time.ParseInLocation("2006-01-02 15:04:05", old.Date+" "+old.Time, time.Local)
+		if err != nil {
+			report.UndatedTweets++
+			createdAt = time.Unix(0, 0)
+		}
+		report.TweetsMoved++
+		if dryRun {
+			continue
+		}
+		tweet := model.Tweet{ID: old.ID, Author: author, Text: old.Text, CreatedAt: createdAt}
+		_, err = tweets.ReplaceOne(ctx, bson.M{"_id": tweet.ID}, tweet, options.Replace().SetUpsert(true))
+		if err != nil {
+			return report, fmt.Errorf("copying tweet %s: %w", old.ID, err)
+		}
+		_, err = users.DeleteOne(ctx, bson.M{"_id": old.ID})
+		if err != nil {
+			return report, fmt.Errorf("removing tweet %s from %s: %w", old.ID, names.Users, err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+
+	stale := bson.M{"username": bson.M{"$exists": true}, "$or": bson.A{
+		bson.M{"tweetids": bson.M{"$exists": true}},
+		bson.M{"tweets": bson.M{"$exists": true}},
+		bson.M{"active": bson.M{"$exists": true}},
+		bson.M{"input": bson.M{"$exists": true}},
+	}}
+	if dryRun {
+		report.UsersCleaned, err = users.CountDocuments(ctx, stale)
+	} else {
+		var res *mongo.UpdateResult
+		res, err = users.UpdateMany(ctx, stale, bson.M{"$unset": bson.M{"tweetids": "", "tweets": "", "active": "", "input": ""}})
+		if res != nil {
+			report.UsersCleaned = res.ModifiedCount
+		}
+	}
+	if err != nil {
+		return report, err
+	}
+
+	cursor, err = users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"username": bson.M{"$exists": true}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"$toLower": "$username"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	for cursor.Next(ctx) {
+		var dup struct {
+			Username string `bson:"_id"`
+		}
+		if err := cursor.Decode(&dup); err != nil {
+			return report, err
+		}
+		report.DuplicateUsernames = append(report.DuplicateUsernames, dup.Username)
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+	if len(report.DuplicateUsernames) > 0 {
+		return report, fmt.Errorf("%d usernames are taken by more than one account; resolve them before the unique index can be created", len(report.DuplicateUsernames))
+	}
+	if len(report.OrphanedTweets) > 0 {
+		return report, fmt.Errorf("%d tweets in %s have no author; remove them before the unique index can be created", len(report.OrphanedTweets), names.Users)
+	}
+	if dryRun {
+		return report, nil
+	}
+	_, err = NewMongo(ctx, database, names)
+	return report, err
+}
+
+// legacyGraph is a user document with the follow lists it used to embed, and the counts that
+// replaced them
+type legacyGraph struct {
+	Username       string   `bson:"username"`
+	Followings     []string `bson:"followings"`
+	Followers      []string `bson:"followers"`
+	FollowersCount int64    `bson:"followers_count"`
+	FollowingCount int64    `bson:"following_count"`
+}
+
+// edge is a follow as a pair of usernames
+type edge struct {
+	follower string
+	followee string
+}
+
+func (e edge) String() string {
+	return e.follower + " -> " + e.followee
+}
+
+// FollowRepairReport describes what RepairFollows did, or would do on a dry run
+type FollowRepairReport struct {
+	// EdgesCreated counts the follows of the legacy lists that had no edge yet
+	EdgesCreated int
+	// OneSided lists the follows that only one of the two users' legacy lists recorded; they are kept
+	OneSided []string
+	// Dangling lists the follows, from the legacy lists or the follows collection, naming a user
+	// that does not exist; they are dropped
+	Dangling []string
+	// CountsFixed counts the users whose follower or following count did not match their edges
+	CountsFixed int
+	// UsersCleaned counts the users whose legacy lists were removed
+	UsersCleaned int64
+}
+
+// RepairFollows rebuilds the follows collection from the followings and followers lists that
+// user documents used to embed, drops the edges naming users that do not exist, recounts every
+// user's followers and followings from the edges and strips the legacy lists. Follows recorded
+// by only one side are kept and reported. Running it again is a no-op unless the counts drifted,
+// which it fixes; follows made while it runs can be miscounted, so run it with the API stopped.
+func RepairFollows(ctx context.Context, database *mongo.Database, names Collections, dryRun bool) (FollowRepairReport, error) {
+	var report FollowRepairReport
+	users := database.Collection(names.Users)
+	follows := database.Collection(names.Follows)
+
+	graphs := make(map[string]legacyGraph)
+	cursor, err := users.Find(ctx, bson.M{"username": bson.M{"$exists": true}}, options.Find().SetProjection(bson.M{
+		"username": 1, "followings": 1, "followers": 1, "followers_count": 1, "following_count": 1,
+	}))
+	if err != nil {
+		return report, err
+	}
+	for cursor.Next(ctx) {
+		var graph legacyGraph
+		if err := cursor.Decode(&graph); err != nil {
+			return report, err
+		}
+		graphs[graph.Username] = graph
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+
+	// sides records, for each legacy follow, whether the follower's list has it (1) and whether
+	// the followee's list has it (2)
+	sides := make(map[edge]int)
+	for _, graph := range graphs {
+		for _, followee := range graph.Followings {
+			sides[edge{graph.Username, followee}] |= 1
+		}
+		for _, follower := range graph.Followers {
+			sides[edge{follower, graph.Username}] |= 2
+		}
+	}
+	exists := func(e edge) bool {
+		_, follower := graphs[e.follower]
+		_, followee := graphs[e.followee]
+		return follower && followee
+	}
+
+	edges := make(map[edge]bool)
+	dangling := make(map[edge]bool)
+	cursor, err = follows.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"follower": 1, "followee": 1}))
+	if err != nil {
+		return report, err
+	}
+	for cursor.Next(ctx) {
+		var follow model.Follow
+		if err := cursor.Decode(&follow); err != nil {
+			return report, err
+		}
+		e := edge{follow.Follower, follow.Followee}
+		if !exists(e) {
+			dangling[e] = true
+			continue
+		}
+		edges[e] = true
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+
+	var missing []edge
+	for e, side := range sides {
+		if !exists(e) {
+			dangling[e] = true
+			continue
+		}
+		if side != 3 {
+			report.OneSided = append(report.OneSided, e.String())
+		}
+		if !edges[e] {
+			edges[e] = true
+			missing = append(missing, e)
+		}
+	}
+	report.EdgesCreated = len(missing)
+	for e := range dangling {
+		report.Dangling = append(report.Dangling, e.String())
+	}
+	sort.Strings(report.OneSided)
+	sort.Strings(report.Dangling)
+
+	followers := make(map[string]int64, len(graphs))
+	followings := make(map[string]int64, len(graphs))
+	for e := range edges {
+		followings[e.follower]++
+		followers[e.followee]++
+	}
+	var recounts []mongo.WriteModel
+	for username, graph := range graphs {
+		if graph.FollowersCount == followers[username] && graph.FollowingCount == followings[username] {
+			continue
+		}
+		report.CountsFixed++
+		recounts = append(recounts, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"username": username}).
+			SetUpdate(bson.M{"$set": bson.M{"followers_count": followers[username], "following_count": followings[username]}}))
+	}
+
+	legacy := bson.M{"username": bson.M{"$exists": true}, "$or": bson.A{
+		bson.M{"followings": bson.M{"$exists": true}},
+		bson.M{"followers": bson.M{"$exists": true}},
+	}}
+	if dryRun {
+		report.UsersCleaned, err = users.CountDocuments(ctx, legacy)
+		return report, err
+	}
+
+	// the unique index on follower and followee has to exist before edges are upserted
+	_, err = NewMongo(ctx, database, names)
+	if err != nil {
+		return report, err
+	}
+	if len(missing) > 0 {
+		// follows from the legacy lists have no date, so they sort before every dated follow
+		writes := make([]mongo.WriteModel, 0, len(missing))
+		for _, e := range missing {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"follower": e.follower, "followee": e.followee}).
+				SetUpdate(bson.M{"$setOnInsert": bson.M{"_id": uuid.New(), "created_at": time.Unix(0, 0)}}).
+				SetUpsert(true))
+		}
+		_, err = follows.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return report, fmt.Errorf("creating follow edges: %w", err)
+		}
+	}
+	for e := range dangling {
+		_, err = follows.DeleteOne(ctx, bson.M{"follower": e.follower, "followee": e.followee})
+		if err != nil {
+			return report, fmt.Errorf("removing follow %s: %w", e, err)
+		}
+	}
+	if len(recounts) > 0 {
+		_, err = users.BulkWrite(ctx, recounts, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return report, fmt.Errorf("fixing follow counts: %w", err)
+		}
+	}
+	res, err := users.UpdateMany(ctx, legacy, bson.M{"$unset": bson.M{"followings": "", "followers": ""}})
+	if res != nil {
+		report.UsersCleaned = res.ModifiedCount
+	}
+	return report, err
+}
@@ -0,0 +1,1364 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strings"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/search"
+)
+
+// Mongo is the MongoDB backed Store
+type Mongo struct {
+	users         *mongo.Collection
+	tweets        *mongo.Collection
+	sessions      *mongo.Collection
+	feeds         *mongo.Collection
+	celebrities   *mongo.Collection
+	likes         *mongo.Collection
+	notifications *mongo.Collection
+	conversations *mongo.Collection
+	messages      *mongo.Collection
+	blocks        *mongo.Collection
+	mutes         *mongo.Collection
+	follows       *mongo.Collection
+	requests      *mongo.Collection
+	deletions     *mongo.Collection
+}
+
+// Collections names the collections used by the Mongo store
+type Collections struct {
+	Users         string `json:"users"`
+	Tweets        string `json:"tweets"`
+	Sessions      string `json:"sessions"`
+	Feeds         string `json:"feeds"`
+	Celebrities   string `json:"celebrities"`
+	Likes         string `json:"likes"`
+	Notifications string `json:"notifications"`
+	Conversations string `json:"conversations"`
+	Messages      string `json:"messages"`
+	Blocks        string `json:"blocks"`
+	Mutes         string `json:"mutes"`
+	Follows       string `json:"follows"`
+	Requests      string `json:"follow_requests"`
+	Deletions     string `json:"deletions"`
+}
+
+// DefaultCollections are the collection names used unless configured otherwise
+var DefaultCollections = Collections{
+	Users:         "users",
+	Tweets:        "tweets",
+	Sessions:      "sessions",
+	Feeds:         "feeds",
+	Celebrities:   "celebrities",
+	Likes:         "likes",
+	Notifications: "notifications",
+	Conversations: "conversations",
+	Messages:      "messages",
+	Blocks:        "blocks",
+	Mutes:         "mutes",
+	Follows:       "follows",
+	Requests:      "follow_requests",
+	Deletions:     "deletions",
+}
+
+// NewMongo builds a Store on top of the named collections of the given database and makes sure their indexes exist
+func NewMongo(ctx context.Context, database *mongo.Database, names Collections) (*Mongo, error) {
+	m := &Mongo{
+		users:         database.Collection(names.Users),
+		tweets:        database.Collection(names.Tweets),
+		sessions:      database.Collection(names.Sessions),
+		feeds:         database.Collection(names.Feeds),
+		celebrities:   database.Collection(names.Celebrities),
+		likes:         database.Collection(names.Likes),
+		notifications: database.Collection(names.Notifications),
+		conversations: database.Collection(names.Conversations),
+		messages:      database.Collection(names.Messages),
+		blocks:        database.Collection(names.Blocks),
+		mutes:         database.Collection(names.Mutes),
+		follows:       database.Collection(names.Follows),
+		requests:      database.Collection(names.Requests),
+		deletions:     database.Collection(names.Deletions),
+	}
+	err := m.EnsureIndexes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating indexes (run cmd/migrate if upgrading from the shared users collection): %w", err)
+	}
+	return m, nil
+}
+
+// EnsureIndexes creates every index the store relies on. Creating an index that already exists is a no-op.
+func (m *Mongo) EnsureIndexes(ctx context.Context) error {
+	_, err := m.users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"username": 1}, Options: options.Index().SetUnique(true)},
+		// usernames that differ only in case are the same account name
+		{Keys: bson.M{"username": 1}, Options: options.Index().SetUnique(true).SetName("username_ci").
+			SetCollation(&options.Collation{Locale: "en", Strength: 2})},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.tweets.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "author", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "in_reply_to_tweet_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		// one retweet per user and tweet, which is what makes retweeting idempotent
+		{Keys: bson.D{{Key: "retweet_of", Value: 1}, {Key: "author", Value: 1}}, Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"retweet_of": bson.M{"$exists": true}})},
+		{Keys: bson.D{{Key: "entities.mentions.text", Value: 1}, {Key: "created_at", Value: -1}}},
+		// without a language there is no stemming and no stop words, so words match like in search.Index
+		{Keys: bson.M{"text": "text"}, Options: options.Index().SetName("text_search").SetDefaultLanguage("none")},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.M{"username": 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.likes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tweet_id", Value: 1}, {Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "tweet_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.notifications.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "recipient", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "recipient", Value: 1}, {Key: "read", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.conversations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// one conversation per pair of people, which is what makes starting one idempotent
+		{Keys: bson.M{"key": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "participants", Value: 1}, {Key: "last_message_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.messages.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "conversation_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.blocks.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "blocker", Value: 1}, {Key: "blocked", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"blocked": 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.mutes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// one mute per user and account or word, which is what makes muting idempotent
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "account", Value: 1}, {Key: "word", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.follows.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// one edge per follower and followee, which is what makes following idempotent
+		{Keys: bson.D{{Key: "follower", Value: 1}, {Key: "followee", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "follower", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "followee", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.requests.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "requester", Value: 1}, {Key: "target", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "target", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.deletions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"username": 1}},
+		{Keys: bson.M{"purge_at": 1}},
+	})
+	return err
+}
+
+// visibleFilter selects the tweets that belong in the home timeline of someone following followings:
+// everything but replies to accounts outside followings, except for authors replying to themselves
+func visibleFilter(followings []string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"in_reply_to_user": bson.M{"$exists": false}},
+		bson.M{"in_reply_to_user": bson.M{"$in": followings}},
+		bson.M{"$expr": bson.M{"$eq": bson.A{"$in_reply_to_user", "$author"}}},
+	}}
+}
+
+// convert maps driver errors onto the store's sentinel errors
+func convert(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// transaction runs fn in a transaction, retrying it on transient errors. Transactions need
+// MongoDB to run as a replica set.
+func (m *Mongo) transaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	return m.users.Database().Client().UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	})
+}
+
+func (m *Mongo) CreateUser(ctx context.Context, user model.User) error {
+	_, err := m.users.InsertOne(ctx, user)
+	return convert(err)
+}
+
+func (m *Mongo) GetUser(ctx context.Context, username string) (model.User, error) {
+	var user model.User
+	err := m.users.FindOne(ctx, bson.M{"username": username, "deactivated_at": bson.M{"$exists": false}}).Decode(&user)
+	return user, convert(err)
+}
+
+func (m *Mongo) GetAccount(ctx context.Context, username string) (model.User, error) {
+	var user model.User
+	err := m.users.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	return user, convert(err)
+}
+
+func (m *Mongo) Usernames(ctx context.Context, names []string) (map[string]string, error) {
+	// the collation lets the case-insensitive username index answer the query
+	cursor, err := m.users.Find(ctx, bson.M{"username": bson.M{"$in": names}, "deactivated_at": bson.M{"$exists": false}}, options.Find().
+		SetCollation(&options.Collation{Locale: "en", Strength: 2}).SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []model.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]string, len(names))
+	for _, user := range users {
+		for _, name := range names {
+			if strings.EqualFold(name, user.Username) {
+				found[name] = user.Username
+			}
+		}
+	}
+	return found, nil
+}
+
+func (m *Mongo) UpdatePassword(ctx context.Context, username string, hash string) error {
+	res, err := m.users.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"password": hash}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) SetDMPolicy(ctx context.Context, username string, policy string) error {
+	res, err := m.users.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"dm_policy": policy}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) SetProtected(ctx context.Context, username string, protected bool) error {
+	res, err := m.users.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"protected": protected}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) ProtectedAccounts(ctx context.Context, usernames []string) ([]string, error) {
+	protected := make([]string, 0)
+	if len(usernames) == 0 {
+		return protected, nil
+	}
+	cursor, err := m.users.Find(ctx, bson.M{"username": bson.M{"$in": usernames}, "protected": true},
+		options.Find().SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []model.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		protected = append(protected, user.Username)
+	}
+	return protected, nil
+}
+
+func (m *Mongo) DeactivatedAccounts(ctx context.Context, usernames []string) ([]string, error) {
+	cursor, err := m.users.Find(ctx, bson.M{"username": bson.M{"$in": usernames}, "deactivated_at": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []model.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+	deactivated := make([]string, 0, len(users))
+	for _, user := range users {
+		deactivated = append(deactivated, user.Username)
+	}
+	return deactivated, nil
+}
+
+func (m *Mongo) CreateTweet(ctx context.Context, tweet model.Tweet) error {
+	err := m.transaction(ctx, func(sc mongo.SessionContext) error {
+		_, err := m.tweets.InsertOne(sc, tweet)
+		if err != nil {
+			return err
+		}
+		return m.count(sc, tweet, 1)
+	})
+	return convert(err)
+}
+
+// count adds delta to the retweet or quote count of the tweet that tweet reshares
+func (m *Mongo) count(ctx context.Context, tweet model.Tweet, delta int) error {
+	var err error
+	if tweet.RetweetOf != nil {
+		_, err = m.tweets.UpdateOne(ctx, bson.M{"_id": *tweet.RetweetOf}, bson.M{"$inc": bson.M{"retweet_count": delta}})
+	}
+	if err == nil && tweet.QuoteOf != nil {
+		_, err = m.tweets.UpdateOne(ctx, bson.M{"_id": *tweet.QuoteOf}, bson.M{"$inc": bson.M{"quote_count": delta}})
+	}
+	return err
+}
+
+func (m *Mongo) GetTweet(ctx context.Context, id uuid.UUID) (model.Tweet, error) {
+	var tweet model.Tweet
+	err := m.tweets.FindOne(ctx, bson.M{"_id": id}).Decode(&tweet)
+	return tweet, convert(err)
+}
+
+func (m *Mongo) GetTweets(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]model.Tweet, error) {
+	byID := make(map[uuid.UUID]model.Tweet, len(ids))
+	if len(ids) == 0 {
+		return byID, nil
+	}
+	cursor, err := m.tweets.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0, len(ids))
+	err = cursor.All(ctx, &tweets)
+	if err != nil {
+		return nil, err
+	}
+	for _, tweet := range tweets {
+		byID[tweet.ID] = tweet
+	}
+	return byID, nil
+}
+
+func (m *Mongo) GetRetweet(ctx context.Context, author string, original uuid.UUID) (model.Tweet, error) {
+	var tweet model.Tweet
+	err := m.tweets.FindOne(ctx, bson.M{"author": author, "retweet_of": original}).Decode(&tweet)
+	return tweet, convert(err)
+}
+
+func (m *Mongo) CountTweets(ctx context.Context, author string) (int64, error) {
+	return m.tweets.CountDocuments(ctx, bson.M{"author": author})
+}
+
+func (m *Mongo) TweetsByAuthor(ctx context.Context, author string) ([]model.Tweet, error) {
+	cursor, err := m.tweets.Find(ctx, bson.M{"author": author}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0)
+	err = cursor.All(ctx, &tweets)
+	return tweets, err
+}
+
+func (m *Mongo) TweetsByAuthors(ctx context.Context, authors []string, page Page) ([]model.Tweet, error) {
+	filter := page.filter()
+	filter["author"] = bson.M{"$in": authors}
+	cursor, err := m.tweets.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0, page.Limit)
+	err = cursor.All(ctx, &tweets)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		reverseTweets(tweets)
+	}
+	return tweets, nil
+}
+
+func (m *Mongo) HomeTimeline(ctx context.Context, username string, page Page) ([]model.Tweet, error) {
+	followings, err := m.Followings(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return m.TimelineTweets(ctx, followings, followings, page)
+}
+
+func (m *Mongo) TimelineTweets(ctx context.Context, authors []string, followings []string, page Page) ([]model.Tweet, error) {
+	filter := bson.M{"$and": bson.A{
+		bson.M{"author": bson.M{"$in": authors}},
+		visibleFilter(followings),
+		page.filter(),
+	}}
+	cursor, err := m.tweets.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0, page.Limit)
+	err = cursor.All(ctx, &tweets)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		reverseTweets(tweets)
+	}
+	return tweets, nil
+}
+
+func (m *Mongo) Replies(ctx context.Context, parents []uuid.UUID, page Page) (map[uuid.UUID][]model.Tweet, error) {
+	byParent := make(map[uuid.UUID][]model.Tweet, len(parents))
+	for _, parent := range parents {
+		byParent[parent] = make([]model.Tweet, 0)
+	}
+	if len(parents) == 0 {
+		return byParent, nil
+	}
+	match := page.filter()
+	match["in_reply_to_tweet_id"] = bson.M{"$in": parents}
+	cursor, err := m.tweets.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: page.sort()}},
+		{{Key: "$group", Value: bson.M{"_id": "$in_reply_to_tweet_id", "replies": bson.M{"$push": "$$ROOT"}}}},
+		{{Key: "$project", Value: bson.M{"replies": bson.M{"$slice": bson.A{"$replies", page.Limit}}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var group struct {
+			Parent  uuid.UUID     `bson:"_id"`
+			Replies []model.Tweet `bson:"replies"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		if page.Newer() {
+			reverseTweets(group.Replies)
+		}
+		byParent[group.Parent] = group.Replies
+	}
+	return byParent, cursor.Err()
+}
+
+func (m *Mongo) DeleteTweet(ctx context.Context, author string, id uuid.UUID) error {
+	err := m.transaction(ctx, func(sc mongo.SessionContext) error {
+		var tweet model.Tweet
+		err := m.tweets.FindOneAndDelete(sc, bson.M{"_id": id, "author": author}).Decode(&tweet)
+		if err != nil {
+			return err
+		}
+		err = m.count(sc, tweet, -1)
+		if err != nil {
+			return err
+		}
+		_, err = m.tweets.DeleteMany(sc, bson.M{"retweet_of": id})
+		if err != nil {
+			return err
+		}
+		_, err = m.likes.DeleteMany(sc, bson.M{"tweet_id": id})
+		return err
+	})
+	return convert(err)
+}
+
+// countFollow adds delta to the counts of the users on both ends of a follow edge
+func (m *Mongo) countFollow(ctx context.Context, follower string, followee string, delta int) error {
+	_, err := m.users.UpdateOne(ctx, bson.M{"username": follower}, bson.M{"$inc": bson.M{"following_count": delta}})
+	if err != nil {
+		return err
+	}
+	_, err = m.users.UpdateOne(ctx, bson.M{"username": followee}, bson.M{"$inc": bson.M{"followers_count": delta}})
+	return err
+}
+
+func (m *Mongo) Follow(ctx context.Context, follower string, followee string) error {
+	edge := model.Follow{ID: uuid.New(), Follower: follower, Followee: followee, CreatedAt: time.Now()}
+	err := m.transaction(ctx, func(sc mongo.SessionContext) error {
+		_, err := m.follows.InsertOne(sc, edge)
+		if err != nil {
+			return err
+		}
+		return m.countFollow(sc, follower, followee, 1)
+	})
+	return convert(err)
+}
+
+func (m *Mongo) Unfollow(ctx context.Context, follower string, followee string) error {
+	return m.transaction(ctx, func(sc mongo.SessionContext) error {
+		res, err := m.follows.DeleteOne(sc, bson.M{"follower": follower, "followee": followee})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		return m.countFollow(sc, follower, followee, -1)
+	})
+}
+
+func (m *Mongo) Follows(ctx context.Context, follower string, followee string) (bool, error) {
+	n, err := m.follows.CountDocuments(ctx, bson.M{"follower": follower, "followee": followee}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// ends lists one end, follower or followee, of every edge matching the filter
+func (m *Mongo) ends(ctx context.Context, filter bson.M, end string) ([]string, error) {
+	cursor, err := m.follows.Find(ctx, filter, options.Find().SetProjection(bson.M{end: 1}))
+	if err != nil {
+		return nil, err
+	}
+	var edges []model.Follow
+	err = cursor.All(ctx, &edges)
+	if err != nil {
+		return nil, err
+	}
+	usernames := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		if end == "follower" {
+			usernames = append(usernames, edge.Follower)
+		} else {
+			usernames = append(usernames, edge.Followee)
+		}
+	}
+	return usernames, nil
+}
+
+func (m *Mongo) Followings(ctx context.Context, username string) ([]string, error) {
+	return m.ends(ctx, bson.M{"follower": username}, "followee")
+}
+
+func (m *Mongo) Followers(ctx context.Context, username string) ([]string, error) {
+	return m.ends(ctx, bson.M{"followee": username}, "follower")
+}
+
+// pageFollows returns the requested page of the edges where end, follower or followee, is
+// username, most recent first
+func (m *Mongo) pageFollows(ctx context.Context, end string, username string, page Page) ([]model.Follow, error) {
+	filter := page.filter()
+	filter[end] = username
+	cursor, err := m.follows.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	edges := make([]model.Follow, 0, page.Limit)
+	err = cursor.All(ctx, &edges)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		for i, j := 0, len(edges)-1; i < j; i, j = i+1, j-1 {
+			edges[i], edges[j] = edges[j], edges[i]
+		}
+	}
+	return edges, nil
+}
+
+func (m *Mongo) FollowingPage(ctx context.Context, username string, page Page) ([]model.Follow, error) {
+	return m.pageFollows(ctx, "follower", username, page)
+}
+
+func (m *Mongo) FollowersPage(ctx context.Context, username string, page Page) ([]model.Follow, error) {
+	return m.pageFollows(ctx, "followee", username, page)
+}
+
+func (m *Mongo) RequestFollow(ctx context.Context, request model.FollowRequest) error {
+	_, err := m.requests.InsertOne(ctx, request)
+	return convert(err)
+}
+
+func (m *Mongo) FollowRequests(ctx context.Context, target string, page Page) ([]model.FollowRequest, error) {
+	filter := page.filter()
+	filter["target"] = target
+	cursor, err := m.requests.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]model.FollowRequest, 0, page.Limit)
+	err = cursor.All(ctx, &requests)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		for i, j := 0, len(requests)-1; i < j; i, j = i+1, j-1 {
+			requests[i], requests[j] = requests[j], requests[i]
+		}
+	}
+	return requests, nil
+}
+
+func (m *Mongo) DeleteFollowRequest(ctx context.Context, requester string, target string) error {
+	res, err := m.requests.DeleteOne(ctx, bson.M{"requester": requester, "target": target})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) CreateSession(ctx context.Context, session model.Session) error {
+	_, err := m.sessions.InsertOne(ctx, session)
+	return convert(err)
+}
+
+func (m *Mongo) GetSession(ctx context.Context, id string) (model.Session, error) {
+	var session model.Session
+	err := m.sessions.FindOne(ctx, bson.M{
+		"_id":        id,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	return session, convert(err)
+}
+
+func (m *Mongo) UserSessions(ctx context.Context, username string) ([]model.Session, error) {
+	cursor, err := m.sessions.Find(ctx,
+		bson.M{"username": username, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]model.Session, 0)
+	err = cursor.All(ctx, &sessions)
+	return sessions, err
+}
+
+func (m *Mongo) DeleteSession(ctx context.Context, id string) error {
+	_, err := m.sessions.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (m *Mongo) DeleteUserSessions(ctx context.Context, username string) error {
+	_, err := m.sessions.DeleteMany(ctx, bson.M{"username": username})
+	return err
+}
+
+func (m *Mongo) PushFeed(ctx context.Context, owners []string, entries []model.FeedEntry, capacity int) error {
+	if len(owners) == 0 || len(entries) == 0 {
+		return nil
+	}
+	push := bson.M{"$push": bson.M{"entries": bson.M{
+		"$each":  entries,
+		"$sort":  bson.D{{Key: "created_at", Value: -1}, {Key: "tweet_id", Value: -1}},
+		"$slice": capacity,
+	}}}
+	writes := make([]mongo.WriteModel, 0, len(owners))
+	for _, owner := range owners {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": owner}).
+			SetUpdate(push).
+			SetUpsert(true))
+	}
+	_, err := m.feeds.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (m *Mongo) ReadFeed(ctx context.Context, owner string, authors []string, page Page) ([]model.Tweet, error) {
+	match := bson.M{"$and": bson.A{
+		bson.M{"author": bson.M{"$in": authors}},
+		visibleFilter(authors),
+		page.filter(),
+	}}
+	cursor, err := m.feeds.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": owner}}},
+		{{Key: "$unwind", Value: "$entries"}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": bson.M{
+			"_id":              "$entries.tweet_id",
+			"author":           "$entries.author",
+			"created_at":       "$entries.created_at",
+			"in_reply_to_user": "$entries.in_reply_to_user",
+		}}}},
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$_id",
+			"created_at": bson.M{"$first": "$created_at"},
+		}}},
+		{{Key: "$sort", Value: page.sort()}},
+		{{Key: "$limit", Value: page.Limit}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         m.tweets.Name(),
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "tweet",
+		}}},
+		{{Key: "$unwind", Value: "$tweet"}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$tweet"}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0, page.Limit)
+	err = cursor.All(ctx, &tweets)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		reverseTweets(tweets)
+	}
+	return tweets, nil
+}
+
+func (m *Mongo) MarkCelebrity(ctx context.Context, author string) error {
+	_, err := m.celebrities.UpdateOne(ctx,
+		bson.M{"_id": author},
+		bson.M{"$setOnInsert": bson.M{"marked_at": time.Now()}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (m *Mongo) Celebrities(ctx context.Context) ([]string, error) {
+	cursor, err := m.celebrities.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		Author string `bson:"_id"`
+	}
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		authors = append(authors, doc.Author)
+	}
+	return authors, nil
+}
+
+func (m *Mongo) Like(ctx context.Context, like model.Like) error {
+	// the unique index lets only one of several concurrent likes by the same user through, and
+	// counting on the tweet inside the transaction makes a like of a tweet deleted meanwhile
+	// conflict with the deletion instead of outliving it
+	err := m.transaction(ctx, func(sc mongo.SessionContext) error {
+		res, err := m.tweets.UpdateOne(sc, bson.M{"_id": like.TweetID}, bson.M{"$inc": bson.M{"like_count": 1}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		_, err = m.likes.InsertOne(sc, like)
+		return err
+	})
+	return convert(err)
+}
+
+func (m *Mongo) Unlike(ctx context.Context, tweetID uuid.UUID, username string) error {
+	return m.transaction(ctx, func(sc mongo.SessionContext) error {
+		res, err := m.likes.DeleteOne(sc, bson.M{"tweet_id": tweetID, "username": username})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		_, err = m.tweets.UpdateOne(sc, bson.M{"_id": tweetID}, bson.M{"$inc": bson.M{"like_count": -1}})
+		return err
+	})
+}
+
+func (m *Mongo) TweetLikes(ctx context.Context, tweetID uuid.UUID, page Page) ([]model.Like, error) {
+	filter := page.filter()
+	filter["tweet_id"] = tweetID
+	return m.pageLikes(ctx, filter, page)
+}
+
+func (m *Mongo) UserLikes(ctx context.Context, username string, page Page) ([]model.Like, error) {
+	filter := page.filter()
+	filter["username"] = username
+	return m.pageLikes(ctx, filter, page)
+}
+
+func (m *Mongo) pageLikes(ctx context.Context, filter bson.M, page Page) ([]model.Like, error) {
+	cursor, err := m.likes.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	likes := make([]model.Like, 0, page.Limit)
+	err = cursor.All(ctx, &likes)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		for i, j := 0, len(likes)-1; i < j; i, j = i+1, j-1 {
+			likes[i], likes[j] = likes[j], likes[i]
+		}
+	}
+	return likes, nil
+}
+
+func (m *Mongo) SearchTweets(ctx context.Context, q search.Query, page Page) ([]model.Tweet, error) {
+	filter, _ := searchFilter(q)
+	cursor, err := m.tweets.Find(ctx, bson.M{"$and": bson.A{filter, page.filter()}},
+		options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0, page.Limit)
+	err = cursor.All(ctx, &tweets)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		reverseTweets(tweets)
+	}
+	return tweets, nil
+}
+
+func (m *Mongo) RankTweets(ctx context.Context, q search.Query, offset int, limit int) ([]model.Tweet, error) {
+	filter, text := searchFilter(q)
+	opts := options.Find().SetSkip(int64(offset)).SetLimit(int64(limit))
+	if text {
+		score := bson.M{"$meta": "textScore"}
+		opts.SetProjection(bson.M{"score": score}).
+			SetSort(bson.D{{Key: "score", Value: score}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	} else {
+		opts.SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	}
+	cursor, err := m.tweets.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0, limit)
+	err = cursor.All(ctx, &tweets)
+	return tweets, err
+}
+
+// searchFilter translates the query into a filter on the tweets collection and reports whether it
+// uses the text index. Terms are quoted like phrases because Mongo requires every phrase of a text
+// search to match but only one of its bare terms.
+func searchFilter(q search.Query) (bson.M, bool) {
+	and := bson.A{bson.M{"retweet_of": bson.M{"$exists": false}}}
+	var text []string
+	for _, term := range q.Terms {
+		text = append(text, `"`+term+`"`)
+	}
+	for _, phrase := range q.Phrases {
+		text = append(text, `"`+strings.Join(phrase, " ")+`"`)
+	}
+	if len(text) > 0 {
+		and = append(and, bson.M{"$text": bson.M{"$search": strings.Join(text, " ")}})
+	}
+	// exclusions are matched by pattern whether or not there is text to search for, with word
+	// boundaries drawn where search.Words splits the text
+	for _, term := range q.Exclude {
+		pattern := `(^|[^\p{L}\p{Nd}\p{M}_])` + regexp.QuoteMeta(term) + `($|[^\p{L}\p{Nd}\p{M}_])`
+		and = append(and, bson.M{"text": bson.M{"$not": primitive.Regex{Pattern: pattern, Options: "i"}}})
+	}
+	if len(q.From) > 0 {
+		and = append(and, bson.M{"author": bson.M{"$in": q.From}})
+	}
+	for _, tag := range q.Hashtags {
+		and = append(and, bson.M{"entities.hashtags.text": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(tag) + "$", Options: "i"}})
+	}
+	if !q.Since.IsZero() {
+		and = append(and, bson.M{"created_at": bson.M{"$gte": q.Since}})
+	}
+	if !q.Until.IsZero() {
+		and = append(and, bson.M{"created_at": bson.M{"$lt": q.Until}})
+	}
+	return bson.M{"$and": and}, len(text) > 0
+}
+
+func (m *Mongo) SearchUsers(ctx context.Context, prefixes []string, offset int, limit int) ([]model.User, error) {
+	and := bson.A{}
+	for _, prefix := range prefixes {
+		pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix), Options: "i"}
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"username": pattern},
+			bson.M{"firstname": pattern},
+			bson.M{"lastname": pattern},
+		}})
+	}
+	username := bson.M{"$toLower": "$username"}
+	cursor, err := m.users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": append(and, bson.M{"deactivated_at": bson.M{"$exists": false}})}}},
+		{{Key: "$addFields", Value: bson.M{"rank": bson.M{"$switch": bson.M{
+			"branches": bson.A{
+				bson.M{"case": bson.M{"$eq": bson.A{username, prefixes[0]}}, "then": 0},
+				bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$indexOfCP": bson.A{username, prefixes[0]}}, 0}}, "then": 1},
+			},
+			"default": 2,
+		}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "rank", Value: 1}, {Key: "username", Value: 1}}}},
+		{{Key: "$skip", Value: offset}},
+		{{Key: "$limit", Value: limit}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	users := make([]model.User, 0, limit)
+	err = cursor.All(ctx, &users)
+	return users, err
+}
+
+func (m *Mongo) Mentions(ctx context.Context, username string, page Page) ([]model.Tweet, error) {
+	filter := page.filter()
+	filter["entities.mentions.text"] = username
+	cursor, err := m.tweets.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	tweets := make([]model.Tweet, 0, page.Limit)
+	err = cursor.All(ctx, &tweets)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		reverseTweets(tweets)
+	}
+	return tweets, nil
+}
+
+func (m *Mongo) AddNotifications(ctx context.Context, notifications []model.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, 0, len(notifications))
+	for _, notification := range notifications {
+		docs = append(docs, notification)
+	}
+	_, err := m.notifications.InsertMany(ctx, docs)
+	return err
+}
+
+func (m *Mongo) Notifications(ctx context.Context, recipient string, page Page) ([]model.Notification, error) {
+	filter := page.filter()
+	filter["recipient"] = recipient
+	cursor, err := m.notifications.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	notifications := make([]model.Notification, 0, page.Limit)
+	err = cursor.All(ctx, &notifications)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		for i, j := 0, len(notifications)-1; i < j; i, j = i+1, j-1 {
+			notifications[i], notifications[j] = notifications[j], notifications[i]
+		}
+	}
+	return notifications, nil
+}
+
+func (m *Mongo) UnreadCount(ctx context.Context, recipient string) (int64, error) {
+	return m.notifications.CountDocuments(ctx, bson.M{"recipient": recipient, "read": false})
+}
+
+func (m *Mongo) MarkRead(ctx context.Context, recipient string, upTo time.Time) (int64, error) {
+	res, err := m.notifications.UpdateMany(ctx, bson.M{"recipient": recipient, "read": false, "created_at": bson.M{"$lte": upTo}},
+		bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (m *Mongo) CreateConversation(ctx context.Context, conversation model.Conversation) error {
+	_, err := m.conversations.InsertOne(ctx, conversation)
+	return convert(err)
+}
+
+func (m *Mongo) GetConversation(ctx context.Context, id uuid.UUID) (model.Conversation, error) {
+	var conversation model.Conversation
+	err := m.conversations.FindOne(ctx, bson.M{"_id": id}).Decode(&conversation)
+	return conversation, convert(err)
+}
+
+func (m *Mongo) ConversationByKey(ctx context.Context, key string) (model.Conversation, error) {
+	var conversation model.Conversation
+	err := m.conversations.FindOne(ctx, bson.M{"key": key}).Decode(&conversation)
+	return conversation, convert(err)
+}
+
+func (m *Mongo) Conversations(ctx context.Context, username string, page Page) ([]model.Conversation, error) {
+	filter := page.filterBy("last_message_at")
+	filter["participants"] = username
+	cursor, err := m.conversations.Find(ctx, filter, options.Find().SetSort(page.sortBy("last_message_at")).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	conversations := make([]model.Conversation, 0, page.Limit)
+	err = cursor.All(ctx, &conversations)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		for i, j := 0, len(conversations)-1; i < j; i, j = i+1, j-1 {
+			conversations[i], conversations[j] = conversations[j], conversations[i]
+		}
+	}
+	return conversations, nil
+}
+
+func (m *Mongo) AddMessage(ctx context.Context, message model.Message) error {
+	_, err := m.messages.InsertOne(ctx, message)
+	if err != nil {
+		return err
+	}
+	read := bson.M{"read_at." + message.Sender: message.CreatedAt}
+	// only move the conversation's last message forwards, in case messages sent at the same time
+	// are recorded out of order
+	res, err := m.conversations.UpdateOne(ctx,
+		bson.M{"_id": message.ConversationID, "last_message_at": bson.M{"$lte": message.CreatedAt}},
+		bson.M{"$set": bson.M{"last_message_at": message.CreatedAt, "last_message": message}, "$max": read})
+	if err != nil || res.MatchedCount > 0 {
+		return err
+	}
+	_, err = m.conversations.UpdateOne(ctx, bson.M{"_id": message.ConversationID}, bson.M{"$max": read})
+	return err
+}
+
+func (m *Mongo) Messages(ctx context.Context, conversationID uuid.UUID, page Page) ([]model.Message, error) {
+	filter := page.filter()
+	filter["conversation_id"] = conversationID
+	cursor, err := m.messages.Find(ctx, filter, options.Find().SetSort(page.sort()).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]model.Message, 0, page.Limit)
+	err = cursor.All(ctx, &messages)
+	if err != nil {
+		return nil, err
+	}
+	if page.Newer() {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, nil
+}
+
+func (m *Mongo) MarkConversationRead(ctx context.Context, conversationID uuid.UUID, username string, upTo time.Time) error {
+	res, err := m.conversations.UpdateOne(ctx, bson.M{"_id": conversationID}, bson.M{"$max": bson.M{"read_at." + username: upTo}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) UnreadMessages(ctx context.Context, username string, conversations []model.Conversation) (map[uuid.UUID]int64, error) {
+	unread := make(map[uuid.UUID]int64)
+	if len(conversations) == 0 {
+		return unread, nil
+	}
+	unseen := make(bson.A, 0, len(conversations))
+	for _, conversation := range conversations {
+		unseen = append(unseen, bson.M{
+			"conversation_id": conversation.ID,
+			"created_at":      bson.M{"$gt": conversation.ReadAt[username]},
+		})
+	}
+	cursor, err := m.messages.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": unseen, "sender": bson.M{"$ne": username}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$conversation_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		ID    uuid.UUID `bson:"_id"`
+		Count int64     `bson:"count"`
+	}
+	err = cursor.All(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		unread[count.ID] = count.Count
+	}
+	return unread, nil
+}
+
+func (m *Mongo) Block(ctx context.Context, block model.Block) error {
+	duplicate := false
+	err := m.transaction(ctx, func(sc mongo.SessionContext) error {
+		for _, pair := range [][2]string{{block.Blocker, block.Blocked}, {block.Blocked, block.Blocker}} {
+			res, err := m.follows.DeleteOne(sc, bson.M{"follower": pair[0], "followee": pair[1]})
+			if err != nil {
+				return err
+			}
+			if res.DeletedCount > 0 {
+				err = m.countFollow(sc, pair[0], pair[1], -1)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = m.requests.DeleteMany(sc, bson.M{"requester": pair[0], "target": pair[1]})
+			if err != nil {
+				return err
+			}
+		}
+		// an insert failing on the unique index would abort the transaction and the removals
+		// with it, so an existing block is found by upserting instead
+		res, err := m.blocks.UpdateOne(sc, bson.M{"blocker": block.Blocker, "blocked": block.Blocked},
+			bson.M{"$setOnInsert": bson.M{"created_at": block.CreatedAt}}, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		duplicate = res.UpsertedCount == 0
+		return nil
+	})
+	if err == nil && duplicate {
+		return ErrDuplicate
+	}
+	return convert(err)
+}
+
+func (m *Mongo) Unblock(ctx context.Context, blocker string, blocked string) error {
+	res, err := m.blocks.DeleteOne(ctx, bson.M{"blocker": blocker, "blocked": blocked})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) Blocks(ctx context.Context, blocker string) ([]model.Block, error) {
+	cursor, err := m.blocks.Find(ctx, bson.M{"blocker": blocker}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]model.Block, 0)
+	err = cursor.All(ctx, &blocks)
+	return blocks, err
+}
+
+func (m *Mongo) BlockedBy(ctx context.Context, blocked string) ([]string, error) {
+	cursor, err := m.blocks.Find(ctx, bson.M{"blocked": blocked}, options.Find().SetProjection(bson.M{"blocker": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var blocks []model.Block
+	err = cursor.All(ctx, &blocks)
+	if err != nil {
+		return nil, err
+	}
+	blockers := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		blockers = append(blockers, block.Blocker)
+	}
+	return blockers, nil
+}
+
+func (m *Mongo) Mute(ctx context.Context, mute model.Mute) (model.Mute, error) {
+	filter := bson.M{"username": mute.Username, "account": mute.Account}
+	if mute.Word != "" {
+		filter = bson.M{"username": mute.Username, "word": mute.Word}
+	}
+	update := bson.M{"$setOnInsert": bson.M{"_id": mute.ID, "created_at": mute.CreatedAt}}
+	if mute.ExpiresAt != nil {
+		update["$set"] = bson.M{"expires_at": mute.ExpiresAt}
+	} else {
+		update["$unset"] = bson.M{"expires_at": ""}
+	}
+	var stored model.Mute
+	err := m.mutes.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().
+		SetUpsert(true).SetReturnDocument(options.After)).Decode(&stored)
+	return stored, convert(err)
+}
+
+func (m *Mongo) Unmute(ctx context.Context, username string, account string) error {
+	res, err := m.mutes.DeleteOne(ctx, bson.M{"username": username, "account": account})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) UnmuteWord(ctx context.Context, username string, id uuid.UUID) error {
+	res, err := m.mutes.DeleteOne(ctx, bson.M{"_id": id, "username": username, "word": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) Mutes(ctx context.Context, username string, now time.Time) ([]model.Mute, error) {
+	// the TTL index only removes expired mutes about once a minute
+	filter := bson.M{"username": username, "$or": bson.A{
+		bson.M{"expires_at": bson.M{"$exists": false}},
+		bson.M{"expires_at": bson.M{"$gt": now}},
+	}}
+	cursor, err := m.mutes.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	mutes := make([]model.Mute, 0)
+	err = cursor.All(ctx, &mutes)
+	return mutes, err
+}
+
+func (m *Mongo) RequestDeletion(ctx context.Context, deletion model.Deletion) error {
+	err := m.transaction(ctx, func(sc mongo.SessionContext) error {
+		res, err := m.users.UpdateOne(sc, bson.M{"username": deletion.Username, "deactivated_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"deactivated_at": deletion.RequestedAt}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		_, err = m.deletions.InsertOne(sc, deletion)
+		return err
+	})
+	return convert(err)
+}
+
+func (m *Mongo) UpdateDeletion(ctx context.Context, deletion model.Deletion) error {
+	res, err := m.deletions.ReplaceOne(ctx, bson.M{"_id": deletion.ID}, deletion)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) CancelDeletion(ctx context.Context, username string) error {
+	return m.transaction(ctx, func(sc mongo.SessionContext) error {
+		res, err := m.deletions.DeleteOne(sc, bson.M{"username": username, "started_at": bson.M{"$exists": false}})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		_, err = m.users.UpdateOne(sc, bson.M{"username": username}, bson.M{"$unset": bson.M{"deactivated_at": ""}})
+		return err
+	})
+}
+
+func (m *Mongo) StartDeletion(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := m.deletions.UpdateOne(ctx, bson.M{"_id": id, "started_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"started_at": at, "stage": model.DeletionTweets}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	// already started, unless it was cancelled
+	n, err := m.deletions.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Mongo) DueDeletions(ctx context.Context, now time.Time) ([]model.Deletion, error) {
+	cursor, err := m.deletions.Find(ctx, bson.M{"finished_at": bson.M{"$exists": false}, "purge_at": bson.M{"$lte": now}},
+		options.Find().SetSort(bson.M{"purge_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	deletions := make([]model.Deletion, 0)
+	err = cursor.All(ctx, &deletions)
+	return deletions, err
+}
+
+func (m *Mongo) PurgeReferences(ctx context.Context, username string) error {
+	_, err := m.notifications.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"recipient": username}, bson.M{"actor": username}}})
+	if err != nil {
+		return err
+	}
+	_, err = m.blocks.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"blocker": username}, bson.M{"blocked": username}}})
+	if err != nil {
+		return err
+	}
+	_, err = m.mutes.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"username": username}, bson.M{"account": username}}})
+	if err != nil {
+		return err
+	}
+	_, err = m.requests.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"requester": username}, bson.M{"target": username}}})
+	if err != nil {
+		return err
+	}
+	_, err = m.sessions.DeleteMany(ctx, bson.M{"username": username})
+	if err != nil {
+		return err
+	}
+	_, err = m.feeds.DeleteOne(ctx, bson.M{"_id": username})
+	if err != nil {
+		return err
+	}
+	_, err = m.celebrities.DeleteOne(ctx, bson.M{"_id": username})
+	return err
+}
+
+func (m *Mongo) PurgeAccount(ctx context.Context, username string, at time.Time) error {
+	res, err := m.users.UpdateOne(ctx, bson.M{"username": username}, bson.M{
+		"$set":   bson.M{"firstname": "", "lastname": "", "password": "", "bio": "", "purged_at": at},
+		"$unset": bson.M{"dm_policy": "", "protected": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"testing"
+	"twitter-feed/model"
+	"twitter-feed/search"
+)
+
+// TestSearchExclusions checks the patterns searchFilter excludes words with against
+// search.Query.Match, since Go's regexp reads them the way MongoDB does
+func TestSearchExclusions(t *testing.T) {
+	texts := []string{"Rust", "rust!", "I like rust", "trusty", "rust_belt", "rustaceans", "(RUST)", "día rust", "rustó", "no"}
+	for _, raw := range []string{"#go -rust", "from:alice -rust", "go -rust"} {
+		q, err := search.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter, _ := searchFilter(q)
+		var patterns []*regexp.Regexp
+		for _, clause := range filter["$and"].(bson.A) {
+			field, ok := clause.(bson.M)["text"]
+			if !ok {
+				continue
+			}
+			regex := field.(bson.M)["$not"].(primitive.Regex)
+			patterns = append(patterns, regexp.MustCompile("(?"+regex.Options+")"+regex.Pattern))
+		}
+		if len(patterns) != 1 {
+			t.Fatalf("%q excludes %d patterns, want 1", raw, len(patterns))
+		}
+		for _, text := range texts {
+			excluded := patterns[0].MatchString(text)
+			matched := search.Query{Exclude: q.Exclude}.Match(model.Tweet{Text: text})
+			if excluded == matched {
+				t.Errorf("%q: %q excluded %v by pattern, matched %v by Match", raw, text, excluded, matched)
+			}
+		}
+	}
+}
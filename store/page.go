@@ -0,0 +1,130 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"strconv"
+	"strings"
+	"time"
+	"twitter-feed/model"
+)
+
+// ErrBadCursor is returned when a cursor string cannot be decoded
+var ErrBadCursor = errors.New("store: malformed cursor")
+
+// Cursor marks a position in a newest-first listing. Items are ordered by CreatedAt and
+// then by ID so that items sharing a timestamp still have a stable order.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	// Newer asks for the items just newer than the position instead of just older
+	Newer bool
+}
+
+// Page selects up to Limit items of a newest-first listing, starting after Cursor
+// or from the newest item when Cursor is nil
+type Page struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// String encodes the cursor as an opaque URL-safe token
+func (c Cursor) String() string {
+	direction := "o"
+	if c.Newer {
+		direction = "n"
+	}
+	raw := direction + ":" + strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token produced by Cursor.String
+func ParseCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrBadCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || (parts[0] != "o" && parts[0] != "n") {
+		return Cursor{}, ErrBadCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrBadCursor
+	}
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return Cursor{}, ErrBadCursor
+	}
+	return Cursor{CreatedAt: time.Unix(0, nanos), ID: id, Newer: parts[0] == "n"}, nil
+}
+
+// newer reports whether the item (a, aID) sorts before (b, bID) in a newest-first listing
+func newer(a time.Time, aID uuid.UUID, b time.Time, bID uuid.UUID) bool {
+	if !a.Equal(b) {
+		return a.After(b)
+	}
+	return strings.Compare(string(aID[:]), string(bID[:])) > 0
+}
+
+// Contains reports whether an item with the given position falls on the page
+func (p Page) Contains(createdAt time.Time, id uuid.UUID) bool {
+	if p.Cursor == nil {
+		return true
+	}
+	if p.Cursor.Newer {
+		return newer(createdAt, id, p.Cursor.CreatedAt, p.Cursor.ID)
+	}
+	return newer(p.Cursor.CreatedAt, p.Cursor.ID, createdAt, id)
+}
+
+// Newer reports whether the page walks towards newer items, in which case backends
+// have to scan oldest-first and reverse the result
+func (p Page) Newer() bool {
+	return p.Cursor != nil && p.Cursor.Newer
+}
+
+// filter returns the Mongo query selecting the documents on the page. Mongo stores
+// times with millisecond precision, so the cursor time is truncated to match.
+func (p Page) filter() bson.M {
+	return p.filterBy("created_at")
+}
+
+// filterBy is filter for listings ordered by another time field than created_at
+func (p Page) filterBy(field string) bson.M {
+	if p.Cursor == nil {
+		return bson.M{}
+	}
+	op := "$lt"
+	if p.Cursor.Newer {
+		op = "$gt"
+	}
+	at := p.Cursor.CreatedAt.Truncate(time.Millisecond)
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: at}},
+		bson.M{field: at, "_id": bson.M{op: p.Cursor.ID}},
+	}}
+}
+
+// sort returns the Mongo sort order to scan the page in
+func (p Page) sort() bson.D {
+	return p.sortBy("created_at")
+}
+
+// sortBy is sort for listings ordered by another time field than created_at
+func (p Page) sortBy(field string) bson.D {
+	order := -1
+	if p.Newer() {
+		order = 1
+	}
+	return bson.D{{Key: field, Value: order}, {Key: "_id", Value: order}}
+}
+
+// reverseTweets reverses tweets in place
+func reverseTweets(tweets []model.Tweet) {
+	for i, j := 0, len(tweets)-1; i < j; i, j = i+1, j-1 {
+		tweets[i], tweets[j] = tweets[j], tweets[i]
+	}
+}
@@ -0,0 +1,252 @@
+// Package store defines the persistence interfaces used by the controller along with
+// a MongoDB implementation and an in-memory implementation for tests and local development.
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/search"
+)
+
+// ErrNotFound is returned when the requested document does not exist
+var ErrNotFound = errors.New("store: not found")
+
+// ErrDuplicate is returned when a document with the same unique key already exists
+var ErrDuplicate = errors.New("store: already exists")
+
+// UserStore persists user accounts
+type UserStore interface {
+	// CreateUser inserts a new user, returning ErrDuplicate if the username is taken in any letter case
+	CreateUser(ctx context.Context, user model.User) error
+	// GetUser looks a user up by username, returning ErrNotFound if there is none or it is deactivated
+	GetUser(ctx context.Context, username string) (model.User, error)
+	// GetAccount looks a user up by username like GetUser, deactivated or not
+	GetAccount(ctx context.Context, username string) (model.User, error)
+	// Usernames matches names against accounts that are not deactivated in any letter case,
+	// mapping each name that has an account to the username as the account spells it
+	Usernames(ctx context.Context, names []string) (map[string]string, error)
+	// UpdatePassword replaces the stored password hash of the user
+	UpdatePassword(ctx context.Context, username string, hash string) error
+	// SetDMPolicy sets who can start a conversation with the user, returning ErrNotFound if there is no such user
+	SetDMPolicy(ctx context.Context, username string, policy string) error
+	// SetProtected protects the user's account or stops protecting it, returning ErrNotFound if there is no such user
+	SetProtected(ctx context.Context, username string, protected bool) error
+	// ProtectedAccounts returns which of the usernames are protected accounts
+	ProtectedAccounts(ctx context.Context, usernames []string) ([]string, error)
+	// DeactivatedAccounts returns which of the usernames are deactivated accounts, purged ones included
+	DeactivatedAccounts(ctx context.Context, usernames []string) ([]string, error)
+}
+
+// TweetStore persists tweets
+type TweetStore interface {
+	// CreateTweet stores the tweet and counts it on the tweet it retweets or quotes.
+	// It returns ErrDuplicate if the tweet is a retweet and its author already retweeted the original.
+	CreateTweet(ctx context.Context, tweet model.Tweet) error
+	// GetTweet looks a tweet up by ID, returning ErrNotFound if there is none
+	GetTweet(ctx context.Context, id uuid.UUID) (model.Tweet, error)
+	// GetTweets looks tweets up by ID, leaving out the ones that do not exist
+	GetTweets(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]model.Tweet, error)
+	// GetRetweet returns author's retweet of the original, or ErrNotFound if they have not retweeted it
+	GetRetweet(ctx context.Context, author string, original uuid.UUID) (model.Tweet, error)
+	// CountTweets returns how many tweets the author has posted
+	CountTweets(ctx context.Context, author string) (int64, error)
+	// TweetsByAuthor lists every tweet of the author, oldest first
+	TweetsByAuthor(ctx context.Context, author string) ([]model.Tweet, error)
+	// TweetsByAuthors returns a newest-first page of the tweets posted by any of the authors
+	TweetsByAuthors(ctx context.Context, authors []string, page Page) ([]model.Tweet, error)
+	// HomeTimeline returns a newest-first page of the tweets posted by the accounts username follows.
+	// Replies are only included when the account being replied to is followed too.
+	HomeTimeline(ctx context.Context, username string, page Page) ([]model.Tweet, error)
+	// TimelineTweets returns a newest-first page of the tweets posted by any of the authors that belong
+	// in the home timeline of someone following followings, applying the same rule for replies as HomeTimeline
+	TimelineTweets(ctx context.Context, authors []string, followings []string, page Page) ([]model.Tweet, error)
+	// Mentions returns a newest-first page of the tweets mentioning the user
+	Mentions(ctx context.Context, username string, page Page) ([]model.Tweet, error)
+	// Replies returns a newest-first page of the direct replies to each of the parents, keyed by parent.
+	// The page limit applies to every parent separately.
+	Replies(ctx context.Context, parents []uuid.UUID, page Page) (map[uuid.UUID][]model.Tweet, error)
+	// DeleteTweet removes the tweet along with its retweets and likes and uncounts it on the tweet it
+	// retweets or quotes, returning ErrNotFound unless it exists and belongs to author
+	DeleteTweet(ctx context.Context, author string, id uuid.UUID) error
+}
+
+// GraphStore persists who follows whom as one edge per follow. Adding or removing an edge
+// updates both users' FollowersCount and FollowingCount along with it.
+type GraphStore interface {
+	// Follow records that follower follows followee, returning ErrDuplicate if it already does
+	Follow(ctx context.Context, follower string, followee string) error
+	// Unfollow removes the follow edge, returning ErrNotFound if there is none
+	Unfollow(ctx context.Context, follower string, followee string) error
+	// Follows reports whether follower follows followee
+	Follows(ctx context.Context, follower string, followee string) (bool, error)
+	// Followings lists every username the user follows
+	Followings(ctx context.Context, username string) ([]string, error)
+	// Followers lists every username following the user
+	Followers(ctx context.Context, username string) ([]string, error)
+	// FollowingPage returns a page of the edges of the accounts the user follows, most recently followed first
+	FollowingPage(ctx context.Context, username string, page Page) ([]model.Follow, error)
+	// FollowersPage returns a page of the edges of the user's followers, most recently followed first
+	FollowersPage(ctx context.Context, username string, page Page) ([]model.Follow, error)
+	// RequestFollow stores a request to follow a protected account, returning ErrDuplicate if the
+	// requester already asked to follow the target
+	RequestFollow(ctx context.Context, request model.FollowRequest) error
+	// FollowRequests returns a newest-first page of the requests to follow the target
+	FollowRequests(ctx context.Context, target string, page Page) ([]model.FollowRequest, error)
+	// DeleteFollowRequest removes the request, returning ErrNotFound if there is none
+	DeleteFollowRequest(ctx context.Context, requester string, target string) error
+}
+
+// SessionStore persists login sessions keyed by the hash of their bearer token
+type SessionStore interface {
+	// CreateSession stores a new session
+	CreateSession(ctx context.Context, session model.Session) error
+	// GetSession returns the unexpired session with the given ID, or ErrNotFound
+	GetSession(ctx context.Context, id string) (model.Session, error)
+	// UserSessions lists the unexpired sessions of the user, oldest first
+	UserSessions(ctx context.Context, username string) ([]model.Session, error)
+	// DeleteSession revokes a single session
+	DeleteSession(ctx context.Context, id string) error
+	// DeleteUserSessions revokes every session of the user
+	DeleteUserSessions(ctx context.Context, username string) error
+}
+
+// FeedStore persists materialized home timelines for fan-out-on-write
+type FeedStore interface {
+	// PushFeed adds the entries to the timeline of every owner, keeping only the newest capacity entries of each
+	PushFeed(ctx context.Context, owners []string, entries []model.FeedEntry, capacity int) error
+	// ReadFeed returns a newest-first page of the owner's materialized timeline, hydrated into tweets.
+	// Only entries by one of the given authors are included, replies to accounts outside authors are left out
+	// and tweets deleted since they were pushed are skipped.
+	ReadFeed(ctx context.Context, owner string, authors []string, page Page) ([]model.Tweet, error)
+	// MarkCelebrity records that the author's tweets are no longer fanned out and must be merged in at read time
+	MarkCelebrity(ctx context.Context, author string) error
+	// Celebrities lists every author marked by MarkCelebrity
+	Celebrities(ctx context.Context) ([]string, error)
+}
+
+// LikeStore persists likes. Every like is counted on its tweet's LikeCount.
+type LikeStore interface {
+	// Like records the like and counts it, returning ErrDuplicate if the user already likes the tweet
+	// and ErrNotFound if there is no such tweet
+	Like(ctx context.Context, like model.Like) error
+	// Unlike removes the user's like of the tweet and uncounts it, returning ErrNotFound if there is none
+	Unlike(ctx context.Context, tweetID uuid.UUID, username string) error
+	// TweetLikes returns a newest-first page of the likes of the tweet
+	TweetLikes(ctx context.Context, tweetID uuid.UUID, page Page) ([]model.Like, error)
+	// UserLikes returns a newest-first page of the likes given by the user
+	UserLikes(ctx context.Context, username string, page Page) ([]model.Like, error)
+}
+
+// SearchStore finds tweets and accounts. Retweets are never returned, since their text is the original's.
+type SearchStore interface {
+	// SearchTweets returns a newest-first page of the tweets matching the query
+	SearchTweets(ctx context.Context, q search.Query, page Page) ([]model.Tweet, error)
+	// RankTweets returns up to limit of the tweets matching the query, most relevant first and
+	// newest first among equally relevant ones, after skipping the first offset
+	RankTweets(ctx context.Context, q search.Query, offset int, limit int) ([]model.Tweet, error)
+	// SearchUsers returns up to limit accounts that are not deactivated, after skipping the first offset, where each of the lowercase
+	// prefixes starts the username, first name or last name. Accounts whose username is the first prefix
+	// come first, then those whose username starts with it, then the rest, each group by username.
+	SearchUsers(ctx context.Context, prefixes []string, offset int, limit int) ([]model.User, error)
+}
+
+// NotificationStore persists the notifications inbox of every user
+type NotificationStore interface {
+	// AddNotifications stores the notifications
+	AddNotifications(ctx context.Context, notifications []model.Notification) error
+	// Notifications returns a newest-first page of the recipient's notifications
+	Notifications(ctx context.Context, recipient string, page Page) ([]model.Notification, error)
+	// UnreadCount counts the recipient's unread notifications
+	UnreadCount(ctx context.Context, recipient string) (int64, error)
+	// MarkRead marks every notification of the recipient created up to upTo as read and returns how many were unread
+	MarkRead(ctx context.Context, recipient string, upTo time.Time) (int64, error)
+}
+
+// DMStore persists direct message conversations and their messages
+type DMStore interface {
+	// CreateConversation stores a new conversation, returning ErrDuplicate if one with the same Key exists
+	CreateConversation(ctx context.Context, conversation model.Conversation) error
+	// GetConversation looks a conversation up by ID, returning ErrNotFound if there is none
+	GetConversation(ctx context.Context, id uuid.UUID) (model.Conversation, error)
+	// ConversationByKey looks a conversation up by its Key, returning ErrNotFound if there is none
+	ConversationByKey(ctx context.Context, key string) (model.Conversation, error)
+	// Conversations returns a page of the conversations the user takes part in, most recently active
+	// first. Pages are positioned by LastMessageAt rather than CreatedAt.
+	Conversations(ctx context.Context, username string, page Page) ([]model.Conversation, error)
+	// AddMessage stores the message and makes it the last message of its conversation, which the
+	// sender has then read up to
+	AddMessage(ctx context.Context, message model.Message) error
+	// Messages returns a newest-first page of the conversation's messages
+	Messages(ctx context.Context, conversationID uuid.UUID, page Page) ([]model.Message, error)
+	// MarkConversationRead records that the user has read the conversation up to upTo, never moving
+	// how far they have read backwards
+	MarkConversationRead(ctx context.Context, conversationID uuid.UUID, username string, upTo time.Time) error
+	// UnreadMessages counts, for each of the conversations, the messages sent by others after the
+	// user last read it. Conversations without unread messages are left out.
+	UnreadMessages(ctx context.Context, username string, conversations []model.Conversation) (map[uuid.UUID]int64, error)
+}
+
+// RelationStore persists who blocks and mutes whom
+type RelationStore interface {
+	// Block records the block and removes the follows and follow requests between the two users
+	// both ways, all or nothing. It returns ErrDuplicate if the blocker already blocks the
+	// account, still having removed any follow or request made since.
+	Block(ctx context.Context, block model.Block) error
+	// Unblock removes the block, returning ErrNotFound if there is none
+	Unblock(ctx context.Context, blocker string, blocked string) error
+	// Blocks lists the blocks made by the user, most recent first
+	Blocks(ctx context.Context, blocker string) ([]model.Block, error)
+	// BlockedBy lists the accounts blocking the user
+	BlockedBy(ctx context.Context, blocked string) ([]string, error)
+	// Mute stores the mute and returns it as stored. Muting an account or a word the user already
+	// mutes keeps the existing mute and only changes when it expires.
+	Mute(ctx context.Context, mute model.Mute) (model.Mute, error)
+	// Unmute removes the user's mute of the account, returning ErrNotFound if there is none
+	Unmute(ctx context.Context, username string, account string) error
+	// UnmuteWord removes the user's mute of a word by its ID, returning ErrNotFound if there is none
+	UnmuteWord(ctx context.Context, username string, id uuid.UUID) error
+	// Mutes lists the user's mutes that have not expired by now, most recent first
+	Mutes(ctx context.Context, username string, now time.Time) ([]model.Mute, error)
+}
+
+// DeletionStore tracks account deletions and removes what the purge of an account has to
+type DeletionStore interface {
+	// RequestDeletion deactivates the account of the deletion's user as of its RequestedAt and
+	// stores the deletion, both or neither. It returns ErrNotFound if there is no such user or
+	// the account is already deactivated.
+	RequestDeletion(ctx context.Context, deletion model.Deletion) error
+	// UpdateDeletion saves the stage and progress of the deletion, returning ErrNotFound if it was cancelled
+	UpdateDeletion(ctx context.Context, deletion model.Deletion) error
+	// CancelDeletion removes the user's deletion while it is still pending and restores their
+	// account, both or neither, returning ErrNotFound if there is no deletion left to cancel
+	CancelDeletion(ctx context.Context, username string) error
+	// StartDeletion marks the pending deletion as started at, after which it can no longer be
+	// cancelled, returning ErrNotFound if it was cancelled
+	StartDeletion(ctx context.Context, id uuid.UUID, at time.Time) error
+	// DueDeletions lists the unfinished deletions whose grace period is over by now, oldest first
+	DueDeletions(ctx context.Context, now time.Time) ([]model.Deletion, error)
+	// PurgeReferences removes the notifications sent to or by the user, the blocks, mutes and
+	// follow requests made by or about them, their sessions and their materialized timeline
+	PurgeReferences(ctx context.Context, username string) error
+	// PurgeAccount strips the user's account down to its username as of at. The username stays
+	// taken for good, so no one else can take over the conversations and mentions that name it.
+	PurgeAccount(ctx context.Context, username string, at time.Time) error
+}
+
+// Store bundles every store the controller needs
+type Store interface {
+	UserStore
+	TweetStore
+	GraphStore
+	SessionStore
+	FeedStore
+	LikeStore
+	SearchStore
+	NotificationStore
+	DMStore
+	RelationStore
+	DeletionStore
+}
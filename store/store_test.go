@@ -0,0 +1,1124 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"twitter-feed/entities"
+	"twitter-feed/model"
+	"twitter-feed/search"
+	"twitter-feed/store"
+	"twitter-feed/store/storetest"
+)
+
+// contract lists the behaviour every Store must have, whatever keeps the data. Each case gets
+// a new, empty store.
+var contract = []struct {
+	name string
+	run  func(t *testing.T, st store.Store)
+}{
+	{"Users", testUsers},
+	{"Tweets", testTweets},
+	{"Follows", testFollows},
+	{"Sessions", testSessions},
+	{"Pagination", testPagination},
+	{"Feeds", testFeeds},
+	{"Replies", testReplies},
+	{"Retweets", testRetweets},
+	{"Likes", testLikes},
+	{"ParallelLikes", testParallelLikes},
+	{"Search", testSearch},
+	{"Notifications", testNotifications},
+	{"DirectMessages", testDirectMessages},
+	{"Relations", testRelations},
+	{"FollowRequests", testFollowRequests},
+	{"Deletions", testDeletions},
+}
+
+func TestMemory(t *testing.T) {
+	runContract(t, func(t *testing.T) store.Store {
+		return store.NewMemory()
+	})
+}
+
+// TestMongo runs the contract against the MongoDB named by TWITTER_TEST_MONGO_URI, with a
+// throwaway database per case
+func TestMongo(t *testing.T) {
+	uri := os.Getenv("TWITTER_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TWITTER_TEST_MONGO_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	runContract(t, func(t *testing.T) store.Store {
+		database := client.Database(fmt.Sprintf("twitter_test_%d", time.Now().UnixNano()))
+		t.Cleanup(func() {
+			database.Drop(context.Background())
+		})
+		st, err := store.NewMongo(context.Background(), database, store.DefaultCollections)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	})
+}
+
+func runContract(t *testing.T, newStore func(t *testing.T) store.Store) {
+	for _, c := range contract {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, newStore(t))
+		})
+	}
+}
+
+func testUsers(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	storetest.CreateUser(t, st, "alice")
+	for _, username := range []string{"alice", "ALICE"} {
+		err := st.CreateUser(ctx, model.User{Username: username})
+		if err != store.ErrDuplicate {
+			t.Errorf("creating %s next to alice: got %v, want ErrDuplicate", username, err)
+		}
+	}
+	user, err := st.GetUser(ctx, "alice")
+	if err != nil || user.FirstName != "Falice" {
+		t.Errorf("GetUser(alice) = %+v, %v", user, err)
+	}
+	_, err = st.GetUser(ctx, "bob")
+	if err != store.ErrNotFound {
+		t.Errorf("GetUser(bob): got %v, want ErrNotFound", err)
+	}
+	err = st.UpdatePassword(ctx, "alice", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ = st.GetUser(ctx, "alice")
+	if user.Password != "other" {
+		t.Errorf("password after UpdatePassword = %q", user.Password)
+	}
+}
+
+func testTweets(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	storetest.CreateUser(t, st, "alice")
+	storetest.CreateTweet(t, st, "alice", "second", storetest.At(2))
+	first := storetest.CreateTweet(t, st, "alice", "first", storetest.At(1))
+	got, err := st.GetTweet(ctx, first.ID)
+	if err != nil || got.Text != "first" || got.Author != "alice" {
+		t.Errorf("GetTweet = %+v, %v", got, err)
+	}
+	tweets, err := st.TweetsByAuthor(ctx, "alice")
+	if err != nil || !storetest.Equal(storetest.Texts(tweets), []string{"first", "second"}) {
+		t.Errorf("TweetsByAuthor = %v, %v, want oldest first", storetest.Texts(tweets), err)
+	}
+	n, err := st.CountTweets(ctx, "alice")
+	if err != nil || n != 2 {
+		t.Errorf("CountTweets = %d, %v", n, err)
+	}
+	err = st.DeleteTweet(ctx, "bob", first.ID)
+	if err != store.ErrNotFound {
+		t.Errorf("deleting someone else's tweet: got %v, want ErrNotFound", err)
+	}
+	err = st.DeleteTweet(ctx, "alice", first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.GetTweet(ctx, first.ID)
+	if err != store.ErrNotFound {
+		t.Errorf("GetTweet after DeleteTweet: got %v, want ErrNotFound", err)
+	}
+	tweets, _ = st.TweetsByAuthor(ctx, "alice")
+	if !storetest.Equal(storetest.Texts(tweets), []string{"second"}) {
+		t.Errorf("TweetsByAuthor after DeleteTweet = %v", storetest.Texts(tweets))
+	}
+}
+
+func testFollows(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	for _, follower := range []string{"bob", "carol"} {
+		err := st.Follow(ctx, follower, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := st.Follow(ctx, "bob", "alice")
+	if err != store.ErrDuplicate {
+		t.Errorf("following twice: got %v, want ErrDuplicate", err)
+	}
+	alice, _ := st.GetUser(ctx, "alice")
+	bob, _ := st.GetUser(ctx, "bob")
+	if alice.FollowersCount != 2 || alice.FollowingCount != 0 || bob.FollowingCount != 1 {
+		t.Errorf("counts: alice %d followers and %d following, bob %d following", alice.FollowersCount, alice.FollowingCount, bob.FollowingCount)
+	}
+	follows, err := st.Follows(ctx, "bob", "alice")
+	if err != nil || !follows {
+		t.Errorf("Follows(bob, alice) = %v, %v", follows, err)
+	}
+	follows, _ = st.Follows(ctx, "alice", "bob")
+	if follows {
+		t.Error("Follows(alice, bob) is true")
+	}
+	followers, err := st.Followers(ctx, "alice")
+	if err != nil || len(followers) != 2 {
+		t.Errorf("Followers(alice) = %v, %v", followers, err)
+	}
+	edges, err := st.FollowersPage(ctx, "alice", store.Page{Limit: 1})
+	if err != nil || len(edges) != 1 || edges[0].Follower != "carol" {
+		t.Fatalf("first page of alice's followers = %+v, %v, want carol", edges, err)
+	}
+	edges, err = st.FollowersPage(ctx, "alice", store.Page{Limit: 1, Cursor: &store.Cursor{CreatedAt: edges[0].CreatedAt, ID: edges[0].ID}})
+	if err != nil || len(edges) != 1 || edges[0].Follower != "bob" {
+		t.Errorf("second page of alice's followers = %+v, %v, want bob", edges, err)
+	}
+	edges, err = st.FollowingPage(ctx, "bob", store.Page{Limit: 10})
+	if err != nil || len(edges) != 1 || edges[0].Followee != "alice" {
+		t.Errorf("whom bob follows = %+v, %v, want alice", edges, err)
+	}
+
+	err = st.Unfollow(ctx, "bob", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Unfollow(ctx, "bob", "alice")
+	if err != store.ErrNotFound {
+		t.Errorf("unfollowing twice: got %v, want ErrNotFound", err)
+	}
+	alice, _ = st.GetUser(ctx, "alice")
+	bob, _ = st.GetUser(ctx, "bob")
+	if alice.FollowersCount != 1 || bob.FollowingCount != 0 {
+		t.Errorf("counts after unfollowing: alice %d followers, bob %d following", alice.FollowersCount, bob.FollowingCount)
+	}
+}
+
+func testSessions(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	now := time.Now()
+	sessions := []model.Session{
+		{ID: "phone", Username: "alice", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{ID: "laptop", Username: "alice", CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{ID: "old", Username: "alice", CreatedAt: now.Add(-3 * time.Hour), ExpiresAt: now.Add(-time.Minute)},
+		{ID: "bob", Username: "bob", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, session := range sessions {
+		err := st.CreateSession(ctx, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := st.GetSession(ctx, "old")
+	if err != store.ErrNotFound {
+		t.Errorf("GetSession of an expired session: got %v, want ErrNotFound", err)
+	}
+	list, err := st.UserSessions(ctx, "alice")
+	if err != nil || len(list) != 2 || list[0].ID != "phone" || list[1].ID != "laptop" {
+		t.Errorf("UserSessions(alice) = %v, %v, want phone then laptop", list, err)
+	}
+	err = st.DeleteSession(ctx, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.GetSession(ctx, "phone")
+	if err != store.ErrNotFound {
+		t.Errorf("GetSession after DeleteSession: got %v, want ErrNotFound", err)
+	}
+	err = st.DeleteUserSessions(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.GetSession(ctx, "laptop")
+	if err != store.ErrNotFound {
+		t.Errorf("GetSession after DeleteUserSessions: got %v, want ErrNotFound", err)
+	}
+	_, err = st.GetSession(ctx, "bob")
+	if err != nil {
+		t.Errorf("DeleteUserSessions(alice) revoked bob's session: %v", err)
+	}
+}
+
+func testPagination(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	st.Follow(ctx, "carol", "alice")
+	st.Follow(ctx, "carol", "bob")
+	storetest.CreateTweet(t, st, "alice", "a1", storetest.At(1))
+	storetest.CreateTweet(t, st, "bob", "b2", storetest.At(2))
+	// tweets sharing a timestamp still page in a stable order
+	twin1 := storetest.CreateTweet(t, st, "alice", "twin", storetest.At(3))
+	twin2 := storetest.CreateTweet(t, st, "bob", "twin", storetest.At(3))
+	storetest.CreateTweet(t, st, "alice", "a4", storetest.At(4))
+	storetest.CreateTweet(t, st, "carol", "own", storetest.At(5))
+
+	var seen []model.Tweet
+	page := store.Page{Limit: 2}
+	for i := 0; i < 5; i++ {
+		tweets, err := st.HomeTimeline(ctx, "carol", page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tweets) == 0 {
+			break
+		}
+		seen = append(seen, tweets...)
+		last := tweets[len(tweets)-1]
+		page.Cursor = &store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	if len(seen) != 5 {
+		t.Fatalf("paging saw %d tweets, want 5: %v", len(seen), storetest.Texts(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		before := store.Page{Cursor: &store.Cursor{CreatedAt: seen[i-1].CreatedAt, ID: seen[i-1].ID}}
+		if !before.Contains(seen[i].CreatedAt, seen[i].ID) {
+			t.Errorf("tweet %d (%s) is not older than the one before it", i, seen[i].Text)
+		}
+	}
+	if seen[1].ID == seen[2].ID || (seen[1].ID != twin1.ID && seen[1].ID != twin2.ID) {
+		t.Errorf("the twins were not both listed once: %v", storetest.Texts(seen))
+	}
+
+	// a newer cursor returns the tweets just newer than it, still newest first
+	oldest := seen[len(seen)-1]
+	tweets, err := st.HomeTimeline(ctx, "carol", store.Page{Limit: 2, Cursor: &store.Cursor{CreatedAt: oldest.CreatedAt, ID: oldest.ID, Newer: true}})
+	if err != nil || !storetest.Equal(storetest.Texts(tweets), []string{seen[2].Text, "b2"}) {
+		t.Errorf("tweets just newer than a1 = %v, %v", storetest.Texts(tweets), err)
+	}
+
+	cursor := store.Cursor{CreatedAt: storetest.At(3), ID: twin1.ID, Newer: true}
+	parsed, err := store.ParseCursor(cursor.String())
+	if err != nil || !parsed.CreatedAt.Equal(cursor.CreatedAt) || parsed.ID != cursor.ID || !parsed.Newer {
+		t.Errorf("ParseCursor(String()) = %+v, %v, want %+v", parsed, err, cursor)
+	}
+	_, err = store.ParseCursor("garbage")
+	if err != store.ErrBadCursor {
+		t.Errorf("ParseCursor(garbage): got %v, want ErrBadCursor", err)
+	}
+}
+
+func testFeeds(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	storetest.CreateUser(t, st, "alice")
+	storetest.CreateUser(t, st, "carol")
+	var entries []model.FeedEntry
+	var tweets []model.Tweet
+	for i, author := range []string{"alice", "carol", "alice", "alice"} {
+		tweet := storetest.CreateTweet(t, st, author, fmt.Sprint(i+1), storetest.At(i+1))
+		tweets = append(tweets, tweet)
+		entries = append(entries, model.FeedEntry{TweetID: tweet.ID, Author: author, CreatedAt: tweet.CreatedAt})
+	}
+	// the feed keeps only the newest three entries
+	err := st.PushFeed(ctx, []string{"bob", "dave"}, entries, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.DeleteTweet(ctx, "alice", tweets[2].ID)
+	feed, err := st.ReadFeed(ctx, "bob", []string{"alice", "carol"}, store.Page{Limit: 10})
+	if err != nil || !storetest.Equal(storetest.Texts(feed), []string{"4", "2"}) {
+		t.Errorf("bob's feed = %v, %v, want [4 2]", storetest.Texts(feed), err)
+	}
+	// entries by accounts no longer followed are left out
+	feed, _ = st.ReadFeed(ctx, "dave", []string{"carol"}, store.Page{Limit: 10})
+	if !storetest.Equal(storetest.Texts(feed), []string{"2"}) {
+		t.Errorf("dave's feed = %v, want [2]", storetest.Texts(feed))
+	}
+
+	err = st.MarkCelebrity(ctx, "alice")
+	if err == nil {
+		err = st.MarkCelebrity(ctx, "alice")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	celebrities, err := st.Celebrities(ctx)
+	if err != nil || !storetest.Equal(celebrities, []string{"alice"}) {
+		t.Errorf("Celebrities = %v, %v, want [alice]", celebrities, err)
+	}
+}
+
+func testReplies(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		storetest.CreateUser(t, st, username)
+	}
+	root := storetest.CreateTweet(t, st, "alice", "root", storetest.At(1))
+	other := storetest.CreateTweet(t, st, "carol", "other", storetest.At(2))
+	r1 := storetest.CreateReply(t, st, "bob", root, "r1", storetest.At(3))
+	storetest.CreateReply(t, st, "carol", root, "r2", storetest.At(4))
+	storetest.CreateReply(t, st, "alice", r1, "r1.1", storetest.At(5))
+	storetest.CreateReply(t, st, "alice", other, "to carol", storetest.At(6))
+	storetest.CreateReply(t, st, "alice", root, "to herself", storetest.At(7))
+
+	// the limit applies to every parent separately
+	byParent, err := st.Replies(ctx, []uuid.UUID{root.ID, r1.ID, other.ID}, store.Page{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, tweet := range []model.Tweet{root, r1, other} {
+		got[tweet.Text] = storetest.Texts(byParent[tweet.ID])
+	}
+	if fmt.Sprint(got) != fmt.Sprint(map[string][]string{"root": {"to herself", "r2"}, "r1": {"r1.1"}, "other": {"to carol"}}) {
+		t.Errorf("Replies = %v", got)
+	}
+
+	// replies only reach the timeline of those who follow the account replied to as well
+	st.Follow(ctx, "dave", "alice")
+	tweets, err := st.HomeTimeline(ctx, "dave", store.Page{Limit: 10})
+	if err != nil || !storetest.Equal(storetest.Texts(tweets), []string{"to herself", "root"}) {
+		t.Errorf("dave's timeline = %v, %v, want alice's replies to bob and carol left out", storetest.Texts(tweets), err)
+	}
+	st.Follow(ctx, "dave", "carol")
+	tweets, _ = st.TimelineTweets(ctx, []string{"alice"}, []string{"alice", "carol"}, store.Page{Limit: 10})
+	if !storetest.Equal(storetest.Texts(tweets), []string{"to herself", "to carol", "root"}) {
+		t.Errorf("alice's tweets for someone following carol too = %v", storetest.Texts(tweets))
+	}
+}
+
+func testRetweets(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	original := storetest.CreateTweet(t, st, "alice", "original", storetest.At(1))
+	retweet := func(author string, minute int) (model.Tweet, error) {
+		id := original.ID
+		tweet := model.Tweet{ID: uuid.New(), Author: author, CreatedAt: storetest.At(minute), RetweetOf: &id}
+		tweet.ConversationID = tweet.ID
+		return tweet, st.CreateTweet(ctx, tweet)
+	}
+	counts := func(retweets int64, quotes int64) {
+		t.Helper()
+		got, err := st.GetTweet(ctx, original.ID)
+		if err != nil || got.RetweetCount != retweets || got.QuoteCount != quotes {
+			t.Errorf("counts = %d retweets, %d quotes, %v, want %d and %d", got.RetweetCount, got.QuoteCount, err, retweets, quotes)
+		}
+	}
+
+	bobs, err := retweet("bob", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = retweet("bob", 3)
+	if err != store.ErrDuplicate {
+		t.Errorf("retweeting twice: got %v, want ErrDuplicate", err)
+	}
+	_, err = retweet("carol", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := original.ID
+	quote := model.Tweet{ID: uuid.New(), Author: "carol", Text: "look", CreatedAt: storetest.At(5), QuoteOf: &id}
+	quote.ConversationID = quote.ID
+	err = st.CreateTweet(ctx, quote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts(2, 1)
+
+	got, err := st.GetRetweet(ctx, "bob", original.ID)
+	if err != nil || got.ID != bobs.ID {
+		t.Errorf("GetRetweet = %+v, %v, want bob's retweet", got, err)
+	}
+	_, err = st.GetRetweet(ctx, "alice", original.ID)
+	if err != store.ErrNotFound {
+		t.Errorf("GetRetweet of a tweet never retweeted: got %v, want ErrNotFound", err)
+	}
+	byID, err := st.GetTweets(ctx, []uuid.UUID{original.ID, quote.ID, uuid.New()})
+	if err != nil || len(byID) != 2 || byID[quote.ID].Text != "look" {
+		t.Errorf("GetTweets = %v, %v, want the two tweets that exist", byID, err)
+	}
+
+	err = st.DeleteTweet(ctx, "bob", bobs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts(1, 1)
+	_, err = retweet("bob", 6)
+	if err != nil {
+		t.Errorf("retweeting again after undoing it: %v", err)
+	}
+	err = st.DeleteTweet(ctx, "carol", quote.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts(2, 0)
+
+	// deleting the original takes its retweets along
+	err = st.DeleteTweet(ctx, "alice", original.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"bob", "carol"} {
+		_, err = st.GetRetweet(ctx, username, original.ID)
+		if err != store.ErrNotFound {
+			t.Errorf("%s's retweet after deleting the original: got %v, want ErrNotFound", username, err)
+		}
+	}
+}
+
+// like stores a like of tweet by username, given minutes after storetest.At
+func like(st store.Store, tweet model.Tweet, username string, minute int) error {
+	return st.Like(context.Background(), model.Like{ID: uuid.New(), TweetID: tweet.ID, Username: username, CreatedAt: storetest.At(minute)})
+}
+
+// likeCount loads how often tweet was liked
+func likeCount(t *testing.T, st store.Store, tweet model.Tweet) int64 {
+	t.Helper()
+	got, err := st.GetTweet(context.Background(), tweet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got.LikeCount
+}
+
+func testLikes(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	first := storetest.CreateTweet(t, st, "alice", "first", storetest.At(1))
+	second := storetest.CreateTweet(t, st, "alice", "second", storetest.At(2))
+
+	for _, err := range []error{like(st, first, "bob", 3), like(st, first, "carol", 4), like(st, second, "bob", 5)} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := like(st, first, "bob", 6)
+	if err != store.ErrDuplicate {
+		t.Errorf("liking twice: got %v, want ErrDuplicate", err)
+	}
+	if n := likeCount(t, st, first); n != 2 {
+		t.Errorf("like count after liking twice = %d, want 2", n)
+	}
+	err = st.Unlike(ctx, second.ID, "carol")
+	if err != store.ErrNotFound {
+		t.Errorf("unliking a tweet never liked: got %v, want ErrNotFound", err)
+	}
+	if n := likeCount(t, st, second); n != 1 {
+		t.Errorf("like count after a failed unlike = %d, want 1", n)
+	}
+	err = like(st, model.Tweet{ID: uuid.New()}, "bob", 6)
+	if err != store.ErrNotFound {
+		t.Errorf("liking a missing tweet: got %v, want ErrNotFound", err)
+	}
+	likes, _ := st.UserLikes(ctx, "bob", store.Page{Limit: 10})
+	if len(likes) != 2 {
+		t.Errorf("bob has %d likes after liking a missing tweet, want 2", len(likes))
+	}
+
+	likes, err = st.TweetLikes(ctx, first.ID, store.Page{Limit: 10})
+	if err != nil || len(likes) != 2 || likes[0].Username != "carol" || likes[1].Username != "bob" {
+		t.Errorf("TweetLikes = %+v, %v, want carol then bob", likes, err)
+	}
+	likes, err = st.UserLikes(ctx, "bob", store.Page{Limit: 1})
+	if err != nil || len(likes) != 1 || likes[0].TweetID != second.ID {
+		t.Fatalf("UserLikes = %+v, %v, want bob's latest like", likes, err)
+	}
+	cursor := store.Cursor{CreatedAt: likes[0].CreatedAt, ID: likes[0].ID}
+	likes, err = st.UserLikes(ctx, "bob", store.Page{Limit: 1, Cursor: &cursor})
+	if err != nil || len(likes) != 1 || likes[0].TweetID != first.ID {
+		t.Errorf("UserLikes after the cursor = %+v, %v, want bob's like of the first tweet", likes, err)
+	}
+
+	err = st.Unlike(ctx, first.ID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := likeCount(t, st, first); n != 1 {
+		t.Errorf("like count after unliking = %d, want 1", n)
+	}
+	err = st.Unlike(ctx, first.ID, "bob")
+	if err != store.ErrNotFound {
+		t.Errorf("unliking twice: got %v, want ErrNotFound", err)
+	}
+
+	// likes go away with their tweet
+	err = st.DeleteTweet(ctx, "alice", second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	likes, err = st.UserLikes(ctx, "bob", store.Page{Limit: 10})
+	if err != nil || len(likes) != 0 {
+		t.Errorf("bob's likes after the tweet was deleted = %+v, %v", likes, err)
+	}
+}
+
+// testParallelLikes likes and unlikes one tweet from many goroutines at once; run it with -race
+func testParallelLikes(t *testing.T, st store.Store) {
+	const users = 20
+	tweet := storetest.CreateTweet(t, st, "alice", "popular", storetest.At(1))
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*users)
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(username string) {
+			defer wg.Done()
+			errs <- like(st, tweet, username, 2)
+			// only one of the two likes can be stored
+			if err := like(st, tweet, username, 3); err != store.ErrDuplicate {
+				errs <- fmt.Errorf("liking twice as %s: got %v, want ErrDuplicate", username, err)
+			}
+			if username[len(username)-1]%2 == 0 {
+				errs <- st.Unlike(context.Background(), tweet.ID, username)
+			}
+		}(fmt.Sprintf("user%02d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := likeCount(t, st, tweet); n != users/2 {
+		t.Errorf("like count = %d, want %d", n, users/2)
+	}
+	likes, err := st.TweetLikes(context.Background(), tweet.ID, store.Page{Limit: users})
+	if err != nil || len(likes) != users/2 {
+		t.Errorf("TweetLikes = %d likes, %v, want %d", len(likes), err, users/2)
+	}
+}
+
+func testSearch(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "alicia", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	err := st.CreateUser(ctx, model.User{Username: "zed", FirstName: "Alison", LastName: "Zed", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(author string, text string, minute int) model.Tweet {
+		tweet := model.Tweet{ID: uuid.New(), Author: author, Text: text, CreatedAt: storetest.At(minute), Entities: entities.Parse(text)}
+		tweet.ConversationID = tweet.ID
+		err := st.CreateTweet(ctx, tweet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tweet
+	}
+	love := post("alice", "Gophers love Go #golang", 1)
+	post("bob", "go go go", 2)
+	post("alice", "I like rust", 3)
+	post("carol", "go and rust together", 4)
+	id := love.ID
+	retweet := model.Tweet{ID: uuid.New(), Author: "bob", CreatedAt: storetest.At(5), RetweetOf: &id}
+	retweet.ConversationID = retweet.ID
+	err = st.CreateTweet(ctx, retweet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		raw    string
+		recent []string
+	}{
+		{"go", []string{"go and rust together", "go go go", "Gophers love Go #golang"}},
+		{"GO rust", []string{"go and rust together"}},
+		{`"love go"`, []string{"Gophers love Go #golang"}},
+		{`"go love"`, nil},
+		{"go -rust", []string{"go go go", "Gophers love Go #golang"}},
+		{"from:alice rust", []string{"I like rust"}},
+		{"from:alice -rust", []string{"Gophers love Go #golang"}},
+		{"#GoLang", []string{"Gophers love Go #golang"}},
+		{"go since:2021-06-01 until:2021-06-02", []string{"go and rust together", "go go go", "Gophers love Go #golang"}},
+		{"go since:2021-06-02", nil},
+		{"java", nil},
+	}
+	for _, c := range cases {
+		q, err := search.Parse(c.raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.raw, err)
+		}
+		tweets, err := st.SearchTweets(ctx, q, store.Page{Limit: 10})
+		if err != nil || !storetest.Equal(storetest.Texts(tweets), c.recent) {
+			t.Errorf("SearchTweets(%q) = %q, %v, want %q", c.raw, storetest.Texts(tweets), err, c.recent)
+		}
+	}
+
+	q, _ := search.Parse("go")
+	tweets, err := st.SearchTweets(ctx, q, store.Page{Limit: 2})
+	if err != nil || len(tweets) != 2 {
+		t.Fatalf("SearchTweets with a limit = %q, %v", storetest.Texts(tweets), err)
+	}
+	cursor := store.Cursor{CreatedAt: tweets[1].CreatedAt, ID: tweets[1].ID}
+	tweets, err = st.SearchTweets(ctx, q, store.Page{Limit: 2, Cursor: &cursor})
+	if err != nil || !storetest.Equal(storetest.Texts(tweets), []string{"Gophers love Go #golang"}) {
+		t.Errorf("SearchTweets after the cursor = %q, %v", storetest.Texts(tweets), err)
+	}
+	// the tweet saying go three times ranks first, the rest newest first
+	tweets, err = st.RankTweets(ctx, q, 0, 10)
+	if err != nil || len(tweets) != 3 || tweets[0].Text != "go go go" {
+		t.Errorf("RankTweets(go) = %q, %v, want go go go first", storetest.Texts(tweets), err)
+	}
+	tweets, err = st.RankTweets(ctx, q, 1, 1)
+	if err != nil || len(tweets) != 1 || tweets[0].Text == "go go go" {
+		t.Errorf("RankTweets(go) after skipping the best = %q, %v", storetest.Texts(tweets), err)
+	}
+	q, _ = search.Parse("from:alice")
+	tweets, err = st.RankTweets(ctx, q, 0, 10)
+	if err != nil || !storetest.Equal(storetest.Texts(tweets), []string{"I like rust", "Gophers love Go #golang"}) {
+		t.Errorf("RankTweets(from:alice) = %q, %v, want newest first", storetest.Texts(tweets), err)
+	}
+
+	usernames := func(users []model.User) []string {
+		out := make([]string, 0, len(users))
+		for _, user := range users {
+			out = append(out, user.Username)
+		}
+		return out
+	}
+	users, err := st.SearchUsers(ctx, []string{"alice"}, 0, 10)
+	if err != nil || !storetest.Equal(usernames(users), []string{"alice"}) {
+		t.Errorf("SearchUsers(alice) = %v, %v", usernames(users), err)
+	}
+	// exact usernames first, then usernames starting with the prefix, then names
+	users, err = st.SearchUsers(ctx, []string{"ali"}, 0, 10)
+	if err != nil || !storetest.Equal(usernames(users), []string{"alice", "alicia", "zed"}) {
+		t.Errorf("SearchUsers(ali) = %v, %v", usernames(users), err)
+	}
+	users, err = st.SearchUsers(ctx, []string{"ali", "z"}, 0, 10)
+	if err != nil || !storetest.Equal(usernames(users), []string{"zed"}) {
+		t.Errorf("SearchUsers(ali z) = %v, %v", usernames(users), err)
+	}
+	users, err = st.SearchUsers(ctx, []string{"ali"}, 1, 1)
+	if err != nil || !storetest.Equal(usernames(users), []string{"alicia"}) {
+		t.Errorf("SearchUsers(ali) from 1 = %v, %v", usernames(users), err)
+	}
+}
+
+func testNotifications(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	tweet := storetest.CreateTweet(t, st, "alice", "hi", storetest.At(1))
+	notifications := []model.Notification{
+		{ID: uuid.New(), Recipient: "alice", Kind: model.NotifyFollow, Actor: "bob", CreatedAt: storetest.At(2)},
+		{ID: uuid.New(), Recipient: "alice", Kind: model.NotifyLike, Actor: "bob", TweetID: &tweet.ID, CreatedAt: storetest.At(3)},
+		{ID: uuid.New(), Recipient: "alice", Kind: model.NotifyLike, Actor: "carol", TweetID: &tweet.ID, CreatedAt: storetest.At(4)},
+		{ID: uuid.New(), Recipient: "bob", Kind: model.NotifyFollow, Actor: "alice", CreatedAt: storetest.At(5)},
+	}
+	err := st.AddNotifications(ctx, notifications)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.AddNotifications(ctx, nil)
+	if err != nil {
+		t.Errorf("adding no notifications: %v", err)
+	}
+	actors := func(notifications []model.Notification) []string {
+		out := make([]string, 0, len(notifications))
+		for _, notification := range notifications {
+			out = append(out, notification.Kind+":"+notification.Actor)
+		}
+		return out
+	}
+	got, err := st.Notifications(ctx, "alice", store.Page{Limit: 2})
+	if err != nil || !storetest.Equal(actors(got), []string{"like:carol", "like:bob"}) {
+		t.Fatalf("Notifications = %v, %v, want the two likes", actors(got), err)
+	}
+	cursor := store.Cursor{CreatedAt: got[1].CreatedAt, ID: got[1].ID}
+	got, err = st.Notifications(ctx, "alice", store.Page{Limit: 2, Cursor: &cursor})
+	if err != nil || !storetest.Equal(actors(got), []string{"follow:bob"}) || got[0].TweetID != nil {
+		t.Errorf("Notifications after the cursor = %v, %v, want bob's follow", actors(got), err)
+	}
+
+	unread, err := st.UnreadCount(ctx, "alice")
+	if err != nil || unread != 3 {
+		t.Errorf("UnreadCount = %d, %v, want 3", unread, err)
+	}
+	marked, err := st.MarkRead(ctx, "alice", storetest.At(3))
+	if err != nil || marked != 2 {
+		t.Errorf("MarkRead up to the first like = %d, %v, want 2", marked, err)
+	}
+	marked, err = st.MarkRead(ctx, "alice", storetest.At(3))
+	if err != nil || marked != 0 {
+		t.Errorf("MarkRead again = %d, %v, want 0", marked, err)
+	}
+	unread, err = st.UnreadCount(ctx, "alice")
+	if err != nil || unread != 1 {
+		t.Errorf("UnreadCount after MarkRead = %d, %v, want carol's like", unread, err)
+	}
+	got, _ = st.Notifications(ctx, "alice", store.Page{Limit: 10})
+	if len(got) != 3 || got[0].Read || !got[1].Read || !got[2].Read {
+		t.Errorf("read flags = %+v", got)
+	}
+	unread, err = st.UnreadCount(ctx, "bob")
+	if err != nil || unread != 1 {
+		t.Errorf("bob's UnreadCount = %d, %v, want 1", unread, err)
+	}
+
+	mention := model.Tweet{ID: uuid.New(), Author: "bob", Text: "@alice @carol look", CreatedAt: storetest.At(6), Entities: entities.Parse("@alice @carol look")}
+	mention.ConversationID = mention.ID
+	err = st.CreateTweet(ctx, mention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for username, want := range map[string][]string{"alice": {"@alice @carol look"}, "carol": {"@alice @carol look"}, "bob": {}} {
+		tweets, err := st.Mentions(ctx, username, store.Page{Limit: 10})
+		if err != nil || !storetest.Equal(storetest.Texts(tweets), want) {
+			t.Errorf("Mentions(%s) = %q, %v, want %q", username, storetest.Texts(tweets), err, want)
+		}
+	}
+}
+
+func testDirectMessages(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	conversation := func(participants []string, group bool, created time.Time) model.Conversation {
+		t.Helper()
+		c := model.Conversation{ID: uuid.New(), Participants: participants, Group: group, CreatedBy: participants[0],
+			CreatedAt: created, LastMessageAt: created, ReadAt: map[string]time.Time{participants[0]: created}}
+		c.Key = c.ID.String()
+		if !group {
+			c.Key = participants[0] + "," + participants[1]
+		}
+		err := st.CreateConversation(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	send := func(c model.Conversation, sender, text string, created time.Time) {
+		t.Helper()
+		err := st.AddMessage(ctx, model.Message{ID: uuid.New(), ConversationID: c.ID, Sender: sender, Text: text, CreatedAt: created})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	direct := conversation([]string{"alice", "bob"}, false, storetest.At(1))
+	group := conversation([]string{"alice", "bob", "carol"}, true, storetest.At(2))
+
+	duplicate := direct
+	duplicate.ID = uuid.New()
+	if err := st.CreateConversation(ctx, duplicate); err != store.ErrDuplicate {
+		t.Errorf("creating a second alice,bob conversation = %v, want ErrDuplicate", err)
+	}
+	found, err := st.ConversationByKey(ctx, "alice,bob")
+	if err != nil || found.ID != direct.ID {
+		t.Errorf("ConversationByKey = %v, %v, want %v", found.ID, err, direct.ID)
+	}
+	if _, err = st.ConversationByKey(ctx, "alice,carol"); err != store.ErrNotFound {
+		t.Errorf("ConversationByKey(alice,carol) = %v, want ErrNotFound", err)
+	}
+	if _, err = st.GetConversation(ctx, uuid.New()); err != store.ErrNotFound {
+		t.Errorf("GetConversation(unknown) = %v, want ErrNotFound", err)
+	}
+
+	send(direct, "alice", "hi", storetest.At(3))
+	send(direct, "alice", "there", storetest.At(4))
+	send(group, "carol", "hello all", storetest.At(5))
+	found, err = st.GetConversation(ctx, direct.ID)
+	if err != nil || found.LastMessage == nil || found.LastMessage.Text != "there" || !found.LastMessageAt.Equal(storetest.At(4)) {
+		t.Errorf("GetConversation after two messages = %+v, %v", found, err)
+	}
+
+	ids := func(conversations []model.Conversation) []string {
+		out := make([]string, 0, len(conversations))
+		for _, c := range conversations {
+			out = append(out, c.Key)
+		}
+		return out
+	}
+	conversations, err := st.Conversations(ctx, "bob", store.Page{Limit: 10})
+	if err != nil || !storetest.Equal(ids(conversations), []string{group.Key, direct.Key}) {
+		t.Errorf("bob's Conversations = %v, %v, want the group first", ids(conversations), err)
+	}
+	conversations, err = st.Conversations(ctx, "dave", store.Page{Limit: 10})
+	if err != nil || len(conversations) != 0 {
+		t.Errorf("dave's Conversations = %v, %v, want none", ids(conversations), err)
+	}
+
+	unread, err := st.UnreadMessages(ctx, "bob", []model.Conversation{direct, group})
+	if err != nil || unread[direct.ID] != 2 || unread[group.ID] != 1 {
+		t.Errorf("bob's UnreadMessages = %v, %v, want 2 and 1", unread, err)
+	}
+	unread, err = st.UnreadMessages(ctx, "alice", []model.Conversation{direct, group})
+	if err != nil || len(unread) != 1 || unread[group.ID] != 1 {
+		t.Errorf("alice's UnreadMessages = %v, %v, want only carol's message", unread, err)
+	}
+	err = st.MarkConversationRead(ctx, direct.ID, "bob", storetest.At(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reading up to an earlier time keeps what was read
+	err = st.MarkConversationRead(ctx, direct.ID, "bob", storetest.At(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// UnreadMessages goes by how far the conversations passed in were read
+	direct, err = st.GetConversation(ctx, direct.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unread, err = st.UnreadMessages(ctx, "bob", []model.Conversation{direct})
+	if err != nil || unread[direct.ID] != 1 {
+		t.Errorf("bob's UnreadMessages after reading the first message = %v, %v, want 1", unread, err)
+	}
+
+	messages, err := st.Messages(ctx, direct.ID, store.Page{Limit: 1})
+	if err != nil || len(messages) != 1 || messages[0].Text != "there" {
+		t.Fatalf("Messages = %+v, %v, want the newest", messages, err)
+	}
+	cursor := store.Cursor{CreatedAt: messages[0].CreatedAt, ID: messages[0].ID}
+	messages, err = st.Messages(ctx, direct.ID, store.Page{Limit: 10, Cursor: &cursor})
+	if err != nil || len(messages) != 1 || messages[0].Text != "hi" {
+		t.Errorf("Messages after the cursor = %+v, %v, want the first", messages, err)
+	}
+}
+
+func testRelations(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	// between is what follows or asks to follow whom among alice and bob, and their counts
+	between := func() string {
+		t.Helper()
+		out := ""
+		for _, pair := range [][2]string{{"alice", "bob"}, {"bob", "alice"}} {
+			follows, err := st.Follows(ctx, pair[0], pair[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			requests, err := st.FollowRequests(ctx, pair[1], store.Page{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out += fmt.Sprintf("%s follows %v and has %d requests; ", pair[0], follows, len(requests))
+		}
+		alice, _ := st.GetUser(ctx, "alice")
+		bob, _ := st.GetUser(ctx, "bob")
+		return out + fmt.Sprintf("counts %d %d %d %d", alice.FollowersCount, alice.FollowingCount, bob.FollowersCount, bob.FollowingCount)
+	}
+	none := "alice follows false and has 0 requests; bob follows false and has 0 requests; counts 0 0 0 0"
+	err := st.Follow(ctx, "alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.RequestFollow(ctx, model.FollowRequest{ID: uuid.New(), Requester: "bob", Target: "alice", CreatedAt: storetest.At(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Block(ctx, model.Block{Blocker: "alice", Blocked: "bob", CreatedAt: storetest.At(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := between(); got != none {
+		t.Errorf("after the block: %s", got)
+	}
+	// blocking again still clears what came in since
+	err = st.Follow(ctx, "bob", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Block(ctx, model.Block{Blocker: "alice", Blocked: "bob", CreatedAt: storetest.At(2)})
+	if err != store.ErrDuplicate {
+		t.Errorf("blocking twice: got %v, want ErrDuplicate", err)
+	}
+	if got := between(); got != none {
+		t.Errorf("after blocking twice: %s", got)
+	}
+	blocks, _ := st.Blocks(ctx, "alice")
+	if len(blocks) != 1 || !blocks[0].CreatedAt.Equal(storetest.At(1)) {
+		t.Errorf("alice's blocks = %+v, want the first block kept", blocks)
+	}
+	st.Block(ctx, model.Block{Blocker: "carol", Blocked: "bob", CreatedAt: storetest.At(3)})
+	blockers, err := st.BlockedBy(ctx, "bob")
+	if err != nil || len(blockers) != 2 {
+		t.Errorf("BlockedBy(bob) = %v, %v, want alice and carol", blockers, err)
+	}
+	err = st.Unblock(ctx, "alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Unblock(ctx, "alice", "bob")
+	if err != store.ErrNotFound {
+		t.Errorf("unblocking twice: got %v, want ErrNotFound", err)
+	}
+	blocks, _ = st.Blocks(ctx, "alice")
+	if len(blocks) != 0 {
+		t.Errorf("alice still blocks %v", blocks)
+	}
+
+	now := time.Now()
+	soon := now.Add(time.Hour)
+	first, err := st.Mute(ctx, model.Mute{ID: uuid.New(), Username: "alice", Account: "bob", CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := st.Mute(ctx, model.Mute{ID: uuid.New(), Username: "alice", Account: "bob", CreatedAt: now, ExpiresAt: &soon})
+	if err != nil || again.ID != first.ID || again.ExpiresAt == nil {
+		t.Errorf("muting again = %+v, %v, want the first mute with the new expiry", again, err)
+	}
+	past := now.Add(-time.Minute)
+	st.Mute(ctx, model.Mute{ID: uuid.New(), Username: "alice", Word: "spoiler", CreatedAt: now.Add(-time.Hour), ExpiresAt: &past})
+	mutes, err := st.Mutes(ctx, "alice", now)
+	if err != nil || len(mutes) != 1 || mutes[0].Account != "bob" {
+		t.Errorf("Mutes(alice) = %+v, %v, want bob's mute alone since the word's expired", mutes, err)
+	}
+	err = st.Unmute(ctx, "alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Unmute(ctx, "alice", "bob")
+	if err != store.ErrNotFound {
+		t.Errorf("unmuting twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func testFollowRequests(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		storetest.CreateUser(t, st, username)
+	}
+	err := st.SetProtected(ctx, "alice", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = st.SetProtected(ctx, "nobody", true); err != store.ErrNotFound {
+		t.Errorf("protecting an unknown user: got %v, want ErrNotFound", err)
+	}
+	protected, err := st.ProtectedAccounts(ctx, []string{"alice", "bob", "nobody"})
+	if err != nil || !storetest.Equal(protected, []string{"alice"}) {
+		t.Errorf("ProtectedAccounts = %v, %v, want alice", protected, err)
+	}
+
+	for i, requester := range []string{"bob", "carol"} {
+		err = st.RequestFollow(ctx, model.FollowRequest{ID: uuid.New(), Requester: requester, Target: "alice", CreatedAt: storetest.At(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = st.RequestFollow(ctx, model.FollowRequest{ID: uuid.New(), Requester: "bob", Target: "alice", CreatedAt: storetest.At(5)})
+	if err != store.ErrDuplicate {
+		t.Errorf("asking twice: got %v, want ErrDuplicate", err)
+	}
+	requesters := func(requests []model.FollowRequest) []string {
+		out := make([]string, 0, len(requests))
+		for _, request := range requests {
+			out = append(out, request.Requester)
+		}
+		return out
+	}
+	requests, err := st.FollowRequests(ctx, "alice", store.Page{Limit: 1})
+	if err != nil || !storetest.Equal(requesters(requests), []string{"carol"}) {
+		t.Fatalf("FollowRequests = %v, %v, want carol's", requesters(requests), err)
+	}
+	cursor := store.Cursor{CreatedAt: requests[0].CreatedAt, ID: requests[0].ID}
+	requests, err = st.FollowRequests(ctx, "alice", store.Page{Limit: 1, Cursor: &cursor})
+	if err != nil || !storetest.Equal(requesters(requests), []string{"bob"}) {
+		t.Errorf("FollowRequests after the cursor = %v, %v, want bob's", requesters(requests), err)
+	}
+
+	err = st.DeleteFollowRequest(ctx, "bob", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = st.DeleteFollowRequest(ctx, "bob", "alice"); err != store.ErrNotFound {
+		t.Errorf("deleting a request twice: got %v, want ErrNotFound", err)
+	}
+	requests, err = st.FollowRequests(ctx, "alice", store.Page{Limit: 10})
+	if err != nil || !storetest.Equal(requesters(requests), []string{"carol"}) {
+		t.Errorf("FollowRequests after deleting bob's = %v, %v, want carol's", requesters(requests), err)
+	}
+}
+
+func testDeletions(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	storetest.CreateUser(t, st, "alice")
+	deletion := model.Deletion{ID: uuid.New(), Username: "alice", RequestedAt: storetest.At(1), PurgeAt: storetest.At(10), Stage: model.DeletionPending}
+	err := st.RequestDeletion(ctx, deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.GetUser(ctx, "alice")
+	if err != store.ErrNotFound {
+		t.Errorf("GetUser of a deactivated account: got %v, want ErrNotFound", err)
+	}
+	account, err := st.GetAccount(ctx, "alice")
+	if err != nil || account.DeactivatedAt == nil || !account.DeactivatedAt.Equal(storetest.At(1)) {
+		t.Errorf("GetAccount(alice) = %+v, %v, want it deactivated as of the request", account, err)
+	}
+	deactivated, _ := st.DeactivatedAccounts(ctx, []string{"alice", "bob"})
+	if !storetest.Equal(deactivated, []string{"alice"}) {
+		t.Errorf("DeactivatedAccounts = %v, want [alice]", deactivated)
+	}
+	err = st.RequestDeletion(ctx, model.Deletion{ID: uuid.New(), Username: "alice", RequestedAt: storetest.At(2), PurgeAt: storetest.At(12)})
+	if err != store.ErrNotFound {
+		t.Errorf("deleting a deactivated account: got %v, want ErrNotFound", err)
+	}
+	due, err := st.DueDeletions(ctx, storetest.At(9))
+	if err != nil || len(due) != 0 {
+		t.Errorf("deletions due before the grace period is over = %v, %v", due, err)
+	}
+
+	// logging in during the grace period cancels the deletion and restores the account
+	err = st.CancelDeletion(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.GetUser(ctx, "alice")
+	if err != nil {
+		t.Errorf("GetUser after CancelDeletion: %v", err)
+	}
+	err = st.CancelDeletion(ctx, "alice")
+	if err != store.ErrNotFound {
+		t.Errorf("cancelling twice: got %v, want ErrNotFound", err)
+	}
+
+	// once the purge has started there is nothing left to cancel
+	deletion.ID = uuid.New()
+	err = st.RequestDeletion(ctx, deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err = st.DueDeletions(ctx, storetest.At(10))
+	if err != nil || len(due) != 1 || due[0].ID != deletion.ID {
+		t.Fatalf("due deletions = %v, %v, want alice's", due, err)
+	}
+	err = st.StartDeletion(ctx, deletion.ID, storetest.At(11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.CancelDeletion(ctx, "alice")
+	if err != store.ErrNotFound {
+		t.Errorf("cancelling a started deletion: got %v, want ErrNotFound", err)
+	}
+
+	err = st.PurgeAccount(ctx, "alice", storetest.At(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err = st.GetAccount(ctx, "alice")
+	if err != nil || account.PurgedAt == nil || account.Password != "" || account.FirstName != "" {
+		t.Errorf("purged account = %+v, %v, want only its username left", account, err)
+	}
+	// the username stays taken, in any letter case
+	for _, username := range []string{"alice", "Alice"} {
+		err = st.CreateUser(ctx, model.User{Username: username})
+		if err != store.ErrDuplicate {
+			t.Errorf("registering %s after the purge: got %v, want ErrDuplicate", username, err)
+		}
+	}
+	err = st.PurgeAccount(ctx, "bob", storetest.At(12))
+	if err != store.ErrNotFound {
+		t.Errorf("purging an unknown account: got %v, want ErrNotFound", err)
+	}
+}
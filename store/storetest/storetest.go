@@ -0,0 +1,73 @@
+// Package storetest holds helpers for the tests of packages that run on a store.Store
+package storetest
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+	"twitter-feed/model"
+	"twitter-feed/store"
+)
+
+// CreateUser stores an account for username, failing the test if it cannot
+func CreateUser(t *testing.T, st store.Store, username string) {
+	t.Helper()
+	err := st.CreateUser(context.Background(), model.User{Username: username, FirstName: "F" + username, LastName: "L" + username, Password: "hash"})
+	if err != nil {
+		t.Fatalf("creating %s: %v", username, err)
+	}
+}
+
+// At returns a time minutes after a fixed instant, so tests can order things without sleeping
+func At(minutes int) time.Time {
+	return time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+}
+
+// CreateTweet stores a tweet by author that starts its own conversation and returns it
+func CreateTweet(t *testing.T, st store.Store, author string, text string, created time.Time) model.Tweet {
+	t.Helper()
+	tweet := model.Tweet{ID: uuid.New(), Author: author, Text: text, CreatedAt: created}
+	tweet.ConversationID = tweet.ID
+	return create(t, st, tweet)
+}
+
+// CreateReply stores a reply by author to parent and returns it
+func CreateReply(t *testing.T, st store.Store, author string, parent model.Tweet, text string, created time.Time) model.Tweet {
+	t.Helper()
+	id := parent.ID
+	tweet := model.Tweet{ID: uuid.New(), Author: author, Text: text, CreatedAt: created,
+		InReplyToID: &id, InReplyToUser: parent.Author, ConversationID: parent.Conversation()}
+	return create(t, st, tweet)
+}
+
+func create(t *testing.T, st store.Store, tweet model.Tweet) model.Tweet {
+	t.Helper()
+	err := st.CreateTweet(context.Background(), tweet)
+	if err != nil {
+		t.Fatalf("creating tweet %q: %v", tweet.Text, err)
+	}
+	return tweet
+}
+
+// Texts lists the text of each tweet, in order
+func Texts(tweets []model.Tweet) []string {
+	out := make([]string, 0, len(tweets))
+	for _, tweet := range tweets {
+		out = append(out, tweet.Text)
+	}
+	return out
+}
+
+// Equal reports whether a and b hold the same strings in the same order
+func Equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,317 @@
+// Package stream is the in-process pub/sub hub behind the streaming endpoints. Handlers publish
+// events to the users they concern; every connection of those users gets them through its own
+// buffered channel, so one slow client never holds up publishing or the other clients.
+//
+// Each event gets an ID that only ever grows, and the hub keeps the latest events of every user
+// who is connected or was until recently, so a client that reconnects with the last ID it saw
+// gets what it missed. When that history does not reach back far enough the client is sent a
+// Reset event instead and should reload its timeline and notifications.
+//
+// Like trends, the hub lives in process memory: with several instances a client only hears
+// about what happens on the instance it is connected to.
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned when subscribing after Close, and is why subscriptions end on Close
+var ErrClosed = errors.New("stream: hub closed")
+
+// ErrSlow is why a subscription that fell too far behind was ended under the Disconnect policy
+var ErrSlow = errors.New("stream: subscriber too slow")
+
+// Kinds of events
+const (
+	KindTweet        = "tweet"
+	KindNotification = "notification"
+	KindMessage      = "message"
+	// KindReset tells a client that it missed events and should reload instead of resuming
+	KindReset = "reset"
+)
+
+// Policies for connections whose buffer is full when an event is published
+const (
+	// Disconnect ends the subscription; the client can reconnect and resume where it stopped
+	Disconnect = "disconnect"
+	// Drop skips the event for that connection, which is sent a Reset once it catches up
+	Drop = "drop"
+)
+
+// Event is one message pushed to subscribers
+type Event struct {
+	ID   uint64          `json:"id"`
+	Kind string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// reset returns a Reset event; clients that resume after it get the events published after id
+func reset(id uint64) Event {
+	return Event{ID: id, Kind: KindReset, Data: json.RawMessage("{}")}
+}
+
+// Options tune the hub and the connections it serves
+type Options struct {
+	// Buffer is how many events a connection can have waiting to be written
+	Buffer int
+	// Replay is how many of each user's latest events are kept to resume from
+	Replay int
+	// Retain is how long a user's events are still kept after their last connection ends
+	Retain time.Duration
+	// Policy is what happens to a connection whose buffer is full: Disconnect or Drop
+	Policy string
+	// Heartbeat is how often idle connections are pinged so proxies and clients know they are alive
+	Heartbeat time.Duration
+	// Lifetime ends server-sent event streams after this long, if not zero, so they finish before
+	// the server's write timeout and the client reconnects and resumes
+	Lifetime time.Duration
+}
+
+// DefaultOptions are sensible settings for a single instance
+var DefaultOptions = Options{
+	Buffer:    64,
+	Replay:    256,
+	Retain:    5 * time.Minute,
+	Policy:    Disconnect,
+	Heartbeat: 15 * time.Second,
+}
+
+// Hub routes events to the subscriptions of the users they are published to. It is safe for
+// concurrent use.
+type Hub struct {
+	opts Options
+
+	mu sync.Mutex
+	// seq is the ID of the last event published
+	seq    uint64
+	users  map[string]*listener
+	swept  time.Time
+	closed bool
+}
+
+// listener is what the hub knows about a user who is connected or was until recently
+type listener struct {
+	subs map[*Subscription]bool
+	// history holds the user's latest events, oldest first
+	history []Event
+	// since is the ID after which history holds every event of the user
+	since uint64
+	// left is when the user's last subscription ended
+	left time.Time
+}
+
+// New returns a Hub. Event IDs start from the current time in microseconds, so they keep
+// growing across restarts and IDs from before a restart are answered with a Reset.
+func New(opts Options) *Hub {
+	return &Hub{
+		opts:  opts,
+		seq:   uint64(time.Now().UnixNano() / int64(time.Microsecond)),
+		users: make(map[string]*listener),
+		swept: time.Now(),
+	}
+}
+
+// Options returns the settings the hub was created with
+func (h *Hub) Options() Options {
+	return h.opts
+}
+
+// Active reports whether anyone is listening at all, which lets publishers skip the work of
+// building events nobody would receive. A closed hub has no one listening.
+func (h *Hub) Active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.closed && len(h.users) > 0
+}
+
+// Listening reports whether events published to username would be delivered or kept
+func (h *Hub) Listening(username string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.users[username]
+	return ok
+}
+
+// Listeners returns the usernames events would be delivered or kept for
+func (h *Hub) Listeners(usernames []string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	listeners := make([]string, 0)
+	for _, username := range usernames {
+		if _, ok := h.users[username]; ok {
+			listeners = append(listeners, username)
+		}
+	}
+	return listeners
+}
+
+// AllListeners returns every username events would be delivered or kept for, in no particular
+// order
+func (h *Hub) AllListeners() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	listeners := make([]string, 0, len(h.users))
+	for username := range h.users {
+		listeners = append(listeners, username)
+	}
+	return listeners
+}
+
+// Subscribe starts delivering username's events. With resume set, the subscription first
+// replays the events published after lastID, or a Reset when they are no longer all known.
+func (h *Hub) Subscribe(username string, lastID uint64, resume bool) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+	h.sweep(time.Now())
+	l, ok := h.users[username]
+	if !ok {
+		l = &listener{subs: make(map[*Subscription]bool), since: h.seq}
+		h.users[username] = l
+	}
+	sub := &Subscription{hub: h, username: username, events: make(chan Event, h.opts.Buffer)}
+	if resume {
+		if lastID < l.since || lastID > h.seq {
+			sub.replay = []Event{reset(h.seq)}
+		} else {
+			for _, event := range l.history {
+				if event.ID > lastID {
+					sub.replay = append(sub.replay, event)
+				}
+			}
+		}
+	}
+	l.subs[sub] = true
+	return sub, nil
+}
+
+// Publish sends an event to every listening user among usernames and returns its ID. It never
+// blocks: connections that cannot take the event are handled according to the hub's Policy.
+func (h *Hub) Publish(usernames []string, kind string, data json.RawMessage) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return 0
+	}
+	h.sweep(time.Now())
+	h.seq++
+	event := Event{ID: h.seq, Kind: kind, Data: data}
+	seen := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		l, ok := h.users[username]
+		if !ok || seen[username] {
+			continue
+		}
+		seen[username] = true
+		l.history = append(l.history, event)
+		if len(l.history) > h.opts.Replay {
+			l.since = l.history[0].ID
+			l.history = l.history[1:]
+		}
+		for sub := range l.subs {
+			select {
+			case sub.events <- event:
+			default:
+				if h.opts.Policy == Drop {
+					sub.missed++
+					continue
+				}
+				h.end(sub, ErrSlow)
+			}
+		}
+	}
+	return event.ID
+}
+
+// Close ends every subscription and refuses new ones, so streaming connections let the server
+// shut down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, l := range h.users {
+		for sub := range l.subs {
+			h.end(sub, ErrClosed)
+		}
+	}
+}
+
+// end removes the subscription and closes its channel. h.mu must be held.
+func (h *Hub) end(sub *Subscription, err error) {
+	l, ok := h.users[sub.username]
+	if !ok || !l.subs[sub] {
+		return
+	}
+	delete(l.subs, sub)
+	if len(l.subs) == 0 {
+		l.left = time.Now()
+	}
+	sub.err = err
+	close(sub.events)
+}
+
+// sweep forgets the users who left more than Retain ago, at most once per Retain. h.mu must
+// be held.
+func (h *Hub) sweep(now time.Time) {
+	if now.Sub(h.swept) < h.opts.Retain {
+		return
+	}
+	h.swept = now
+	for username, l := range h.users {
+		if len(l.subs) == 0 && now.Sub(l.left) >= h.opts.Retain {
+			delete(h.users, username)
+		}
+	}
+}
+
+// Subscription is one connection's feed of events
+type Subscription struct {
+	hub      *Hub
+	username string
+	events   chan Event
+	replay   []Event
+	// missed and err are guarded by hub.mu
+	missed int
+	err    error
+}
+
+// Replay returns the events to send before the ones from Events
+func (s *Subscription) Replay() []Event {
+	return s.replay
+}
+
+// Events delivers new events. It is closed when the subscription ends, after which Err says why.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Missed reports whether events were dropped since the last call. When they were, it returns a
+// Reset event to send the client.
+func (s *Subscription) Missed() (Event, bool) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if s.missed == 0 {
+		return Event{}, false
+	}
+	s.missed = 0
+	return reset(s.hub.seq), true
+}
+
+// Err returns ErrSlow or ErrClosed once the hub has ended the subscription, and nil otherwise
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription. The user's events are kept for Retain in case they reconnect.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.end(s, nil)
+}
@@ -0,0 +1,264 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions
+	opts.Buffer = 8
+	opts.Replay = 4
+	return opts
+}
+
+// publish sends an event whose data is n to the users and returns its ID
+func publish(h *Hub, n int, usernames ...string) uint64 {
+	return h.Publish(usernames, KindTweet, json.RawMessage(fmt.Sprint(n)))
+}
+
+// receive reads the events waiting on the subscription and returns their data
+func receive(sub *Subscription) []string {
+	out := make([]string, 0)
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return append(out, "closed")
+			}
+			out = append(out, string(event.Data))
+		default:
+			return out
+		}
+	}
+}
+
+// data returns the data of the events, or their kind for resets
+func data(events []Event) []string {
+	out := make([]string, 0, len(events))
+	for _, event := range events {
+		if event.Kind == KindReset {
+			out = append(out, KindReset)
+			continue
+		}
+		out = append(out, string(event.Data))
+	}
+	return out
+}
+
+func subscribe(t *testing.T, h *Hub, username string, lastID uint64, resume bool) *Subscription {
+	t.Helper()
+	sub, err := h.Subscribe(username, lastID, resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func TestPublish(t *testing.T) {
+	h := New(testOptions())
+	if h.Active() {
+		t.Error("a new hub is active")
+	}
+	alice := subscribe(t, h, "alice", 0, false)
+	phone := subscribe(t, h, "alice", 0, false)
+	bob := subscribe(t, h, "bob", 0, false)
+	first := publish(h, 1, "alice", "carol")
+	second := publish(h, 2, "alice", "bob", "alice")
+	if second <= first {
+		t.Errorf("event IDs %d then %d do not grow", first, second)
+	}
+	for name, sub := range map[string]*Subscription{"alice": alice, "alice's phone": phone} {
+		if got := receive(sub); fmt.Sprint(got) != "[1 2]" {
+			t.Errorf("%s received %v, want both events once", name, got)
+		}
+	}
+	if got := receive(bob); fmt.Sprint(got) != "[2]" {
+		t.Errorf("bob received %v", got)
+	}
+	if !h.Active() || !h.Listening("alice") || h.Listening("carol") {
+		t.Error("the hub does not know who is listening")
+	}
+	if got := h.Listeners([]string{"carol", "bob", "alice"}); fmt.Sprint(got) != "[bob alice]" {
+		t.Errorf("Listeners = %v", got)
+	}
+	all := h.AllListeners()
+	sort.Strings(all)
+	if fmt.Sprint(all) != "[alice bob]" {
+		t.Errorf("AllListeners = %v", all)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	h := New(testOptions())
+	sub := subscribe(t, h, "alice", 0, false)
+	if len(sub.Replay()) != 0 {
+		t.Errorf("a subscription that does not resume replays %v", data(sub.Replay()))
+	}
+	first := publish(h, 1, "alice")
+	publish(h, 2, "alice")
+	last := publish(h, 3, "alice")
+	sub.Close()
+	publish(h, 4, "alice")
+
+	// the user's events are kept after the connection ends
+	cases := []struct {
+		lastID uint64
+		want   string
+	}{
+		{first, "[2 3 4]"},
+		{last, "[4]"},
+		{last + 1, "[]"},
+		// IDs the hub never handed out, such as ones from before a restart, cannot be resumed
+		{last + 10, "[reset]"},
+		{first - 1, "[1 2 3 4]"},
+		{first - 2, "[reset]"},
+	}
+	for _, c := range cases {
+		sub := subscribe(t, h, "alice", c.lastID, true)
+		if got := fmt.Sprint(data(sub.Replay())); got != c.want {
+			t.Errorf("resuming after %d (first %d) replays %v, want %v", c.lastID, first, got, c.want)
+		}
+		sub.Close()
+	}
+	// a user the hub never saw cannot resume either
+	sub = subscribe(t, h, "bob", first, true)
+	if got := fmt.Sprint(data(sub.Replay())); got != "[reset]" {
+		t.Errorf("a new user resuming replays %v, want a reset", got)
+	}
+}
+
+func TestReplayTooShort(t *testing.T) {
+	h := New(testOptions())
+	sub := subscribe(t, h, "alice", 0, false)
+	first := publish(h, 1, "alice")
+	second := publish(h, 2, "alice")
+	for n := 3; n <= 6; n++ {
+		publish(h, n, "alice")
+	}
+	sub.Close()
+	// only the latest four events are kept, so resuming after the first misses the second
+	sub = subscribe(t, h, "alice", first, true)
+	replay := sub.Replay()
+	if len(replay) != 1 || replay[0].Kind != KindReset {
+		t.Fatalf("resuming after the first event replays %v, want a reset", data(replay))
+	}
+	sub.Close()
+	sub = subscribe(t, h, "alice", second, true)
+	if got := data(sub.Replay()); fmt.Sprint(got) != "[3 4 5 6]" {
+		t.Errorf("resuming after the second event replays %v", got)
+	}
+	sub.Close()
+	// resuming after the reset picks up what comes next
+	next := publish(h, 7, "alice")
+	sub = subscribe(t, h, "alice", replay[0].ID, true)
+	if got := data(sub.Replay()); fmt.Sprint(got) != "[7]" || sub.Replay()[0].ID != next {
+		t.Errorf("resuming after the reset replays %v", got)
+	}
+}
+
+func TestDropPolicy(t *testing.T) {
+	opts := testOptions()
+	opts.Buffer = 2
+	opts.Policy = Drop
+	h := New(opts)
+	slow := subscribe(t, h, "alice", 0, false)
+	fast := subscribe(t, h, "alice", 0, false)
+	for n := 1; n <= 4; n++ {
+		publish(h, n, "alice")
+		receive(fast)
+	}
+	if _, missed := fast.Missed(); missed {
+		t.Error("a connection that kept up missed events")
+	}
+	if got := receive(slow); fmt.Sprint(got) != "[1 2]" {
+		t.Errorf("the slow connection received %v, want what fit in its buffer", got)
+	}
+	event, missed := slow.Missed()
+	if !missed || event.Kind != KindReset {
+		t.Fatalf("Missed = %+v, %v, want a reset", event, missed)
+	}
+	if _, missed := slow.Missed(); missed {
+		t.Error("Missed reported the same dropped events twice")
+	}
+	// the connection stays open
+	publish(h, 5, "alice")
+	if got := receive(slow); fmt.Sprint(got) != "[5]" || slow.Err() != nil {
+		t.Errorf("after catching up the slow connection received %v, err %v", got, slow.Err())
+	}
+}
+
+func TestDisconnectPolicy(t *testing.T) {
+	opts := testOptions()
+	opts.Buffer = 2
+	h := New(opts)
+	slow := subscribe(t, h, "alice", 0, false)
+	fast := subscribe(t, h, "alice", 0, false)
+	for n := 1; n <= 3; n++ {
+		publish(h, n, "alice")
+		receive(fast)
+	}
+	if got := receive(slow); fmt.Sprint(got) != "[1 2 closed]" {
+		t.Errorf("the slow connection received %v, want its buffer then the end", got)
+	}
+	if slow.Err() != ErrSlow || fast.Err() != nil {
+		t.Errorf("errors = %v and %v, want only the slow connection ended", slow.Err(), fast.Err())
+	}
+	// the slow client reconnects where it stopped
+	resumed := subscribe(t, h, "alice", 0, false)
+	resumed.Close()
+	resumed = subscribe(t, h, "alice", h.seq-1, true)
+	if got := data(resumed.Replay()); fmt.Sprint(got) != "[3]" {
+		t.Errorf("resuming after the last event received replays %v", got)
+	}
+	// closing an ended subscription does nothing
+	slow.Close()
+	if slow.Err() != ErrSlow {
+		t.Errorf("Err after Close = %v, want ErrSlow", slow.Err())
+	}
+}
+
+func TestClose(t *testing.T) {
+	h := New(testOptions())
+	alice := subscribe(t, h, "alice", 0, false)
+	bob := subscribe(t, h, "bob", 0, false)
+	publish(h, 1, "alice")
+	h.Close()
+	if got := receive(alice); fmt.Sprint(got) != "[1 closed]" || alice.Err() != ErrClosed {
+		t.Errorf("alice received %v, err %v", got, alice.Err())
+	}
+	if got := receive(bob); fmt.Sprint(got) != "[closed]" || bob.Err() != ErrClosed {
+		t.Errorf("bob received %v, err %v", got, bob.Err())
+	}
+	if id := publish(h, 2, "alice"); id != 0 {
+		t.Errorf("publishing after Close returned ID %d", id)
+	}
+	_, err := h.Subscribe("alice", 0, false)
+	if err != ErrClosed {
+		t.Errorf("subscribing after Close: got %v, want ErrClosed", err)
+	}
+	alice.Close()
+}
+
+func TestRetain(t *testing.T) {
+	opts := testOptions()
+	opts.Retain = time.Millisecond
+	h := New(opts)
+	sub := subscribe(t, h, "alice", 0, false)
+	publish(h, 1, "alice")
+	time.Sleep(5 * time.Millisecond)
+	// alice is still connected, so her events are kept
+	publish(h, 2, "bob")
+	if !h.Listening("alice") {
+		t.Fatal("a connected user was forgotten")
+	}
+	sub.Close()
+	time.Sleep(5 * time.Millisecond)
+	publish(h, 3, "bob")
+	if h.Listening("alice") || h.Active() {
+		t.Error("a user who left longer than Retain ago is still kept")
+	}
+}
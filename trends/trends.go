@@ -0,0 +1,279 @@
+// Package trends finds the hashtags that are trending right now. New tweets stream into
+// per-hashtag counts kept in time buckets; a background loop periodically scores every hashtag
+// over each window and keeps the top ones in memory for the API to serve. A hashtag's score is
+// how far its recent, decayed count rises above what its own baseline predicts, so tags that are
+// always busy do not crowd out the ones suddenly taking off.
+//
+// Counts live in process memory only: they start empty on every restart and, with several
+// instances, each one trends over the tweets it was sent.
+package trends
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"twitter-feed/model"
+)
+
+// ErrStopped is returned when tweets are submitted after Stop
+var ErrStopped = errors.New("trends: service stopped")
+
+// Windows trends are computed over
+var Windows = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// Options tune the trends service
+type Options struct {
+	// Bucket is the granularity counts are kept at
+	Bucket time.Duration
+	// Baseline is how much history a hashtag's usual rate is measured over; it must be longer than every window
+	Baseline time.Duration
+	// Interval is how often trends are recomputed
+	Interval time.Duration
+	// Size is how many hashtags each window keeps
+	Size int
+	// MinCount is how many tweets a hashtag needs within a window to trend in it
+	MinCount int
+	// QueueSize is how many tweets can wait to be counted before new ones are dropped
+	QueueSize int
+}
+
+// DefaultOptions are sensible settings for a single instance
+var DefaultOptions = Options{
+	Bucket:    5 * time.Minute,
+	Baseline:  7 * 24 * time.Hour,
+	Interval:  time.Minute,
+	Size:      10,
+	MinCount:  3,
+	QueueSize: 1024,
+}
+
+// Service counts hashtags and serves the current trends
+type Service struct {
+	opts   Options
+	tweets chan model.Tweet
+	quit   chan struct{}
+	done   sync.WaitGroup
+
+	// mu guards counts and spelling, which only the counting goroutine writes
+	mu sync.Mutex
+	// counts holds the tweets per bucket of every hashtag, keyed by the lowercased tag
+	counts map[string]map[int64]int
+	// spelling is how each hashtag was last written
+	spelling map[string]string
+
+	trendsMu sync.RWMutex
+	trends   map[string]model.Trends
+
+	stopMu  sync.RWMutex
+	stopped bool
+	stop    sync.Once
+}
+
+// New returns a Service. Call Start before submitting tweets.
+func New(opts Options) *Service {
+	return &Service{
+		opts:     opts,
+		tweets:   make(chan model.Tweet, opts.QueueSize),
+		quit:     make(chan struct{}),
+		counts:   make(map[string]map[int64]int),
+		spelling: make(map[string]string),
+		trends:   make(map[string]model.Trends),
+	}
+}
+
+// Start launches the counting and scoring goroutines
+func (s *Service) Start() {
+	s.done.Add(2)
+	go s.count()
+	go s.recompute()
+}
+
+// Stop refuses new tweets, counts the queued ones or gives up when ctx expires, and shuts the
+// goroutines down. Stopping again only waits.
+func (s *Service) Stop(ctx context.Context) error {
+	s.stop.Do(func() {
+		s.stopMu.Lock()
+		s.stopped = true
+		close(s.tweets)
+		s.stopMu.Unlock()
+		close(s.quit)
+	})
+
+	finished := make(chan struct{})
+	go func() {
+		s.done.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TweetCreated queues the tweet's hashtags to be counted. It never blocks: when the queue is
+// full the tweet is dropped, which only makes trends slightly less accurate.
+func (s *Service) TweetCreated(tweet model.Tweet) error {
+	s.stopMu.RLock()
+	defer s.stopMu.RUnlock()
+	if s.stopped {
+		return ErrStopped
+	}
+	if len(tweet.Entities.Hashtags) == 0 {
+		return nil
+	}
+	select {
+	case s.tweets <- tweet:
+	default:
+		log.Printf("trends: queue full, dropping tweet %s", tweet.ID)
+	}
+	return nil
+}
+
+// Trends returns the trends last computed for the window, which must be one of Windows
+func (s *Service) Trends(window string) model.Trends {
+	s.trendsMu.RLock()
+	defer s.trendsMu.RUnlock()
+	trends, ok := s.trends[window]
+	if !ok {
+		return model.Trends{Window: window, Trends: make([]model.Trend, 0)}
+	}
+	return trends
+}
+
+func (s *Service) count() {
+	defer s.done.Done()
+	for tweet := range s.tweets {
+		bucket := s.bucket(tweet.CreatedAt)
+		s.mu.Lock()
+		seen := make(map[string]bool, len(tweet.Entities.Hashtags))
+		for _, hashtag := range tweet.Entities.Hashtags {
+			tag := strings.ToLower(hashtag.Text)
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			buckets, ok := s.counts[tag]
+			if !ok {
+				buckets = make(map[int64]int)
+				s.counts[tag] = buckets
+			}
+			buckets[bucket]++
+			s.spelling[tag] = hashtag.Text
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Service) recompute() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.score(now)
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Service) bucket(t time.Time) int64 {
+	return t.UnixNano() / int64(s.opts.Bucket)
+}
+
+// score recomputes the trends of every window and forgets buckets older than the baseline
+func (s *Service) score(now time.Time) {
+	current := s.bucket(now)
+	oldest := current - int64(s.opts.Baseline/s.opts.Bucket)
+	computed := make(map[string]model.Trends, len(Windows))
+	for name := range Windows {
+		computed[name] = model.Trends{Window: name, AsOf: now, Trends: make([]model.Trend, 0)}
+	}
+
+	s.mu.Lock()
+	for tag, buckets := range s.counts {
+		for b := range buckets {
+			if b <= oldest {
+				delete(buckets, b)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(s.counts, tag)
+			delete(s.spelling, tag)
+			continue
+		}
+		for name, window := range Windows {
+			trend, ok := s.trend(buckets, current, int64(window/s.opts.Bucket))
+			if ok {
+				trend.Tag = s.spelling[tag]
+				trends := computed[name]
+				trends.Trends = append(trends.Trends, trend)
+				computed[name] = trends
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for name, trends := range computed {
+		sort.Slice(trends.Trends, func(i, j int) bool {
+			if trends.Trends[i].Score != trends.Trends[j].Score {
+				return trends.Trends[i].Score > trends.Trends[j].Score
+			}
+			return trends.Trends[i].Tag < trends.Trends[j].Tag
+		})
+		if len(trends.Trends) > s.opts.Size {
+			trends.Trends = trends.Trends[:s.opts.Size]
+		}
+		computed[name] = trends
+	}
+	s.trendsMu.Lock()
+	s.trends = computed
+	s.trendsMu.Unlock()
+}
+
+// trend scores a hashtag over the last n buckets up to current. Each bucket of the window is
+// decayed by half every n/2 buckets so the latest activity weighs the most. The expected count
+// applies the same decay to the hashtag's average rate over the rest of the baseline, and the
+// score is the surplus over it scaled by its square root, like a Poisson z-score.
+func (s *Service) trend(buckets map[int64]int, current int64, n int64) (model.Trend, bool) {
+	baselineBuckets := int64(s.opts.Baseline/s.opts.Bucket) - n
+	var total, past int
+	var recent, weights float64
+	for b, count := range buckets {
+		age := current - b
+		if age >= n {
+			past += count
+			continue
+		}
+		if age < 0 {
+			// clocks disagree; count tweets from the future as current
+			age = 0
+		}
+		weight := math.Pow(0.5, float64(age)/(float64(n)/2))
+		total += count
+		recent += weight * float64(count)
+	}
+	if total < s.opts.MinCount {
+		return model.Trend{}, false
+	}
+	for age := int64(0); age < n; age++ {
+		weights += math.Pow(0.5, float64(age)/(float64(n)/2))
+	}
+	expected := weights * float64(past) / float64(baselineBuckets)
+	score := (recent - expected) / math.Sqrt(expected+1)
+	if score <= 0 {
+		return model.Trend{}, false
+	}
+	return model.Trend{TweetCount: total, Score: score}, true
+}
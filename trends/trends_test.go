@@ -0,0 +1,174 @@
+package trends
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"twitter-feed/model"
+)
+
+// now is when the tests score trends; it falls on a bucket boundary
+var now = time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func testOptions() Options {
+	opts := DefaultOptions
+	opts.Baseline = 48 * time.Hour
+	return opts
+}
+
+// add counts n tweets using tag, made the given time before now
+func add(s *Service, tag string, ago time.Duration, n int) {
+	buckets, ok := s.counts[tag]
+	if !ok {
+		buckets = make(map[int64]int)
+		s.counts[tag] = buckets
+	}
+	buckets[s.bucket(now.Add(-ago))] += n
+	s.spelling[tag] = tag
+}
+
+// ranking lists the tags trending in the window along with their tweet counts
+func ranking(s *Service, window string) []string {
+	out := make([]string, 0)
+	for _, trend := range s.Trends(window).Trends {
+		out = append(out, fmt.Sprintf("%s:%d", trend.Tag, trend.TweetCount))
+	}
+	return out
+}
+
+func TestSpikeBeatsSteady(t *testing.T) {
+	s := New(testOptions())
+	// news gets 10 tweets every 5 minutes and slightly more over the last hour
+	for ago := time.Duration(0); ago < 48*time.Hour; ago += 5 * time.Minute {
+		n := 10
+		if ago < time.Hour {
+			n = 11
+		}
+		add(s, "news", ago, n)
+	}
+	// weather is as busy as ever, if slightly quieter over the last hour
+	for ago := time.Duration(0); ago < 48*time.Hour; ago += 5 * time.Minute {
+		n := 10
+		if ago < time.Hour {
+			n = 9
+		}
+		add(s, "weather", ago, n)
+	}
+	// launch was never used before the last ten minutes
+	add(s, "launch", 0, 20)
+	add(s, "launch", 5*time.Minute, 10)
+	s.score(now)
+
+	if got := ranking(s, "hour"); fmt.Sprint(got) != "[launch:30 news:132]" {
+		t.Errorf("hour trends = %v, want launch ahead of news and no weather", got)
+	}
+	trends := s.Trends("hour").Trends
+	if len(trends) == 2 && trends[0].Score < 10*trends[1].Score {
+		t.Errorf("scores = %v and %v, want the spike far ahead", trends[0].Score, trends[1].Score)
+	}
+	if trends := s.Trends("hour"); !trends.AsOf.Equal(now) || trends.Window != "hour" {
+		t.Errorf("trends computed as of %v for %q", trends.AsOf, trends.Window)
+	}
+}
+
+func TestDecay(t *testing.T) {
+	s := New(testOptions())
+	add(s, "fresh", 0, 10)
+	add(s, "fading", 50*time.Minute, 10)
+	add(s, "yesterday", 20*time.Hour, 10)
+	s.score(now)
+
+	// within the hour, the later tweets weigh more
+	if got := ranking(s, "hour"); fmt.Sprint(got) != "[fresh:10 fading:10]" {
+		t.Errorf("hour trends = %v", got)
+	}
+	// and over the day, where yesterday's tweets count for little
+	if got := ranking(s, "day"); fmt.Sprint(got) != "[fresh:10 fading:10 yesterday:10]" {
+		t.Errorf("day trends = %v", got)
+	}
+}
+
+func TestMinCountAndSize(t *testing.T) {
+	opts := testOptions()
+	opts.Size = 2
+	opts.MinCount = 3
+	s := New(opts)
+	add(s, "two", 0, 2)
+	add(s, "three", 0, 3)
+	add(s, "four", 0, 4)
+	add(s, "five", 0, 5)
+	s.score(now)
+	if got := ranking(s, "hour"); fmt.Sprint(got) != "[five:5 four:4]" {
+		t.Errorf("hour trends = %v, want the top two of those used three times or more", got)
+	}
+
+	// equal scores are ordered by tag
+	s = New(opts)
+	add(s, "b", 0, 3)
+	add(s, "a", 0, 3)
+	add(s, "c", 0, 3)
+	s.score(now)
+	if got := ranking(s, "hour"); fmt.Sprint(got) != "[a:3 b:3]" {
+		t.Errorf("hour trends = %v, want a and b", got)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s := New(testOptions())
+	add(s, "old", 48*time.Hour, 5)
+	add(s, "old", 47*time.Hour, 5)
+	add(s, "gone", 49*time.Hour, 5)
+	s.score(now)
+	if _, ok := s.counts["gone"]; ok {
+		t.Error("a tag only used before the baseline is still counted")
+	}
+	if _, ok := s.spelling["gone"]; ok {
+		t.Error("a forgotten tag still has a spelling")
+	}
+	if len(s.counts["old"]) != 1 {
+		t.Errorf("old has %d buckets, want the one inside the baseline", len(s.counts["old"]))
+	}
+	if got := ranking(s, "day"); len(got) != 0 {
+		t.Errorf("day trends = %v, want none", got)
+	}
+}
+
+func TestService(t *testing.T) {
+	s := New(testOptions())
+	s.Start()
+	hashtags := func(tags ...string) model.Entities {
+		var e model.Entities
+		for _, tag := range tags {
+			e.Hashtags = append(e.Hashtags, model.Entity{Text: tag})
+		}
+		return e
+	}
+	for _, e := range []model.Entities{hashtags("Go"), hashtags("go", "GO"), hashtags("GoLang", "go"), hashtags()} {
+		err := s.TweetCreated(model.Tweet{CreatedAt: now, Entities: e})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.TweetCreated(model.Tweet{CreatedAt: now, Entities: hashtags("go")})
+	if err != ErrStopped {
+		t.Errorf("TweetCreated after Stop: got %v, want ErrStopped", err)
+	}
+	err = s.Stop(context.Background())
+	if err != nil {
+		t.Errorf("stopping twice: %v", err)
+	}
+
+	// a tag is counted once per tweet, in any case, under its latest spelling
+	s.score(now)
+	if got := ranking(s, "hour"); fmt.Sprint(got) != "[go:3]" {
+		t.Errorf("hour trends = %v, want go counted once per tweet", got)
+	}
+	if got := s.Trends("week"); len(got.Trends) != 0 {
+		t.Errorf("trends of an unknown window = %+v", got)
+	}
+}
@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DMLimits bound direct messages and the conversations they are sent in
+type DMLimits struct {
+	// MaxLength is how many characters a message can have
+	MaxLength int
+	// MaxParticipants is how many people, the creator included, a conversation can have
+	MaxParticipants int
+}
+
+// DefaultDMLimits allows messages of up to 10000 characters in conversations of up to 10 people
+var DefaultDMLimits = DMLimits{MaxLength: 10000, MaxParticipants: 10}
+
+// Message checks the text of a direct message, which cannot be blank
+func (l DMLimits) Message(errs *Errors, field string, text string) {
+	if strings.TrimSpace(text) == "" {
+		errs.add(field, CodeRequired, "Say something! Messages cannot be empty.")
+		return
+	}
+	if n := utf8.RuneCountInString(text); n > l.MaxLength {
+		*errs = append(*errs, FieldError{
+			Field:   field,
+			Code:    CodeTooLong,
+			Message: "Messages can be at most " + strconv.Itoa(l.MaxLength) + " characters long, yours has " + strconv.Itoa(n) + ".",
+			Limit:   l.MaxLength,
+		})
+	}
+}
+
+// Participants checks how many people, besides the creator, a new conversation is started with
+func (l DMLimits) Participants(errs *Errors, field string, others int) {
+	if others == 0 {
+		errs.add(field, CodeRequired, "Who do you want to talk to? Name at least one other account.")
+		return
+	}
+	if others+1 > l.MaxParticipants {
+		*errs = append(*errs, FieldError{
+			Field:   field,
+			Code:    CodeTooLong,
+			Message: "Conversations can have at most " + strconv.Itoa(l.MaxParticipants) + " people, you included.",
+			Limit:   l.MaxParticipants,
+		})
+	}
+}
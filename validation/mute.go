@@ -0,0 +1,34 @@
+package validation
+
+import (
+	"strconv"
+	"twitter-feed/search"
+	"unicode/utf8"
+)
+
+// maxMutedWordLength is how many characters a muted word or phrase can have
+const maxMutedWordLength = 100
+
+// MutedWord checks a word, phrase or #hashtag to mute, which has to contain something a tweet
+// can be matched on
+func MutedWord(errs *Errors, field string, word string) {
+	if len(search.Words(word)) == 0 {
+		errs.add(field, CodeRequired, "What do you want to mute? Give a word, a phrase or a #hashtag.")
+		return
+	}
+	if n := utf8.RuneCountInString(word); n > maxMutedWordLength {
+		*errs = append(*errs, FieldError{
+			Field:   field,
+			Code:    CodeTooLong,
+			Message: "Muted words can be at most " + strconv.Itoa(maxMutedWordLength) + " characters long, yours has " + strconv.Itoa(n) + ".",
+			Limit:   maxMutedWordLength,
+		})
+	}
+}
+
+// MuteExpiry checks how many seconds a mute lasts, where zero means until it is undone
+func MuteExpiry(errs *Errors, field string, seconds int64) {
+	if seconds < 0 {
+		errs.add(field, CodeOutOfRange, "A mute cannot last a negative number of seconds; leave it out to mute until you unmute.")
+	}
+}
@@ -0,0 +1,118 @@
+package validation
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strconv"
+	"twitter-feed/entities"
+	"unicode"
+)
+
+// TweetLimit caps the length of tweets, weighted the way Twitter counts characters: Latin and
+// most punctuation weigh 1, everything else, such as CJK, weighs 2, an emoji weighs 2 however
+// many code points it is built from, and every URL weighs URLWeight whatever its length.
+type TweetLimit struct {
+	MaxWeight int
+	URLWeight int
+}
+
+// DefaultTweetLimit allows 280 weighted characters with URLs counting as 23, like t.co links
+var DefaultTweetLimit = TweetLimit{MaxWeight: 280, URLWeight: 23}
+
+// lightRanges are the code points weighing 1
+var lightRanges = []struct{ lo, hi rune }{
+	{0x0000, 0x10FF}, // Latin, Greek, Cyrillic, Hebrew, Arabic and the like
+	{0x2000, 0x200D}, // spaces and zero-width joiners
+	{0x2010, 0x201F}, // dashes and quotation marks
+	{0x2032, 0x2037}, // primes
+}
+
+// Tweet checks the weighted length of NFC-normalized tweet text
+func (l TweetLimit) Tweet(errs *Errors, field string, text string) {
+	weight := l.Weight(text)
+	if weight > l.MaxWeight {
+		*errs = append(*errs, FieldError{
+			Field:   field,
+			Code:    CodeTooLong,
+			Message: "Tweets can be at most " + strconv.Itoa(l.MaxWeight) + " characters long, yours counts " + strconv.Itoa(weight) + ".",
+			Weight:  weight,
+			Limit:   l.MaxWeight,
+		})
+	}
+}
+
+// Weight returns the weighted length of text after NFC normalization
+func (l TweetLimit) Weight(text string) int {
+	text = norm.NFC.String(text)
+	runes := []rune(text)
+	urls := entities.Parse(text).URLs
+	weight := 0
+	for i := 0; i < len(runes); {
+		if len(urls) > 0 && i == urls[0].Start {
+			weight += l.URLWeight
+			i = urls[0].End
+			urls = urls[1:]
+			continue
+		}
+		if n := emoji(runes[i:]); n > 0 {
+			weight += 2
+			i += n
+			continue
+		}
+		weight += runeWeight(runes[i])
+		i++
+	}
+	return weight
+}
+
+func runeWeight(r rune) int {
+	for _, span := range lightRanges {
+		if r >= span.lo && r <= span.hi {
+			return 1
+		}
+	}
+	return 2
+}
+
+// emoji returns how many code points the emoji at the start of runes spans, following skin tone
+// modifiers, variation selectors, keycaps, flags, tag sequences and zero-width joiner sequences,
+// or 0 if runes does not start with an emoji
+func emoji(runes []rune) int {
+	n := emojiBase(runes)
+	if n == 0 {
+		return 0
+	}
+	for n < len(runes) {
+		r := runes[n]
+		switch {
+		case r == 0xFE0F || r == 0x20E3 || (r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F):
+			n++
+		case r == 0x200D && n+1 < len(runes) && emojiBase(runes[n+1:]) > 0:
+			n += 1 + emojiBase(runes[n+1:])
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// emojiBase returns how many code points the emoji character at the start of runes takes: two for
+// a pair of regional indicators forming a flag, one for other pictographs and 0 for anything else.
+// Digits, # and * only count when they are made into keycaps.
+func emojiBase(runes []rune) int {
+	r := runes[0]
+	switch {
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		if len(runes) > 1 && runes[1] >= 0x1F1E6 && runes[1] <= 0x1F1FF {
+			return 2
+		}
+		return 1
+	case r >= 0x1F000 && r <= 0x1FAFF, r >= 0x2600 && r <= 0x27BF, r >= 0x2300 && r <= 0x23FF,
+		r >= 0x2B00 && r <= 0x2BFF, r == 0x00A9, r == 0x00AE, r == 0x203C, r == 0x2049, r == 0x2122:
+		return 1
+	case r == '#' || r == '*' || unicode.IsDigit(r) && r < unicode.MaxASCII:
+		if len(runes) > 2 && runes[1] == 0xFE0F && runes[2] == 0x20E3 || len(runes) > 1 && runes[1] == 0x20E3 {
+			return 1
+		}
+	}
+	return 0
+}
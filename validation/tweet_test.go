@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWeight(t *testing.T) {
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"Grüße, Ελλάδα", 13},
+		// NFC folds e and the combining acute into one character
+		{"cafe\u0301", 4},
+		{"日本語", 6},
+		{"안녕", 4},
+		{"a—b", 3},
+		{"😀", 2},
+		{"👩\u200d💻", 2},
+		{"👍🏽", 2},
+		{"🇯🇵", 2},
+		{"#️⃣", 2},
+		{"❤️", 2},
+		{"#1", 2},
+		{"https://example.com/a/rather/long/path/to/somewhere", 23},
+		{"see https://go.dev.", 28},
+		{"http://a.io http://b.io", 47},
+	}
+	for _, c := range cases {
+		if got := DefaultTweetLimit.Weight(c.text); got != c.want {
+			t.Errorf("Weight(%q) = %d, want %d", c.text, got, c.want)
+		}
+	}
+	short := TweetLimit{MaxWeight: 10, URLWeight: 5}
+	if got := short.Weight("go https://go.dev"); got != 8 {
+		t.Errorf("Weight with URLs counting 5 = %d, want 8", got)
+	}
+}
+
+func TestTweet(t *testing.T) {
+	cases := []struct {
+		text   string
+		weight int
+	}{
+		{strings.Repeat("a", 279), 0},
+		{strings.Repeat("a", 280), 0},
+		{strings.Repeat("a", 281), 281},
+		{strings.Repeat("日", 140), 0},
+		{strings.Repeat("日", 140) + "a", 281},
+		{strings.Repeat("😀", 141), 282},
+		// decomposed characters are counted once normalized
+		{strings.Repeat("e\u0301", 280), 0},
+		{strings.Repeat("e\u0301", 281), 281},
+		{strings.Repeat("a", 256) + " https://example.com", 0},
+		{strings.Repeat("a", 257) + " https://example.com", 281},
+	}
+	for _, c := range cases {
+		var errs Errors
+		DefaultTweetLimit.Tweet(&errs, "input", c.text)
+		if c.weight == 0 {
+			if errs != nil {
+				t.Errorf("a tweet of %d weighted characters got %v", DefaultTweetLimit.Weight(c.text), errs)
+			}
+			continue
+		}
+		if code(t, errs) != CodeTooLong || errs[0].Field != "input" || errs[0].Weight != c.weight || errs[0].Limit != 280 {
+			t.Errorf("a tweet of %d weighted characters got %+v", c.weight, errs)
+		}
+	}
+}
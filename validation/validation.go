@@ -0,0 +1,239 @@
+// Package validation checks user-supplied account fields before they reach the store. Every rule
+// reports a FieldError instead of stopping at the first problem, so a client can show all of them
+// at once.
+package validation
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Weight and Limit are set when a tweet is too long, to the weighted length counted and allowed.
+	// Limit is also set when a message, a conversation or a muted word is too big.
+	Weight int `json:"weight,omitempty"`
+	Limit  int `json:"limit,omitempty"`
+}
+
+// Errors is the list of problems found in a request. A nil Errors means the request is valid.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fe := range e {
+		messages = append(messages, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *Errors) add(field string, code string, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Field error codes
+const (
+	CodeRequired = "required"
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeCharset  = "invalid_characters"
+	CodeReserved = "reserved"
+	CodeWeak     = "weak_password"
+	CodeBreached = "breached_password"
+	// CodeUnknownUser flags a mention or a participant that does not exist
+	CodeUnknownUser = "unknown_user"
+	// CodeOutOfRange flags a number outside of what the field allows
+	CodeOutOfRange = "out_of_range"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 15
+	maxNameLength     = 50
+	maxBioLength      = 160
+	// maxPasswordBytes is where bcrypt stops reading, so longer passwords would be silently truncated
+	maxPasswordBytes = 72
+)
+
+// reserved are usernames that would be confused with the service itself or its routes
+var reserved = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "support": true, "help": true,
+	"twitter": true, "system": true, "api": true, "login": true, "logout": true,
+	"register": true, "profile": true, "timeline": true, "users": true, "settings": true,
+	"null": true, "undefined": true, "me": true,
+}
+
+// Policy is the password policy
+type Policy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// RequireLetter, RequireDigit and RequireSymbol demand at least one character of each class
+	RequireLetter bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Blocklist holds known breached passwords, lowercased
+	Blocklist map[string]bool
+}
+
+// DefaultPolicy asks for eight characters mixing letters and digits
+var DefaultPolicy = Policy{
+	MinLength:     8,
+	RequireLetter: true,
+	RequireDigit:  true,
+}
+
+// LoadBlocklist reads a breached-password list with one password per line. Blank lines and
+// lines starting with # are skipped.
+func LoadBlocklist(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	blocklist := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = true
+	}
+	return blocklist, scanner.Err()
+}
+
+// Registration holds the fields of a new account
+type Registration struct {
+	Username  string
+	FirstName string
+	LastName  string
+	Password  string
+	Bio       string
+}
+
+// Registration validates every field of a new account
+func (p Policy) Registration(reg Registration) Errors {
+	var errs Errors
+	Username(&errs, "username", reg.Username)
+	Name(&errs, "firstname", reg.FirstName)
+	Name(&errs, "lastname", reg.LastName)
+	Bio(&errs, "bio", reg.Bio)
+	p.Password(&errs, "password", reg.Password, reg.Username)
+	return errs
+}
+
+// Username checks that a username is 3 to 15 letters, digits or underscores and is not reserved.
+// Uniqueness, which ignores case, is enforced by the store.
+func Username(errs *Errors, field string, username string) {
+	if username == "" {
+		errs.add(field, CodeRequired, "Pick a username.")
+		return
+	}
+	for _, c := range username {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			errs.add(field, CodeCharset, "Usernames can only contain letters, numbers and underscores.")
+			return
+		}
+	}
+	switch {
+	case len(username) < minUsernameLength:
+		errs.add(field, CodeTooShort, "Usernames must be at least "+strconv.Itoa(minUsernameLength)+" characters long.")
+	case len(username) > maxUsernameLength:
+		errs.add(field, CodeTooLong, "Usernames can be at most "+strconv.Itoa(maxUsernameLength)+" characters long.")
+	case reserved[strings.ToLower(username)]:
+		errs.add(field, CodeReserved, "That username is reserved, please try another.")
+	}
+}
+
+// Name checks a first or last name: required, at most 50 characters and free of control characters
+func Name(errs *Errors, field string, name string) {
+	if strings.TrimSpace(name) == "" {
+		errs.add(field, CodeRequired, "This name is required.")
+		return
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		errs.add(field, CodeTooLong, "Names can be at most "+strconv.Itoa(maxNameLength)+" characters long.")
+		return
+	}
+	if !printable(name, false) {
+		errs.add(field, CodeCharset, "Names cannot contain control characters.")
+	}
+}
+
+// Bio checks an optional bio: at most 160 characters, and line breaks are the only control characters allowed
+func Bio(errs *Errors, field string, bio string) {
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		errs.add(field, CodeTooLong, "Bios can be at most "+strconv.Itoa(maxBioLength)+" characters long.")
+		return
+	}
+	if !printable(bio, true) {
+		errs.add(field, CodeCharset, "Bios cannot contain control characters.")
+	}
+}
+
+// Password checks a password against the policy. username, when set, must not be the password.
+func (p Policy) Password(errs *Errors, field string, password string, username string) {
+	if password == "" {
+		errs.add(field, CodeRequired, "Pick a password.")
+		return
+	}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		errs.add(field, CodeTooShort, "Passwords must be at least "+strconv.Itoa(p.MinLength)+" characters long.")
+		return
+	}
+	if len(password) > maxPasswordBytes {
+		errs.add(field, CodeTooLong, "Passwords can be at most "+strconv.Itoa(maxPasswordBytes)+" bytes long.")
+		return
+	}
+	var letter, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			letter = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	var missing []string
+	if p.RequireLetter && !letter {
+		missing = append(missing, "a letter")
+	}
+	if p.RequireDigit && !digit {
+		missing = append(missing, "a number")
+	}
+	if p.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		errs.add(field, CodeWeak, "Passwords must contain at least "+strings.Join(missing, ", ")+".")
+		return
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		errs.add(field, CodeWeak, "Your password cannot be your username.")
+		return
+	}
+	if p.Blocklist[strings.ToLower(password)] {
+		errs.add(field, CodeBreached, "This password has appeared in a data breach, please choose another.")
+	}
+}
+
+func printable(s string, newlines bool) bool {
+	for _, c := range s {
+		if newlines && c == '\n' {
+			continue
+		}
+		if unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package validation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// code returns the code of the single error in errs, or "" when there is none
+func code(t *testing.T, errs Errors) string {
+	t.Helper()
+	switch len(errs) {
+	case 0:
+		return ""
+	case 1:
+		return errs[0].Code
+	}
+	t.Fatalf("got %d errors, want at most one: %v", len(errs), errs)
+	return ""
+}
+
+func TestUsername(t *testing.T) {
+	cases := []struct {
+		username string
+		want     string
+	}{
+		{"alice", ""},
+		{"Alice_1", ""},
+		{"", CodeRequired},
+		{"al", CodeTooShort},
+		{"abcdefghijklmnop", CodeTooLong},
+		{"al ice", CodeCharset},
+		{"al|ice", CodeCharset},
+		{"élise", CodeCharset},
+		{"Admin", CodeReserved},
+		{"Root", CodeReserved},
+	}
+	for _, c := range cases {
+		var errs Errors
+		Username(&errs, "username", c.username)
+		if got := code(t, errs); got != c.want {
+			t.Errorf("Username(%q) = %q, want %q", c.username, got, c.want)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	symbols := DefaultPolicy
+	symbols.RequireSymbol = true
+	breached := DefaultPolicy
+	breached.Blocklist = map[string]bool{"password1": true}
+	cases := []struct {
+		policy   Policy
+		password string
+		username string
+		want     string
+	}{
+		{DefaultPolicy, "password1", "alice", ""},
+		{DefaultPolicy, "", "alice", CodeRequired},
+		{DefaultPolicy, "passw0r", "alice", CodeTooShort},
+		// the old check took spaces and pipes for digits
+		{DefaultPolicy, "1 | 2 | 3", "alice", CodeWeak},
+		{DefaultPolicy, "        ", "alice", CodeWeak},
+		{DefaultPolicy, "password|", "alice", CodeWeak},
+		{DefaultPolicy, "12345678", "alice", CodeWeak},
+		// length counts characters, not bytes
+		{DefaultPolicy, "pässwör1", "alice", ""},
+		{DefaultPolicy, strings.Repeat("a1", 37), "alice", CodeTooLong},
+		{DefaultPolicy, "Alice1234", "alice1234", CodeWeak},
+		{symbols, "password1", "alice", CodeWeak},
+		{symbols, "password1!", "alice", ""},
+		{breached, "PASSWORD1", "alice", CodeBreached},
+		{breached, "password2", "alice", ""},
+	}
+	for _, c := range cases {
+		var errs Errors
+		c.policy.Password(&errs, "password", c.password, c.username)
+		if got := code(t, errs); got != c.want {
+			t.Errorf("Password(%q) = %q, want %q", c.password, got, c.want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"Zoë", ""},
+		{"Mary Ann", ""},
+		{"", CodeRequired},
+		{"   ", CodeRequired},
+		{strings.Repeat("é", 50), ""},
+		{strings.Repeat("é", 51), CodeTooLong},
+		{"Al\tice", CodeCharset},
+		{"Al\nice", CodeCharset},
+	}
+	for _, c := range cases {
+		var errs Errors
+		Name(&errs, "firstname", c.name)
+		if got := code(t, errs); got != c.want {
+			t.Errorf("Name(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBio(t *testing.T) {
+	cases := []struct {
+		bio  string
+		want string
+	}{
+		{"", ""},
+		{"first line\nsecond line", ""},
+		{strings.Repeat("x", 160), ""},
+		{strings.Repeat("x", 161), CodeTooLong},
+		{"ring\a", CodeCharset},
+	}
+	for _, c := range cases {
+		var errs Errors
+		Bio(&errs, "bio", c.bio)
+		if got := code(t, errs); got != c.want {
+			t.Errorf("Bio(%q) = %q, want %q", c.bio, got, c.want)
+		}
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	errs := DefaultPolicy.Registration(Registration{Username: "alice", FirstName: "Alice", LastName: "Liddell", Password: "password1"})
+	if errs != nil {
+		t.Errorf("a valid registration got %v", errs)
+	}
+	// every invalid field is reported at once
+	errs = DefaultPolicy.Registration(Registration{Username: "a b", Password: "1 | 2 | 3", Bio: strings.Repeat("x", 161)})
+	fields := make([]string, 0, len(errs))
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	if strings.Join(fields, ",") != "username,firstname,lastname,bio,password" {
+		t.Errorf("fields in error = %v", fields)
+	}
+	if !strings.Contains(errs.Error(), "password: ") {
+		t.Errorf("Error() = %q, want every field named", errs.Error())
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "breached.txt")
+	err = ioutil.WriteFile(path, []byte("# common passwords\n\nPassword1\n  qwerty123  \n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocklist, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocklist) != 2 || !blocklist["password1"] || !blocklist["qwerty123"] {
+		t.Errorf("LoadBlocklist = %v, want password1 and qwerty123", blocklist)
+	}
+	_, err = LoadBlocklist(filepath.Join(dir, "missing.txt"))
+	if err == nil {
+		t.Error("loading a missing file succeeded")
+	}
+}